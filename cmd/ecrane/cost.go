@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+func runCost(args []string) error {
+	var common commonFlags
+	fs := flag.NewFlagSet("ecrane cost", flag.ExitOnError)
+	common.register(fs)
+	all := fs.Bool("all", false, "treat FILE_PATH as a glob and sum the cost of all regular files matching it")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ecrane cost [OPTIONS] IMAGE_NAME FILE_PATH")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitError(exitUsage)
+	}
+
+	return withCommon(common, func(ctx context.Context, opts []remote.Option) error {
+		return printCost(ctx, fs.Arg(0), fs.Arg(1), *all, opts)
+	})
+}
+
+func printCost(ctx context.Context, imageName, filePath string, all bool, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	paths := []string{filePath}
+	if all {
+		if paths, err = globFiles(ctx, r, filePath); err != nil {
+			return err
+		}
+	}
+
+	plan, err := r.PlanRead(ctx, paths...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("files: %d\n", len(paths))
+	fmt.Printf("footer: %d\n", plan.FooterBytes)
+	fmt.Printf("toc: %d\n", plan.TOCBytes)
+	fmt.Printf("chunks: %d\n", plan.ChunkBytes)
+	fmt.Printf("total: %d\n", plan.Total())
+	return nil
+}
+
+// globFiles returns the regular files in the merged view matching the pattern of path.Match.
+func globFiles(ctx context.Context, r remote.Remote, pattern string) ([]string, error) {
+	pattern, err := cleanGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	err = r.Walk(ctx, func(_ *remote.Layer, e *estargz.TOCEntry) error {
+		if ok, _ := path.Match(pattern, e.Name); ok && e.Type == "reg" {
+			paths = append(paths, e.Name)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// cleanGlob normalizes the pattern of path.Match into the form of TOC entry names, which have no leading slash.
+func cleanGlob(pattern string) (string, error) {
+	pattern = strings.TrimPrefix(path.Clean("/"+pattern), "/")
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return pattern, nil
+}
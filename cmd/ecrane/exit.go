@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+// Exit codes of ecrane, so that scripts can tell failures apart.
+const (
+	exitFailure  = 1 // any other failure, and the negative answer of --exists and --check
+	exitUsage    = 2 // invalid arguments
+	exitNotFound = 3 // the file or the image doesn't exist
+	exitAuth     = 4 // the registry rejected the credentials
+	exitNetwork  = 5 // the registry couldn't be reached or the operation timed out
+)
+
+// exitError makes ecrane exit with the code without any message.
+type exitError int
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// warnings prints problems which don't fail the command. --quiet discards them.
+var warnings = log.New(os.Stderr, "warning: ", 0)
+
+// setQuiet discards the warnings.
+func setQuiet() {
+	warnings.SetOutput(ioutil.Discard)
+}
+
+// exitCode returns the exit code for the error returned by run.
+func exitCode(err error) int {
+	var (
+		exitErr      exitError
+		transportErr *transport.Error
+		netErr       net.Error
+	)
+	switch {
+	case errors.As(err, &exitErr):
+		return int(exitErr)
+	case errors.Is(err, remote.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		return exitNotFound
+	case errors.As(err, &transportErr):
+		switch transportErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitAuth
+		case http.StatusNotFound:
+			return exitNotFound
+		}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return exitNetwork
+	}
+	return exitFailure
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestExitCode(t *testing.T) {
+	ref := pushLayers(t, []remotetest.File{{Name: "etc/"}, {Name: "etc/os-release", Content: "exit"}})
+	host := strings.SplitN(ref, "/", 2)[0]
+
+	// The registry rejects everyone
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	t.Cleanup(auth.Close)
+	// Nothing listens on the address after the server is closed
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "success", args: []string{ref, "etc/os-release"}, want: 0},
+		{name: "usage", args: []string{ref}, want: exitUsage},
+		{name: "usage of a subcommand", args: []string{"os"}, want: exitUsage},
+		{name: "missing file", args: []string{ref, "etc/missing"}, want: exitNotFound},
+		{name: "missing image", args: []string{host + "/test/missing:latest", "etc/os-release"}, want: exitNotFound},
+		{name: "exists", args: []string{"--exists", ref, "etc/os-release"}, want: 0},
+		{name: "not exists", args: []string{"--exists", ref, "etc/missing"}, want: exitFailure},
+		{name: "auth", args: []string{strings.TrimPrefix(auth.URL, "http://") + "/test/img:latest", "etc/os-release"}, want: exitAuth},
+		{name: "network", args: []string{"--timeout", "10s", strings.TrimPrefix(closed.URL, "http://") + "/test/img:latest", "etc/os-release"}, want: exitNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if _, cerr := captureStdout(t, func() error {
+				_, err = captureStderr(t, func() error {
+					return run(tt.args)
+				})
+				return nil
+			}); cerr != nil {
+				t.Fatal(cerr)
+			}
+			got := 0
+			if err != nil {
+				got = exitCode(err)
+			}
+			if got != tt.want {
+				t.Errorf("got exit code %d (%v), want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	good, goodTOC := buildLayer(t, remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/os-release", Content: "quiet"})
+	corrupt, corruptTOC := buildLayer(t, remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/hostname", Content: "broken"})
+	ref := pushBlobs(t, [][]byte{corrupt[:len(corrupt)-10], good}, []string{corruptTOC, goodTOC})
+
+	for _, quiet := range []bool{false, true} {
+		var warned bytes.Buffer
+		warnings.SetOutput(&warned)
+		t.Cleanup(func() { warnings.SetOutput(os.Stderr) })
+
+		args := []string{ref, "etc/os-release"}
+		if quiet {
+			args = append([]string{"--quiet"}, args...)
+		}
+		if _, err := captureStdout(t, func() error { return run(args) }); err != nil {
+			t.Fatal(err)
+		}
+		if got := warned.Len() > 0; got == quiet {
+			t.Errorf("quiet %v: unexpected warnings %q", quiet, warned.String())
+		}
+	}
+}
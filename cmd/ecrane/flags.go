@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/ecr"
+	"github.com/knqyf263/stargz-registry/remote/gcp"
+)
+
+// commonFlags are the flags shared by all commands.
+type commonFlags struct {
+	timeout     time.Duration
+	traceFile   string
+	cacheDir    string
+	offline     bool
+	maxLayers   int
+	maxRequests int
+	concurrency int
+	profile     bool
+	quiet       bool
+}
+
+// defaultMaxLayers is the default of --max-layers.
+// Real images rarely have more than 127 layers, which is the limit of overlayfs in Docker,
+// while every layer costs a redirect request and a goroutine.
+const defaultMaxLayers = 256
+
+// maxDefaultConcurrency caps the default of --concurrency so that many-core machines don't overwhelm small registries.
+const maxDefaultConcurrency = 16
+
+// defaultConcurrency returns the default of --concurrency, the number of CPUs up to maxDefaultConcurrency.
+func defaultConcurrency() int {
+	if n := runtime.NumCPU(); n < maxDefaultConcurrency {
+		return n
+	}
+	return maxDefaultConcurrency
+}
+
+// maxConcurrency returns the number of the n layers or files of the image processed at the same time,
+// which is bounded by --concurrency.
+func maxConcurrency(r remote.Remote, n int) int {
+	if c := r.MaxConcurrency(); c > 0 && c < n {
+		return c
+	}
+	return n
+}
+
+func (f *commonFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&f.timeout, "timeout", 0, "abort the whole operation after the given duration (0 means no timeout)")
+	fs.StringVar(&f.traceFile, "trace-file", "", "write every request and its response to the file as NDJSON")
+	fs.StringVar(&f.cacheDir, "cache-dir", "", "persist fetched blob ranges in the directory")
+	fs.BoolVar(&f.offline, "offline", false, "read only from the cache directory without accessing the registry")
+	fs.BoolVar(&f.profile, "profile", false, "print a summary of the requests per operation to stderr at the end")
+	fs.BoolVar(&f.quiet, "quiet", false, "don't print warnings, e.g. about layers skipped because they couldn't be read")
+	fs.IntVar(&f.maxLayers, "max-layers", defaultMaxLayers, "refuse images with more layers than this (0 means no limit)")
+	fs.IntVar(&f.maxRequests, "max-requests", 0, "fail once an operation reading layers has issued this many requests (0 means no limit)")
+	fs.IntVar(&f.concurrency, "concurrency", defaultConcurrency(), "read at most N layers or files at the same time")
+}
+
+// options returns the options for openImage. The returned function releases the resources.
+func (f *commonFlags) options() ([]remote.Option, func(), error) {
+	var (
+		// ECR and GCP registries are resolved by their SDKs unless the docker config has credentials for them
+		keychain = authn.NewMultiKeychain(authn.DefaultKeychain, ecr.NewKeychain(), gcp.NewKeychain())
+		opts     = []remote.Option{remote.WithKeychain(keychain)}
+		closers  []func()
+	)
+	cleanup := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	if f.traceFile != "" {
+		file, err := os.Create(f.traceFile)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		closers = append(closers, func() { file.Close() })
+		opts = append(opts, remote.WithTrace(file))
+	}
+
+	if f.cacheDir != "" {
+		opts = append(opts, remote.WithDiskCache(f.cacheDir))
+	}
+	if f.offline {
+		opts = append(opts, remote.WithOffline())
+	}
+	opts = append(opts, remote.WithMaxLayers(f.maxLayers), remote.WithMaxConcurrency(f.concurrency))
+	if f.maxRequests > 0 {
+		opts = append(opts, remote.WithMaxRequests(f.maxRequests))
+	}
+
+	// Render a progress bar when someone watches stderr, unless the output itself goes to the terminal
+	if !f.quiet && isTerminal(os.Stderr) && !isTerminal(os.Stdout) {
+		bar := &progressBar{w: os.Stderr}
+		opts = append(opts, remote.WithProgress(bar.update))
+	}
+
+	if f.profile {
+		p := remote.NewProfile()
+		closers = append(closers, func() { p.WriteSummary(os.Stderr) })
+		opts = append(opts, remote.WithProfile(p))
+	}
+
+	return opts, cleanup, nil
+}
+
+// withCommon calls fn with the options and the timeout specified by the common flags.
+func withCommon(common commonFlags, fn func(ctx context.Context, opts []remote.Option) error) error {
+	if common.quiet {
+		setQuiet()
+	}
+
+	opts, cleanup, err := common.options()
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withTimeout(context.Background(), common.timeout)
+	defer cancel()
+
+	err = fn(ctx, opts)
+
+	var tooMany *remote.TooManyLayersError
+	if errors.As(err, &tooMany) {
+		return fmt.Errorf("%w; the image may be malformed, or raise the limit with --max-layers", err)
+	}
+	if errors.Is(err, remote.ErrRequestBudgetExceeded) {
+		return fmt.Errorf("%w; the file may be highly fragmented, or raise the budget with --max-requests", err)
+	}
+	return timeoutError(err, common.timeout)
+}
+
+// openImage resolves the image within ctx, so that --timeout also bounds fetching the manifest.
+func openImage(ctx context.Context, imageName string, opts []remote.Option) (remote.Remote, error) {
+	resolver, err := remote.NewResolver(opts...)
+	if err != nil {
+		return remote.Remote{}, err
+	}
+	r, err := resolver.Open(ctx, imageName)
+	if err != nil {
+		return remote.Remote{}, err
+	}
+	return *r, nil
+}
+
+// withTimeout returns a context that is canceled after timeout unless timeout is zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// timeoutError makes an error caused by the timeout self-explanatory.
+// Errors are returned as is when no timeout is set.
+func timeoutError(err error, timeout time.Duration) error {
+	if timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestWithCommonTimeout(t *testing.T) {
+	// The registry answers the ping but never the manifest.
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	t.Cleanup(s.Close)
+	t.Cleanup(func() { close(done) })
+	ref := strings.TrimPrefix(s.URL, "http://") + "/test/img:latest"
+
+	start := time.Now()
+	err := withCommon(commonFlags{timeout: 100 * time.Millisecond, concurrency: 1}, func(ctx context.Context, opts []remote.Option) error {
+		r, err := openImage(ctx, ref, opts)
+		if err != nil {
+			return err
+		}
+		_, err = r.Exists(ctx, "etc/a")
+		return err
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !strings.HasPrefix(err.Error(), "timed out after 100ms: ") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s to time out", elapsed)
+	}
+}
+
+func TestWithCommonNoTimeout(t *testing.T) {
+	err := withCommon(commonFlags{}, func(ctx context.Context, opts []remote.Option) error {
+		return context.DeadlineExceeded
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	if n := defaultConcurrency(); n < 1 || n > maxDefaultConcurrency {
+		t.Errorf("got the default concurrency %d", n)
+	}
+	var common commonFlags
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	common.register(fs)
+	if err := fs.Parse([]string{"--concurrency", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if common.concurrency != 3 {
+		t.Errorf("got concurrency %d, want 3", common.concurrency)
+	}
+
+	// The registry delays the blob range requests so that concurrent ones overlap
+	reg := registry.New(registry.Logger(log.New(ioutil.Discard, "", 0)))
+	var mu sync.Mutex
+	var cur, max int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") && r.Header.Get("Range") != "" {
+			mu.Lock()
+			if cur++; cur > max {
+				max = cur
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				cur--
+				mu.Unlock()
+			}()
+			time.Sleep(5 * time.Millisecond)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+
+	// Every layer has the file, which is printed from the top
+	var blobs [][]byte
+	var want string
+	for i := 0; i < 8; i++ {
+		want = fmt.Sprintf("layer %d\n", i) + want
+		blob, _ := buildLayer(t, remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/os-release", Content: fmt.Sprintf("layer %d", i)})
+		blobs = append(blobs, blob)
+	}
+	img, err := remotetest.NewImage(blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := pushImage(t, strings.TrimPrefix(s.URL, "http://"), img)
+
+	for _, n := range []int{1, 2} {
+		mu.Lock()
+		max = 0
+		mu.Unlock()
+		out, err := captureStdout(t, func() error {
+			return readFile(context.Background(), ref, "etc/os-release", false, false, []remote.Option{remote.WithMaxConcurrency(n)})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != want {
+			t.Errorf("got %q, want %q", out, want)
+		}
+		mu.Lock()
+		if max > n {
+			t.Errorf("got %d requests in flight, want at most %d", max, n)
+		}
+		mu.Unlock()
+	}
+}
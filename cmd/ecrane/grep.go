@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"path"
+	"regexp"
+	"sync"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+// sniffLen is the length of the head of a file checked for NUL bytes, as GNU grep does.
+const sniffLen = 8000
+
+func runGrep(args []string) error {
+	var common commonFlags
+	fs := flag.NewFlagSet("ecrane grep", flag.ExitOnError)
+	common.register(fs)
+	maxSize := fs.Int64("max-size", 1<<20, "skip files larger than N bytes, or 0 to search all files")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ecrane grep [OPTIONS] PATTERN IMAGE_NAME [PATH_GLOB]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 && fs.NArg() != 3 {
+		fs.Usage()
+		return exitError(exitUsage)
+	}
+	re, err := regexp.Compile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	var glob string
+	if fs.NArg() == 3 {
+		if glob, err = cleanGlob(fs.Arg(2)); err != nil {
+			return err
+		}
+	}
+
+	return withCommon(common, func(ctx context.Context, opts []remote.Option) error {
+		return grep(ctx, re, fs.Arg(1), glob, *maxSize, opts)
+	})
+}
+
+// grepFile is a regular file in the merged view to be searched.
+type grepFile struct {
+	layer *remote.Layer
+	name  string
+	lines []string // matching lines prefixed with the line numbers
+	err   error
+}
+
+// grep prints the lines matching re in the text files in the merged view whose paths match glob, if not empty.
+// Only the candidate files are fetched, as many at the same time as --concurrency,
+// and binary files are skipped after reading their heads.
+func grep(ctx context.Context, re *regexp.Regexp, imageName, glob string, maxSize int64, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	var files []*grepFile
+	err = r.Walk(ctx, func(l *remote.Layer, e *estargz.TOCEntry) error {
+		if e.Type != "reg" || e.Size == 0 || (maxSize > 0 && e.Size > maxSize) {
+			return nil
+		}
+		if ok, _ := path.Match(glob, e.Name); ok || glob == "" {
+			files = append(files, &grepFile{layer: l, name: e.Name})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sem := make(chan struct{}, maxConcurrency(r, len(files)))
+	var wg sync.WaitGroup
+	for _, f := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(f *grepFile) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			f.lines, f.err = grepLayerFile(f.layer, f.name, re)
+		}(f)
+	}
+	wg.Wait()
+
+	// Print in the walk order so that the output is deterministic.
+	for _, f := range files {
+		if f.err != nil {
+			return fmt.Errorf("%s: %w", f.name, f.err)
+		}
+		for _, line := range f.lines {
+			fmt.Printf("%s:%s\n", f.name, line)
+		}
+	}
+	return nil
+}
+
+// grepLayerFile returns the lines of the file matching re, or nothing if the file is binary.
+func grepLayerFile(l *remote.Layer, name string, re *regexp.Regexp) ([]string, error) {
+	head, err := l.ReadFileRange(name, 0, sniffLen)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if _, err = l.CopyFile(&buf, name); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for i, line := range bytes.Split(buf.Bytes(), []byte("\n")) {
+		if re.Match(line) {
+			lines = append(lines, fmt.Sprintf("%d:%s", i+1, line))
+		}
+	}
+	return lines, nil
+}
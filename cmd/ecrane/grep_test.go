@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestGrep(t *testing.T) {
+	ref := pushLayers(t,
+		[]remotetest.File{
+			{Name: "etc/"},
+			{Name: "etc/a", Content: "foo\nneedle here\nbar"},
+			{Name: "etc/b", Content: "nothing"},
+			{Name: "etc/bin", Content: "needle\x00"},
+			{Name: "etc/large", Content: "needle in a large file"},
+		},
+		[]remotetest.File{{Name: "etc/c", Content: "x\nneedle"}},
+	)
+	tests := []struct {
+		name    string
+		glob    string
+		maxSize int64
+		want    []string
+	}{
+		{name: "all files", want: []string{"etc/a:2:needle here", "etc/c:2:needle", "etc/large:1:needle in a large file"}},
+		{name: "glob", glob: "etc/a", want: []string{"etc/a:2:needle here"}},
+		{name: "size cap", maxSize: 20, want: []string{"etc/a:2:needle here", "etc/c:2:needle"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := captureStdout(t, func() error {
+				return grep(context.Background(), regexp.MustCompile("needle"), ref, tt.glob, tt.maxSize, nil)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Siblings aren't walked in a fixed order.
+			lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+			sort.Strings(lines)
+			if strings.Join(lines, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got %q, want %q", lines, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// newRegistry starts an in-memory registry and returns its host.
+func newRegistry(t *testing.T) string {
+	t.Helper()
+	s := httptest.NewServer(remotetest.NewHandler())
+	t.Cleanup(s.Close)
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// pushImage pushes img to the registry at host and returns its reference.
+func pushImage(t *testing.T, host string, img v1.Image) string {
+	t.Helper()
+	ref := host + "/test/img:latest"
+	if err := remotetest.Push(http.DefaultTransport, ref, img); err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+// buildLayer synthesizes an estargz layer of the files and returns it with the digest of its TOC.
+func buildLayer(t *testing.T, files ...remotetest.File) ([]byte, string) {
+	t.Helper()
+	blob, tocDigest, err := remotetest.BuildLayer(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob, tocDigest
+}
+
+// pushBlobs pushes an image of the estargz blobs annotated with the TOC digests, from the bottom, and returns its reference.
+// The blobs are pushed as is, so that tests can push corrupted blobs.
+func pushBlobs(t *testing.T, blobs [][]byte, tocDigests []string) string {
+	t.Helper()
+	img := empty.Image
+	for i, blob := range blobs {
+		var err error
+		img, err = mutate.Append(img, mutate.Addendum{
+			Layer:       remotetest.RawLayer{Blob: blob, Type: types.OCILayer},
+			MediaType:   types.OCILayer,
+			Annotations: map[string]string{estargz.TOCJSONDigestAnnotation: tocDigests[i]},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return pushImage(t, newRegistry(t), img)
+}
+
+// pushLayers pushes an image with an estargz layer for each set of files and returns its reference.
+func pushLayers(t *testing.T, layers ...[]remotetest.File) string {
+	t.Helper()
+	var blobs [][]byte
+	var tocDigests []string
+	for _, files := range layers {
+		blob, tocDigest := buildLayer(t, files...)
+		blobs = append(blobs, blob)
+		tocDigests = append(tocDigests, tocDigest)
+	}
+	return pushBlobs(t, blobs, tocDigests)
+}
+
+// captureStdout returns what fn prints to the standard output.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	return capture(t, &os.Stdout, fn)
+}
+
+// captureStderr returns what fn prints to the standard error.
+func captureStderr(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	return capture(t, &os.Stderr, fn)
+}
+
+// capture returns what fn writes to the file, which is replaced with a pipe while fn runs.
+func capture(t *testing.T, f **os.File, fn func() error) (string, error) {
+	t.Helper()
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := *f
+	*f = pw
+	fnErr := fn()
+	pw.Close()
+	*f = orig
+	b, err := ioutil.ReadAll(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), fnErr
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+func runLabels(args []string) error {
+	var common commonFlags
+	fs := flag.NewFlagSet("ecrane labels", flag.ExitOnError)
+	common.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ecrane labels [OPTIONS] IMAGE_NAME")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError(exitUsage)
+	}
+
+	return withCommon(common, func(ctx context.Context, opts []remote.Option) error {
+		return printLabels(ctx, fs.Arg(0), opts)
+	})
+}
+
+func printLabels(ctx context.Context, imageName string, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	labels, err := r.Labels(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("%s=%s\n", k, labels[k])
+	}
+	return nil
+}
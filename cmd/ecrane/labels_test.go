@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+func TestPrintLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   string
+	}{
+		{
+			name:   "sorted",
+			labels: map[string]string{"version": "1.0", "maintainer": "someone", "description": "a=b"},
+			want:   "description=a=b\nmaintainer=someone\nversion=1.0\n",
+		},
+		{name: "no labels", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := mutate.Config(empty.Image, v1.Config{Labels: tt.labels})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ref := pushImage(t, newRegistry(t), img)
+			got, err := captureStdout(t, func() error {
+				return printLabels(context.Background(), ref, nil)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
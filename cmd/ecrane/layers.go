@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+func runLayers(args []string) error {
+	var common commonFlags
+	fs := flag.NewFlagSet("ecrane layers", flag.ExitOnError)
+	common.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ecrane layers [OPTIONS] IMAGE_NAME")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError(exitUsage)
+	}
+
+	return withCommon(common, func(ctx context.Context, opts []remote.Option) error {
+		return printLayers(ctx, fs.Arg(0), opts)
+	})
+}
+
+func printLayers(ctx context.Context, imageName string, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	layers, err := r.Layers(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tDIGEST\tSIZE\tMEDIA TYPE\tVARIANT\tTOC DIGEST")
+	for _, l := range layers {
+		// Layers which aren't built as stargz are still listed since they're part of the image
+		variant := "-"
+		if v, err := l.Variant(); err == nil {
+			variant = string(v)
+		}
+		tocDigest := l.Annotations()[estargz.TOCJSONDigestAnnotation]
+		if tocDigest == "" {
+			tocDigest = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n", l.Index(), l.Digest(), l.Size(), l.MediaType(), variant, tocDigest)
+	}
+	return w.Flush()
+}
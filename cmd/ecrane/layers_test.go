@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestPrintLayers(t *testing.T) {
+	stargz, tocDigest := buildLayer(t, remotetest.File{Name: "a", Content: "a"})
+	var plain bytes.Buffer
+	zw := gzip.NewWriter(&plain)
+	if _, err := zw.Write([]byte("not a stargz layer")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := mutate.Append(empty.Image,
+		mutate.Addendum{
+			Layer:       remotetest.RawLayer{Blob: stargz, Type: types.OCILayer},
+			MediaType:   types.OCILayer,
+			Annotations: map[string]string{estargz.TOCJSONDigestAnnotation: tocDigest},
+		},
+		mutate.Addendum{Layer: remotetest.RawLayer{Blob: plain.Bytes(), Type: types.OCILayer}, MediaType: types.DockerLayer},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := pushImage(t, newRegistry(t), img)
+
+	out, err := captureStdout(t, func() error {
+		return printLayers(context.Background(), ref, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		rows = append(rows, strings.Fields(line))
+	}
+
+	digestOf := func(b []byte) string {
+		h, err := remotetest.RawLayer{Blob: b, Type: types.OCILayer}.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h.String()
+	}
+	want := [][]string{
+		{"INDEX", "DIGEST", "SIZE", "MEDIA", "TYPE", "VARIANT", "TOC", "DIGEST"},
+		{"0", digestOf(stargz), fmt.Sprint(len(stargz)), string(types.OCILayer), "estargz", tocDigest},
+		{"1", digestOf(plain.Bytes()), fmt.Sprint(plain.Len()), string(types.DockerLayer), "-", "-"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got\n%s\nwant columns %q", out, want)
+	}
+}
@@ -1,39 +1,158 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"regexp"
 	"sync"
-
-	"github.com/containerd/stargz-snapshotter/estargz"
-	"golang.org/x/sync/errgroup"
+	"time"
 
 	"github.com/knqyf263/stargz-registry/remote"
 )
 
 func main() {
-	if err := run(); err != nil {
-		log.Fatal(err)
+	if err := run(os.Args[1:]); err != nil {
+		var exitErr exitError
+		if !errors.As(err, &exitErr) {
+			log.Print(err)
+		}
+		os.Exit(exitCode(err))
 	}
 }
 
-func run() error {
-	args := os.Args
-	if len(args) != 3 {
-		fmt.Println("Usage: ecrane IMAGE_NAME FILE_PATH")
-		return nil
+func run(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "verify":
+			return runVerify(args[1:])
+		case "os":
+			return runOS(args[1:])
+		case "tar":
+			return runTar(args[1:])
+		case "labels":
+			return runLabels(args[1:])
+		case "layers":
+			return runLayers(args[1:])
+		case "cost":
+			return runCost(args[1:])
+		case "grep":
+			return runGrep(args[1:])
+		}
+	}
+	return runCat(args)
+}
+
+func runCat(args []string) error {
+	var common commonFlags
+	fs := flag.NewFlagSet("ecrane", flag.ExitOnError)
+	common.register(fs)
+	layerIndex := fs.Int("layer-index", -1, "read FILE_PATH from the N-th layer (0-based, from the bottom) only, ignoring upper layers")
+	findDigest := fs.String("find-digest", "", "print the paths of all files whose content has the digest instead of reading FILE_PATH")
+	exists := fs.Bool("exists", false, "exit with 0 if FILE_PATH exists in the image and 1 otherwise, without printing it")
+	attribute := fs.Bool("attribute", false, "print the build step that added FILE_PATH instead of its content")
+	head := fs.Int("head", 0, "print only the first N lines of FILE_PATH, fetching only the chunks needed")
+	match := fs.String("match", "", "print only the lines of FILE_PATH matching the regular expression")
+	maxCount := fs.Int("max-count", -1, "with --match, stop after N matching lines without fetching the rest of FILE_PATH")
+	printDigest := fs.Bool("print-digest", false, "print the digest of the resolved image manifest to stderr for pinning")
+	jsonOutput := fs.Bool("json", false, "print FILE_PATH in the merged view with the image digest as JSON")
+	imageFile := fs.String("image-file", "", "read IMAGE_NAME and an optional platform from the lock file instead of the arguments")
+	explain := fs.Bool("explain", false, "print which layers provide, shadow, or white out FILE_PATH instead of its content")
+	check := fs.Bool("check", false, "exit with 0 if any layer of IMAGE_NAME is estargz and 1 otherwise, without reading any file")
+	blame := fs.Bool("blame", false, "precede the content of FILE_PATH in each layer with the build step that created the layer")
+	created := fs.Bool("created", false, "print the creation time of IMAGE_NAME instead of reading any file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ecrane [OPTIONS] IMAGE_NAME FILE_PATH")
+		fmt.Fprintln(fs.Output(), "       ecrane --image-file LOCK_FILE [OPTIONS] FILE_PATH")
+		fmt.Fprintln(fs.Output(), "       ecrane --find-digest DIGEST [OPTIONS] IMAGE_NAME")
+		fmt.Fprintln(fs.Output(), "       ecrane --check [OPTIONS] IMAGE_NAME")
+		fmt.Fprintln(fs.Output(), "       ecrane --created [OPTIONS] IMAGE_NAME")
+		fmt.Fprintln(fs.Output(), "       ecrane verify [OPTIONS] IMAGE_NAME")
+		fmt.Fprintln(fs.Output(), "       ecrane os [OPTIONS] IMAGE_NAME")
+		fmt.Fprintln(fs.Output(), "       ecrane tar [OPTIONS] IMAGE_NAME SRC_DIR")
+		fmt.Fprintln(fs.Output(), "       ecrane labels [OPTIONS] IMAGE_NAME")
+		fmt.Fprintln(fs.Output(), "       ecrane layers [OPTIONS] IMAGE_NAME")
+		fmt.Fprintln(fs.Output(), "       ecrane cost [--all] [OPTIONS] IMAGE_NAME FILE_PATH")
+		fmt.Fprintln(fs.Output(), "       ecrane grep [OPTIONS] PATTERN IMAGE_NAME [PATH_GLOB]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *findDigest != "" && fs.NArg() == 1 {
+		return withCommon(common, func(ctx context.Context, opts []remote.Option) error {
+			return findByDigest(ctx, fs.Arg(0), *findDigest, opts)
+		})
+	}
+
+	if *check && fs.NArg() == 1 {
+		return withCommon(common, func(ctx context.Context, opts []remote.Option) error {
+			return checkEStargz(ctx, fs.Arg(0), opts)
+		})
+	}
+
+	if *created && fs.NArg() == 1 {
+		return withCommon(common, func(ctx context.Context, opts []remote.Option) error {
+			return printCreated(ctx, fs.Arg(0), opts)
+		})
 	}
+
 	var (
-		imageName = args[1]
-		filePath  = args[2]
+		imageName, filePath string
+		lockOpts            []remote.Option
 	)
+	switch {
+	case *imageFile != "" && fs.NArg() == 1:
+		b, err := ioutil.ReadFile(*imageFile)
+		if err != nil {
+			return err
+		}
+		entry, err := remote.ParseLockEntry(b)
+		if err != nil {
+			return fmt.Errorf("%s: %w", *imageFile, err)
+		}
+		imageName, filePath = entry.Reference, fs.Arg(0)
+		if entry.Platform != nil {
+			lockOpts = append(lockOpts, remote.WithPlatform(*entry.Platform))
+		}
+	case *imageFile == "" && fs.NArg() == 2:
+		imageName, filePath = fs.Arg(0), fs.Arg(1)
+	default:
+		fs.Usage()
+		return exitError(exitUsage)
+	}
 
-	ctx := context.Background()
+	return withCommon(common, func(ctx context.Context, opts []remote.Option) error {
+		opts = append(opts, lockOpts...)
+		switch {
+		case *exists:
+			return checkExists(ctx, imageName, filePath, opts)
+		case *attribute:
+			return printAttribute(ctx, imageName, filePath, opts)
+		case *explain:
+			return printExplanation(ctx, imageName, filePath, opts)
+		case *match != "":
+			return printMatches(ctx, imageName, filePath, *match, *maxCount, opts)
+		case *head > 0:
+			return printHead(ctx, imageName, filePath, *head, opts)
+		case *layerIndex >= 0:
+			return readLayerFile(ctx, imageName, filePath, *layerIndex, opts)
+		case *jsonOutput:
+			return printJSON(ctx, imageName, filePath, opts)
+		}
+		return readFile(ctx, imageName, filePath, *printDigest, *blame, opts)
+	})
+}
 
-	r, err := remote.New(imageName)
+func readLayerFile(ctx context.Context, imageName, filePath string, index int, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
 	if err != nil {
 		return err
 	}
@@ -42,47 +161,303 @@ func run() error {
 	if err != nil {
 		return err
 	}
+	for _, l := range layers {
+		if l.Index() != index {
+			continue
+		}
+		var buf bytes.Buffer
+		if _, err = l.CopyFile(&buf, filePath); err != nil {
+			return err
+		}
+		fmt.Println(buf.String())
+		return nil
+	}
+	return fmt.Errorf("layer index %d out of range or not readable lazily: the image has %d readable layers", index, len(layers))
+}
 
-	var result sync.Map
-	g, ctx := errgroup.WithContext(ctx)
+func findByDigest(ctx context.Context, imageName, dgst string, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
 
-	for _, layer := range layers {
-		l := layer
-		g.Go(func() error {
-			sr := io.NewSectionReader(l, 0, l.Size())
-			esgz, err := estargz.Open(sr)
-			if err != nil {
-				return err
-			}
+	paths, err := r.FindByDigest(ctx, dgst)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		fmt.Println(p)
+	}
+	return nil
+}
 
-			if e, ok := esgz.Lookup(filePath); ok {
-				sr, err = esgz.OpenFile(e.Name)
-				if err != nil {
-					return err
-				}
+func checkExists(ctx context.Context, imageName, filePath string, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
 
-				b, err := io.ReadAll(sr)
-				if err != nil {
-					return err
-				}
+	ok, err := r.Exists(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return exitError(exitFailure)
+	}
+	return nil
+}
 
-				result.Store(layer.Digest(), b)
-			}
-			return nil
-		})
+func checkEStargz(ctx context.Context, imageName string, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	ok, err := r.IsEStargz(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return exitError(exitFailure)
+	}
+	return nil
+}
+
+func printCreated(ctx context.Context, imageName string, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	t, err := r.Created(ctx)
+	if err != nil {
+		return err
+	}
+	if t.IsZero() || t.Unix() == 0 {
+		warnings.Printf("the creation time %s is likely fixed for a reproducible build", t.UTC().Format(time.RFC3339))
 	}
+	fmt.Println(t.UTC().Format(time.RFC3339))
+	return nil
+}
 
-	if err = g.Wait(); err != nil {
+func printAttribute(ctx context.Context, imageName, filePath string, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
 		return err
 	}
 
+	index, h, err := r.Attribute(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("layer: %d\n", index)
+	fmt.Printf("added by: %s\n", h.CreatedBy)
+	return nil
+}
+
+func printExplanation(ctx context.Context, imageName, filePath string, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	ex, err := r.Explain(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	fmt.Println(ex)
+	return nil
+}
+
+func printHead(ctx context.Context, imageName, filePath string, lines int, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	b, err := r.Head(ctx, filePath, lines)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
+
+func printMatches(ctx context.Context, imageName, filePath, pattern string, maxCount int, opts []remote.Option) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid --match pattern: %w", err)
+	}
+
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	lines, err := r.ReadFileFilteredN(ctx, filePath, re, maxCount)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(os.Stdout)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
+
+// fileOutput is the output of --json.
+type fileOutput struct {
+	Image   string `json:"image"`
+	Digest  string `json:"digest"`
+	Path    string `json:"path"`
+	Content string `json:"content"`
+
+	// The layer providing the file, which files served from labels with WithLabeledFile don't have
+	Layer       *int   `json:"layer,omitempty"`
+	LayerDigest string `json:"layerDigest,omitempty"`
+	Shadowed    []int  `json:"shadowed,omitempty"`
+}
+
+func printJSON(ctx context.Context, imageName, filePath string, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	dgst, err := r.Digest()
+	if err != nil {
+		return err
+	}
+	b, err := r.ReadFile(ctx, filePath)
+	if err != nil {
+		return err
+	}
+
+	out := fileOutput{
+		Image:   imageName,
+		Digest:  dgst.String(),
+		Path:    filePath,
+		Content: string(b),
+	}
+	res, err := r.Locate(ctx, filePath)
+	if err == nil {
+		out.Layer, out.LayerDigest, out.Shadowed = &res.LayerIndex, res.LayerDigest.String(), res.Shadowed
+	} else if !errors.Is(err, remote.ErrNotFound) {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func readFile(ctx context.Context, imageName, filePath string, printDigest, blame bool, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	if printDigest {
+		dgst, err := r.Digest()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Digest: %s\n", dgst)
+	}
+
+	layers, err := r.Layers(ctx)
+	if err != nil {
+		return err
+	}
+
+	// A broken layer, e.g. with a corrupt TOC, doesn't fail the read
+	// as long as the file is found in another layer.
+	var (
+		result sync.Map
+		wg     sync.WaitGroup
+	)
+	errs := make([]error, len(layers))
+	sem := make(chan struct{}, maxConcurrency(r, len(layers)))
+	for i, layer := range layers {
+		i, l := i, layer
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = readLayer(l, filePath, &result)
+		}()
+	}
+	wg.Wait()
+
+	var found bool
+	for _, l := range layers {
+		if _, ok := result.Load(l.Digest()); ok {
+			found = true
+		}
+	}
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !found {
+			return fmt.Errorf("layer %d (%s): %w", layers[i].Index(), layers[i].Digest(), err)
+		}
+		warnings.Printf("skipped layer %d (%s): %s", layers[i].Index(), layers[i].Digest(), err)
+	}
+	if !found {
+		return fmt.Errorf("%s: %w", filePath, remote.ErrNotFound)
+	}
+
 	for i := len(layers) - 1; i >= 0; i-- {
 		v, ok := result.Load(layers[i].Digest())
 		if !ok {
 			continue
 		}
-		fmt.Println(string(v.([]byte)))
+		if blame {
+			printBlame(r, layers[i])
+		}
+		printContent(v.([]byte))
 	}
 
 	return nil
 }
+
+// printBlame prints the build step that created the layer.
+func printBlame(r remote.Remote, l *remote.Layer) {
+	h, err := r.LayerHistory(l.Index())
+	if err != nil {
+		fmt.Printf("# layer %d: unknown build step: %s\n", l.Index(), err)
+		return
+	}
+	fmt.Printf("# layer %d: %s\n", l.Index(), h.CreatedBy)
+}
+
+// readLayer stores the content of the file in the layer to result if it exists.
+func readLayer(l *remote.Layer, filePath string, result *sync.Map) error {
+	esgz, err := l.Open()
+	if err != nil {
+		return err
+	}
+
+	if e, ok := esgz.Lookup(filePath); ok {
+		var buf bytes.Buffer
+		if _, err = l.CopyFile(&buf, e.Name); err != nil {
+			return err
+		}
+
+		result.Store(l.Digest(), buf.Bytes())
+	}
+	return nil
+}
+
+// printContent prints text as is and binary as a hex dump.
+func printContent(b []byte) {
+	if s, err := remote.DecodeText(b); err == nil {
+		fmt.Println(s)
+		return
+	}
+	fmt.Print(hex.Dump(b))
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	gremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestReadFileTimeout(t *testing.T) {
+	// The registry never answers the probes resolving the redirects of blobs
+	done := make(chan struct{})
+	reg := registry.New(registry.Logger(log.New(ioutil.Discard, "", 0)))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=0-1" {
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	t.Cleanup(func() { close(done) })
+
+	blob, _, err := remotetest.BuildLayer([]remotetest.File{{Name: "etc/a", Content: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := remotetest.NewImage([][]byte{blob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := strings.TrimPrefix(s.URL, "http://") + "/test/img:latest"
+	if err = remotetest.Push(http.DefaultTransport, ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = readFile(ctx, ref, "etc/a", false, false, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %s to time out", elapsed)
+	}
+}
+
+func TestReadLayerFile(t *testing.T) {
+	ref := pushLayers(t,
+		[]remotetest.File{{Name: "etc/"}, {Name: "etc/os-release", Content: "base"}},
+		[]remotetest.File{{Name: "etc/"}, {Name: "etc/os-release", Content: "app"}},
+	)
+	for index, want := range []string{"base\n", "app\n"} {
+		got, err := captureStdout(t, func() error {
+			return readLayerFile(context.Background(), ref, "etc/os-release", index, nil)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("layer %d: got %q, want %q", index, got, want)
+		}
+	}
+
+	if _, err := captureStdout(t, func() error {
+		return readLayerFile(context.Background(), ref, "etc/os-release", 2, nil)
+	}); err == nil {
+		t.Error("expected an error for an index out of range")
+	}
+}
+
+func TestPrintDigest(t *testing.T) {
+	ref := pushLayers(t, []remotetest.File{{Name: "etc/"}, {Name: "etc/os-release", Content: "pinned"}})
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := gremote.Head(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := desc.Digest.String()
+
+	t.Run("print-digest", func(t *testing.T) {
+		var stderr string
+		stdout, err := captureStdout(t, func() error {
+			var err error
+			stderr, err = captureStderr(t, func() error {
+				return readFile(context.Background(), ref, "etc/os-release", true, false, nil)
+			})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stdout != "pinned\n" {
+			t.Errorf("got %q, want %q", stdout, "pinned\n")
+		}
+		if stderr != "Digest: "+want+"\n" {
+			t.Errorf("got %q, want the digest %s", stderr, want)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := captureStdout(t, func() error {
+			return printJSON(context.Background(), ref, "etc/os-release", nil)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got fileOutput
+		if err = json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Digest != want || got.Image != ref || got.Content != "pinned" {
+			t.Errorf("got %+v, want the digest %s", got, want)
+		}
+		if got.Layer == nil || *got.Layer != 0 || got.LayerDigest == "" || got.Shadowed != nil {
+			t.Errorf("got %+v, want the layer 0 shadowing nothing", got)
+		}
+	})
+}
+
+func TestReadFileCorruptLayer(t *testing.T) {
+	good, goodTOC := buildLayer(t, remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/os-release", Content: "healthy"})
+	corrupt, corruptTOC := buildLayer(t, remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/hostname", Content: "broken"})
+	// Cutting the footer off leaves the TOC unreadable
+	corrupt = corrupt[:len(corrupt)-10]
+	ref := pushBlobs(t, [][]byte{corrupt, good}, []string{corruptTOC, goodTOC})
+
+	var warned bytes.Buffer
+	warnings.SetOutput(&warned)
+	t.Cleanup(func() { warnings.SetOutput(os.Stderr) })
+
+	got, err := captureStdout(t, func() error {
+		return readFile(context.Background(), ref, "etc/os-release", false, false, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "healthy\n" {
+		t.Errorf("got %q, want %q", got, "healthy\n")
+	}
+	if !strings.Contains(warned.String(), "warning: skipped layer 0") {
+		t.Errorf("expected a warning about layer 0, got %q", warned.String())
+	}
+
+	// The file may be in the broken layer
+	if _, err = captureStdout(t, func() error {
+		return readFile(context.Background(), ref, "etc/hostname", false, false, nil)
+	}); err == nil || !strings.Contains(err.Error(), "layer 0") {
+		t.Errorf("expected an error of layer 0, got %v", err)
+	}
+}
+
+func TestBlame(t *testing.T) {
+	img := empty.Image
+	for _, content := range []string{"base", "app"} {
+		blob, tocDigest := buildLayer(t, remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/os-release", Content: content})
+		var err error
+		img, err = mutate.Append(img, mutate.Addendum{
+			Layer:       remotetest.RawLayer{Blob: blob, Type: types.OCILayer},
+			MediaType:   types.OCILayer,
+			Annotations: map[string]string{estargz.TOCJSONDigestAnnotation: tocDigest},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The history entries of empty layers don't shift the attribution
+	cf.History = []v1.History{
+		{CreatedBy: "ADD rootfs.tar /"},
+		{CreatedBy: "ENV APP=1", EmptyLayer: true},
+		{CreatedBy: "COPY os-release /etc/"},
+	}
+	if img, err = mutate.ConfigFile(img, cf); err != nil {
+		t.Fatal(err)
+	}
+	ref := pushImage(t, newRegistry(t), img)
+
+	got, err := captureStdout(t, func() error {
+		return readFile(context.Background(), ref, "etc/os-release", false, true, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# layer 1: COPY os-release /etc/\napp\n# layer 0: ADD rootfs.tar /\nbase\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCheckEStargz(t *testing.T) {
+	ref := pushLayers(t, []remotetest.File{{Name: "a", Content: "a"}})
+	if err := checkEStargz(context.Background(), ref, nil); err != nil {
+		t.Errorf("expected estargz, got %v", err)
+	}
+
+	plain, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref = pushImage(t, newRegistry(t), plain)
+	if err = checkEStargz(context.Background(), ref, nil); exitCode(err) != exitFailure {
+		t.Errorf("expected exit code %d, got %v", exitFailure, err)
+	}
+}
+
+func TestPrintCreated(t *testing.T) {
+	tests := []struct {
+		name     string
+		created  time.Time
+		want     string
+		wantWarn bool
+	}{
+		{name: "built", created: time.Date(2021, 7, 1, 12, 30, 0, 0, time.FixedZone("JST", 9*60*60)), want: "2021-07-01T03:30:00Z\n"},
+		{name: "epoch", created: time.Unix(0, 0), want: "1970-01-01T00:00:00Z\n", wantWarn: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := mutate.CreatedAt(empty.Image, v1.Time{Time: tt.created})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ref := pushImage(t, newRegistry(t), img)
+
+			var warned bytes.Buffer
+			warnings.SetOutput(&warned)
+			t.Cleanup(func() { warnings.SetOutput(os.Stderr) })
+			got, err := captureStdout(t, func() error {
+				return printCreated(context.Background(), ref, nil)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if (warned.Len() > 0) != tt.wantWarn {
+				t.Errorf("unexpected warnings %q", warned.String())
+			}
+		})
+	}
+}
+
+func TestPrintMatches(t *testing.T) {
+	ref := pushLayers(t, []remotetest.File{{Name: "var/"}, {Name: "var/log", Content: "info: start\nerror: disk full\ninfo: retry\nerror: again"}})
+
+	for _, tt := range []struct {
+		maxCount int
+		want     string
+	}{
+		{maxCount: -1, want: "error: disk full\nerror: again\n"},
+		{maxCount: 1, want: "error: disk full\n"},
+	} {
+		got, err := captureStdout(t, func() error {
+			return printMatches(context.Background(), ref, "var/log", "^error", tt.maxCount, nil)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("max count %d: got %q, want %q", tt.maxCount, got, tt.want)
+		}
+	}
+
+	if _, err := captureStdout(t, func() error {
+		return printMatches(context.Background(), ref, "var/log", "(", -1, nil)
+	}); err == nil || !strings.Contains(err.Error(), "invalid --match pattern") {
+		t.Errorf("expected an error for an invalid pattern, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+// osReleasePaths are the paths of os-release in the order of precedence defined by os-release(5).
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+func runOS(args []string) error {
+	var common commonFlags
+	fs := flag.NewFlagSet("ecrane os", flag.ExitOnError)
+	common.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ecrane os [OPTIONS] IMAGE_NAME")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError(exitUsage)
+	}
+
+	return withCommon(common, func(ctx context.Context, opts []remote.Option) error {
+		return printOS(ctx, fs.Arg(0), opts)
+	})
+}
+
+func printOS(ctx context.Context, imageName string, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	b, err := readOSRelease(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	release := parseOSRelease(b)
+	fmt.Printf("ID: %s\n", release["ID"])
+	fmt.Printf("VERSION_ID: %s\n", release["VERSION_ID"])
+	fmt.Printf("PRETTY_NAME: %s\n", release["PRETTY_NAME"])
+	return nil
+}
+
+// readOSRelease returns the content of the first os-release found in the image.
+func readOSRelease(ctx context.Context, r remote.Remote) ([]byte, error) {
+	for _, p := range osReleasePaths {
+		b, err := r.ReadFile(ctx, p)
+		if err == nil {
+			return b, nil
+		}
+		// /etc/os-release is usually a symlink to /usr/lib/os-release, which can't be read as a regular file
+		if !errors.Is(err, remote.ErrNotFound) && !strings.Contains(err.Error(), "not a regular file") {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("no os-release in the image: it may be a distroless or scratch image")
+}
+
+// parseOSRelease parses the newline-separated KEY=VALUE assignments of os-release.
+// Values may be quoted as in shell.
+func parseOSRelease(b []byte) map[string]string {
+	release := map[string]string{}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		key, value := line[:i], line[i+1:]
+		if v, err := strconv.Unquote(value); err == nil {
+			value = v
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		release[key] = value
+	}
+	return release
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+const alpineOSRelease = `NAME="Alpine Linux"
+ID=alpine
+VERSION_ID=3.14.2
+PRETTY_NAME="Alpine Linux v3.14"
+HOME_URL="https://alpinelinux.org/"
+`
+
+func TestPrintOS(t *testing.T) {
+	const want = "ID: alpine\nVERSION_ID: 3.14.2\nPRETTY_NAME: Alpine Linux v3.14\n"
+	tests := []struct {
+		name    string
+		files   []remotetest.File
+		wantErr bool
+	}{
+		{
+			name:  "etc",
+			files: []remotetest.File{{Name: "etc/"}, {Name: "etc/os-release", Content: alpineOSRelease}},
+		},
+		{
+			name: "usr lib",
+			files: []remotetest.File{
+				{Name: "usr/"}, {Name: "usr/lib/"}, {Name: "usr/lib/os-release", Content: alpineOSRelease},
+			},
+		},
+		{
+			name:    "scratch",
+			files:   []remotetest.File{{Name: "app", Content: "binary"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := pushLayers(t, tt.files)
+			out, err := captureStdout(t, func() error {
+				return printOS(context.Background(), ref, nil)
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != want {
+				t.Errorf("got %q, want %q", out, want)
+			}
+		})
+	}
+}
+
+func TestParseOSRelease(t *testing.T) {
+	got := parseOSRelease([]byte("# comment\n\nID=debian\nVERSION_ID='11'\nPRETTY_NAME=\"Debian GNU/Linux 11 (bullseye)\"\ninvalid\n"))
+	want := map[string]string{"ID": "debian", "VERSION_ID": "11", "PRETTY_NAME": "Debian GNU/Linux 11 (bullseye)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// progressMinSize is the smallest operation to render a progress bar for, so that small files don't flicker.
+	progressMinSize = 1 << 20
+
+	progressWidth = 40
+)
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar renders the progress reported by remote.WithProgress to w on a single line.
+type progressBar struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (b *progressBar) update(done, total int64) {
+	if total < progressMinSize {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := int(done * progressWidth / total)
+	fmt.Fprintf(b.w, "\r[%s%s] %3d%% %s/%s", strings.Repeat("=", n), strings.Repeat(" ", progressWidth-n),
+		done*100/total, humanSize(done), humanSize(total))
+	if done >= total {
+		fmt.Fprintln(b.w)
+	}
+}
+
+// humanSize formats n bytes in binary units, e.g. 1.5MiB.
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
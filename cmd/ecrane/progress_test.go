@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProgressBar(t *testing.T) {
+	var buf bytes.Buffer
+	bar := &progressBar{w: &buf}
+
+	bar.update(10, progressMinSize-1)
+	if buf.Len() != 0 {
+		t.Errorf("expected no bar for a small operation, got %q", buf.String())
+	}
+
+	bar.update(1<<20, 2<<20)
+	if got, want := buf.String(), "\r["+strings.Repeat("=", 20)+strings.Repeat(" ", 20)+"]  50% 1.0MiB/2.0MiB"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	buf.Reset()
+	bar.update(2<<20, 2<<20)
+	if got, want := buf.String(), "\r["+strings.Repeat("=", 40)+"] 100% 2.0MiB/2.0MiB\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:               "0B",
+		1023:            "1023B",
+		1536:            "1.5KiB",
+		5 << 20:         "5.0MiB",
+		3<<30 + 512<<20: "3.5GiB",
+	} {
+		if got := humanSize(n); got != want {
+			t.Errorf("humanSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
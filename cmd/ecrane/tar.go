@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+func runTar(args []string) error {
+	var common commonFlags
+	fs := flag.NewFlagSet("ecrane tar", flag.ExitOnError)
+	common.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ecrane tar [OPTIONS] IMAGE_NAME SRC_DIR")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitError(exitUsage)
+	}
+
+	return withCommon(common, func(ctx context.Context, opts []remote.Option) error {
+		return writeTar(ctx, fs.Arg(0), fs.Arg(1), opts)
+	})
+}
+
+func writeTar(ctx context.Context, imageName, dir string, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if err = r.WriteTar(ctx, w, dir); err != nil {
+		return err
+	}
+	return w.Flush()
+}
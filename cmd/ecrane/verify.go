@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sync"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+func runVerify(args []string) error {
+	var common commonFlags
+	fs := flag.NewFlagSet("ecrane verify", flag.ExitOnError)
+	common.register(fs)
+	deep := fs.Bool("deep", false, "also download and decompress files to verify their chunk digests, which is as slow as reading them")
+	fraction := fs.Float64("deep-fraction", 1, "fraction of files whose chunks are verified with --deep")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ecrane verify [OPTIONS] IMAGE_NAME")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError(exitUsage)
+	}
+	if *fraction < 0 || *fraction > 1 {
+		return fmt.Errorf("--deep-fraction must be between 0 and 1: %v", *fraction)
+	}
+	if !*deep {
+		*fraction = 0
+	}
+
+	return withCommon(common, func(ctx context.Context, opts []remote.Option) error {
+		return verify(ctx, fs.Arg(0), *fraction, opts)
+	})
+}
+
+func verify(ctx context.Context, imageName string, fraction float64, opts []remote.Option) error {
+	r, err := openImage(ctx, imageName, opts)
+	if err != nil {
+		return err
+	}
+
+	layers, err := r.Layers(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Verify all layers even if some of them fail so that every failure is reported.
+	errs := make([]error, len(layers))
+	sem := make(chan struct{}, maxConcurrency(r, len(layers)))
+	var wg sync.WaitGroup
+	for i, layer := range layers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, l *remote.Layer) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = verifyLayer(ctx, l, fraction)
+		}(i, layer)
+	}
+	wg.Wait()
+
+	var failed int
+	for i, l := range layers {
+		if errs[i] != nil {
+			failed++
+			fmt.Printf("%s\tFAIL\t%s\n", l.Digest(), errs[i])
+			continue
+		}
+		fmt.Printf("%s\tOK\n", l.Digest())
+	}
+	fmt.Printf("%d/%d layers verified\n", len(layers)-failed, len(layers))
+
+	if failed > 0 {
+		return fmt.Errorf("verification failed for %d layers", failed)
+	}
+	return nil
+}
+
+// verifyLayer verifies the TOC of the layer and chunks of the given fraction of files.
+func verifyLayer(ctx context.Context, l *remote.Layer, fraction float64) error {
+	v, err := l.VerifyTOC()
+	if err != nil {
+		return err
+	}
+	if fraction == 0 {
+		return nil
+	}
+
+	entries, err := l.TOC(ctx)
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, e := range entries {
+		if e.Type == "reg" && e.Size > 0 {
+			files = append(files, e.Name)
+		}
+	}
+
+	// Pick files evenly so that the result is deterministic.
+	for i, name := range files {
+		if int(float64(i+1)*fraction) == int(float64(i)*fraction) {
+			continue
+		}
+		if err = l.VerifyFile(v, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
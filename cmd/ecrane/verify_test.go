@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// tamper flips a byte in the compressed content of the named file in the estargz blob.
+func tamper(t *testing.T, blob []byte, name string) []byte {
+	t.Helper()
+	r, err := estargz.Open(io.NewSectionReader(bytes.NewReader(blob), 0, int64(len(blob))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := r.Lookup(name)
+	if !ok {
+		t.Fatalf("%s not found", name)
+	}
+	tampered := append([]byte(nil), blob...)
+	// Skip the gzip header of the chunk
+	tampered[e.Offset+12] ^= 0xff
+	return tampered
+}
+
+func TestVerify(t *testing.T) {
+	files := []remotetest.File{{Name: "etc/"}, {Name: "etc/a", Content: strings.Repeat("verified content\n", 10)}}
+	good, goodTOC := buildLayer(t, files...)
+	other, otherTOC := buildLayer(t, remotetest.File{Name: "b", Content: "other"})
+
+	tests := []struct {
+		name       string
+		blobs      [][]byte
+		tocDigests []string
+		fraction   float64
+		wantErr    string
+		wantOut    string
+	}{
+		{
+			name:       "clean",
+			blobs:      [][]byte{good, other},
+			tocDigests: []string{goodTOC, otherTOC},
+			fraction:   1,
+			wantOut:    "2/2 layers verified\n",
+		},
+		{
+			name:       "tampered chunk",
+			blobs:      [][]byte{tamper(t, good, "etc/a"), other},
+			tocDigests: []string{goodTOC, otherTOC},
+			fraction:   1,
+			wantErr:    "verification failed for 1 layers",
+			wantOut:    "1/2 layers verified\n",
+		},
+		{
+			name:       "tampered chunk without --deep",
+			blobs:      [][]byte{tamper(t, good, "etc/a"), other},
+			tocDigests: []string{goodTOC, otherTOC},
+			wantOut:    "2/2 layers verified\n",
+		},
+		{
+			name:       "TOC digest mismatch",
+			blobs:      [][]byte{good, other},
+			tocDigests: []string{otherTOC, otherTOC},
+			wantErr:    "verification failed for 1 layers",
+			wantOut:    "1/2 layers verified\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := pushBlobs(t, tt.blobs, tt.tocDigests)
+			out, err := captureStdout(t, func() error {
+				return verify(context.Background(), ref, tt.fraction, nil)
+			})
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			} else if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("got %v, want %q", err, tt.wantErr)
+			}
+			if !strings.HasSuffix(out, tt.wantOut) {
+				t.Errorf("unexpected output %q", out)
+			}
+			if tt.wantErr != "" && !strings.Contains(out, "\tFAIL\t") {
+				t.Errorf("no failed layer in the output %q", out)
+			}
+		})
+	}
+}
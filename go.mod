@@ -3,7 +3,13 @@ module github.com/knqyf263/stargz-registry
 go 1.16
 
 require (
-	github.com/containerd/stargz-snapshotter/estargz v0.4.1
+	github.com/aws/aws-sdk-go v1.38.35
+	github.com/containerd/containerd v1.3.0
+	github.com/containerd/stargz-snapshotter/estargz v0.8.0
+	github.com/docker/cli v0.0.0-20191017083524-a8ff7f821017
 	github.com/google/go-containerregistry v0.5.1
+	github.com/opencontainers/go-digest v1.0.0
+	github.com/opencontainers/image-spec v1.0.1
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	golang.org/x/sync v0.0.0-20201207232520-09787c993a3a
 )
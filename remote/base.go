@@ -0,0 +1,60 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Annotations of the manifest recording the base image, set by e.g. BuildKit.
+const (
+	baseNameAnnotation   = "org.opencontainers.image.base.name"
+	baseDigestAnnotation = "org.opencontainers.image.base.digest"
+)
+
+// BaseReference returns the reference of the base image recorded in the org.opencontainers.image.base.name
+// annotation of the manifest, pinned by org.opencontainers.image.base.digest if it's also recorded.
+// It returns false if the image has no base annotation or it's invalid.
+func (r Remote) BaseReference() (name.Reference, bool) {
+	manifest, err := r.image.Manifest()
+	if err != nil {
+		return nil, false
+	}
+	baseName, ok := manifest.Annotations[baseNameAnnotation]
+	if !ok {
+		return nil, false
+	}
+	ref, err := parseReference(baseName)
+	if err != nil {
+		return nil, false
+	}
+
+	if dgst, ok := manifest.Annotations[baseDigestAnnotation]; ok {
+		d, err := name.NewDigest(ref.Context().Name() + "@" + dgst)
+		if err != nil {
+			return nil, false
+		}
+		return d, true
+	}
+	return ref, true
+}
+
+// Base opens the base image returned by BaseReference with the options.
+// It returns an error wrapping ErrNotFound if the image has no base annotation.
+func (r Remote) Base(ctx context.Context, opts ...Option) (Remote, error) {
+	ref, ok := r.BaseReference()
+	if !ok {
+		return Remote{}, fmt.Errorf("base image of %s: %w", r.ref, ErrNotFound)
+	}
+	return open(ctx, ref.String(), opts...)
+}
+
+// ReadBaseFile reads the file at the path in the merged view of the base image, e.g. to compare it with the image.
+func (r Remote) ReadBaseFile(ctx context.Context, p string, opts ...Option) ([]byte, error) {
+	base, err := r.Base(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return base.ReadFile(ctx, p)
+}
@@ -0,0 +1,122 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// annotatedImage is the image with the annotations in its manifest.
+type annotatedImage struct {
+	v1.Image
+	annotations map[string]string
+}
+
+func (i annotatedImage) Manifest() (*v1.Manifest, error) {
+	m, err := i.Image.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	annotated := *m
+	annotated.Annotations = i.annotations
+	return &annotated, nil
+}
+
+func (i annotatedImage) RawManifest() ([]byte, error) {
+	m, err := i.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+func (i annotatedImage) Digest() (v1.Hash, error) {
+	b, err := i.RawManifest()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	h, _, err := v1.SHA256(bytes.NewReader(b))
+	return h, err
+}
+
+func (i annotatedImage) Size() (int64, error) {
+	b, err := i.RawManifest()
+	return int64(len(b)), err
+}
+
+func TestBaseReference(t *testing.T) {
+	tr := remotetest.NewTransport()
+	const baseRef = "registry.test/base/image:v1"
+	base, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/os-release", Content: "base"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = remotetest.Push(tr, baseRef, base); err != nil {
+		t.Fatal(err)
+	}
+	baseDigest, err := base.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/os-release", Content: "app"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        string // the base reference, or "" if none
+	}{
+		{
+			name:        "pinned",
+			annotations: map[string]string{"org.opencontainers.image.base.name": baseRef, "org.opencontainers.image.base.digest": baseDigest.String()},
+			want:        "registry.test/base/image@" + baseDigest.String(),
+		},
+		{
+			name:        "name only",
+			annotations: map[string]string{"org.opencontainers.image.base.name": baseRef},
+			want:        baseRef,
+		},
+		{name: "no annotations"},
+		{
+			name:        "invalid digest",
+			annotations: map[string]string{"org.opencontainers.image.base.name": baseRef, "org.opencontainers.image.base.digest": "sha256:invalid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := remotetest.Push(tr, remotetest.Reference, annotatedImage{Image: app, annotations: tt.annotations}); err != nil {
+				t.Fatal(err)
+			}
+			r := remotetest.Open(t, tr)
+			ref, ok := r.BaseReference()
+			if tt.want == "" {
+				if ok {
+					t.Errorf("expected no base reference, got %s", ref)
+				}
+				if _, err := r.ReadBaseFile(context.Background(), "etc/os-release", remote.WithTransport(tr)); !errors.Is(err, remote.ErrNotFound) {
+					t.Errorf("expected ErrNotFound, got %v", err)
+				}
+				return
+			}
+			if !ok || ref.String() != tt.want {
+				t.Fatalf("got %v, want %s", ref, tt.want)
+			}
+			b, err := r.ReadBaseFile(context.Background(), "etc/os-release", remote.WithTransport(tr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "base" {
+				t.Errorf("got %q from the base image", b)
+			}
+		})
+	}
+}
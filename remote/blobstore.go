@@ -0,0 +1,55 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// BlobStore provides blobs stored locally, e.g. in the content store of containerd.
+type BlobStore interface {
+	// ReaderAt returns the reader of the blob described by desc.
+	// It returns an error wrapping ErrNotFound if the blob isn't stored.
+	ReaderAt(ctx context.Context, desc v1.Descriptor) (BlobReaderAt, error)
+}
+
+// BlobReaderAt reads a locally stored blob. It has the same methods as content.ReaderAt of containerd.
+type BlobReaderAt interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+// localBlob returns the reader of the blob in the blob store, or nil if it isn't stored there.
+func (l *Layer) localBlob() (io.ReaderAt, error) {
+	if l.blobStore == nil {
+		return nil, nil
+	}
+	l.localOnce.Do(func() {
+		desc := v1.Descriptor{
+			MediaType:   l.mediaType,
+			Size:        l.size,
+			Digest:      l.digest,
+			Annotations: l.annotations,
+		}
+		ra, err := l.blobStore.ReaderAt(l.ctx, desc)
+		if errors.Is(err, ErrNotFound) {
+			return
+		} else if err != nil {
+			l.localErr = err
+			return
+		}
+		// A truncated blob, e.g. one still being written, is read from the registry.
+		if ra.Size() != l.size {
+			ra.Close()
+			return
+		}
+		l.local = ra
+	})
+	if l.local == nil {
+		return nil, l.localErr
+	}
+	return l.local, nil
+}
@@ -0,0 +1,36 @@
+package remote
+
+import "io"
+
+// exactReader reads exactly n bytes of the response body. Responses without Content-Length,
+// e.g. chunked ones, may end early or carry more bytes than requested:
+// a premature end is reported as io.ErrUnexpectedEOF and trailing bytes are ignored.
+type exactReader struct {
+	rc     io.ReadCloser
+	remain int64
+}
+
+func newExactReader(rc io.ReadCloser, n int64) io.ReadCloser {
+	return &exactReader{rc: rc, remain: n}
+}
+
+func (r *exactReader) Read(p []byte) (int, error) {
+	if r.remain <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remain {
+		p = p[:r.remain]
+	}
+	n, err := r.rc.Read(p)
+	r.remain -= int64(n)
+	if err == io.EOF && r.remain > 0 {
+		err = io.ErrUnexpectedEOF
+	} else if err == nil && r.remain == 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *exactReader) Close() error {
+	return r.rc.Close()
+}
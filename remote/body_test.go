@@ -0,0 +1,109 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// chunkedRanges responds to range requests with chunked transfer encoding and without Content-Length,
+// replacing the body of partial content by edit.
+func chunkedRanges(edit func([]byte) []byte) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isBlobRange(r) || isProbe(r) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code == http.StatusOK {
+				// The registry ignores the range
+				blob := rec.Body.Bytes()
+				rec = httptest.NewRecorder()
+				http.ServeContent(rec, r, "", time.Time{}, bytes.NewReader(blob))
+			}
+			body := rec.Body.Bytes()
+			if rec.Code == http.StatusPartialContent {
+				body = edit(body)
+			}
+			for k, v := range rec.Header() {
+				if k != "Content-Length" {
+					w.Header()[k] = v
+				}
+			}
+			w.WriteHeader(rec.Code)
+			// Flushing before the end makes the response chunked
+			for len(body) > 0 {
+				n := 100
+				if n > len(body) {
+					n = len(body)
+				}
+				w.Write(body[:n])
+				w.(http.Flusher).Flush()
+				body = body[n:]
+			}
+		})
+	}
+}
+
+func TestChunkedRangeResponse(t *testing.T) {
+	content := strings.Repeat("chunked transfer encoding\n", 200)
+	blob := remotetest.Layer(t, 1000, remotetest.File{Name: "a", Content: content})
+
+	t.Run("trailing bytes", func(t *testing.T) {
+		srv := serveImage(t, chunkedRanges(func(b []byte) []byte {
+			return append(b, "garbage after the range"...)
+		}), blob)
+		r, err := remote.New(srv.Listener.Addr().String() + "/test/image:latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := r.ReadFile(context.Background(), "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("unexpected content of %d bytes", len(b))
+		}
+
+		// Reading ranges to the end must not take the trailing bytes
+		var buf bytes.Buffer
+		if _, err = layersOf(t, r)[0].Download(context.Background(), &buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), blob) {
+			t.Errorf("downloaded %d bytes, want %d", buf.Len(), len(blob))
+		}
+		r, err = remote.New(srv.Listener.Addr().String()+"/test/image:latest", remote.WithTOCSpill(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := layersOf(t, r)[0]
+		defer l.Close()
+		if _, err = l.Open(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("premature end", func(t *testing.T) {
+		srv := serveImage(t, chunkedRanges(func(b []byte) []byte {
+			return b[:len(b)/2]
+		}), blob)
+		r, err := remote.New(srv.Listener.Addr().String()+"/test/image:latest", remote.WithRetry(1, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = r.ReadFile(context.Background(), "a")
+		if err == nil || !strings.Contains(err.Error(), "unexpected EOF") {
+			t.Errorf("expected unexpected EOF, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// ErrRequestBudgetExceeded is returned when reading needs more requests than allowed by WithMaxRequests.
+var ErrRequestBudgetExceeded = errors.New("request budget exceeded")
+
+// requestBudget counts the blob requests issued by the layers returned by a Layers call.
+type requestBudget struct {
+	max  int64
+	used int64 // accessed atomically
+}
+
+func (b *requestBudget) take() error {
+	if atomic.AddInt64(&b.used, 1) > b.max {
+		return fmt.Errorf("more than %d requests: %w", b.max, ErrRequestBudgetExceeded)
+	}
+	return nil
+}
+
+// wrap makes err match ErrRequestBudgetExceeded if the budget is spent.
+// estargz doesn't wrap errors of ReadAt, which would otherwise hide the cause of failed reads.
+func (b *requestBudget) wrap(err error) error {
+	if err == nil || b == nil || atomic.LoadInt64(&b.used) <= b.max || errors.Is(err, ErrRequestBudgetExceeded) {
+		return err
+	}
+	return &budgetError{err: err}
+}
+
+// budgetError is an error caused by the spent budget.
+type budgetError struct {
+	err error
+}
+
+func (e *budgetError) Error() string {
+	return e.err.Error()
+}
+
+func (e *budgetError) Is(target error) bool {
+	return target == ErrRequestBudgetExceeded
+}
+
+func (e *budgetError) Unwrap() error {
+	return e.err
+}
+
+// budgetTransport fails requests once the budget is spent.
+type budgetTransport struct {
+	inner  http.RoundTripper
+	budget *requestBudget
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.budget.take(); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.inner.RoundTrip(req)
+}
@@ -0,0 +1,40 @@
+package remote
+
+import (
+	"fmt"
+	"sync"
+)
+
+// maxPooledBuffer is the largest buffer kept in the pool.
+// Chunks are 4 MiB at most by default, while a file without chunks may be much larger.
+const maxPooledBuffer = 8 << 20
+
+// bufPool holds the buffers of chunks and ranges which are used only during a call,
+// so that many concurrent reads don't allocate a buffer for each of them.
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+// getBuffer returns a buffer of n bytes from the pool. Its content is undefined.
+// It must be returned by putBuffer once the call using it returns and must not be retained after that.
+func getBuffer(n int64) (*[]byte, error) {
+	if n < 0 || n > maxInt {
+		return nil, fmt.Errorf("cannot allocate %d bytes on this platform", n)
+	}
+	bp := bufPool.Get().(*[]byte)
+	if int64(cap(*bp)) < n {
+		*bp = make([]byte, n)
+	}
+	*bp = (*bp)[:n]
+	return bp, nil
+}
+
+// putBuffer returns the buffer to the pool unless it's too large to keep.
+func putBuffer(bp *[]byte) {
+	if cap(*bp) > maxPooledBuffer {
+		return
+	}
+	bufPool.Put(bp)
+}
@@ -0,0 +1,47 @@
+package remote
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetBuffer(t *testing.T) {
+	for _, n := range []int64{0, 1, 4096, 1, maxPooledBuffer + 1} {
+		bp, err := getBuffer(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(*bp)) != n {
+			t.Errorf("got %d bytes, want %d", len(*bp), n)
+		}
+		putBuffer(bp)
+	}
+	if _, err := getBuffer(-1); err == nil {
+		t.Error("expected an error for a negative size")
+	}
+}
+
+// sink keeps the buffers of the benchmark from being allocated on the stack,
+// as those of a read are passed to a reader and escape.
+var sink []byte
+
+func BenchmarkBuffer(b *testing.B) {
+	const n = 64 << 10
+	for _, pooled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pooled=%v", pooled), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if !pooled {
+					sink = make([]byte, n)
+					continue
+				}
+				bp, err := getBuffer(n)
+				if err != nil {
+					b.Fatal(err)
+				}
+				sink = *bp
+				putBuffer(bp)
+			}
+		})
+	}
+}
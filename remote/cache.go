@@ -0,0 +1,144 @@
+package remote
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// defaultChunkCacheMaxBytes is the default size cap of the chunk cache.
+// It holds a blob kept whole by keepFullBlob with the default limit.
+const defaultChunkCacheMaxBytes = 256 << 20
+
+// chunkCache holds blob ranges fetched from the registry, keyed by layer digest.
+// The least recently used ranges are evicted when they exceed maxBytes.
+type chunkCache struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	spans map[v1.Hash][]*span // sorted by offset
+	ll    *list.List          // *span, the front is the most recently used
+	size  int64
+}
+
+type span struct {
+	digest v1.Hash
+	offset int64
+	data   []byte
+	elem   *list.Element
+}
+
+func (s *span) end() int64 {
+	return s.offset + int64(len(s.data))
+}
+
+func newChunkCache(maxBytes int64) *chunkCache {
+	return &chunkCache{maxBytes: maxBytes, spans: map[v1.Hash][]*span{}, ll: list.New()}
+}
+
+// get fills p with the cached bytes starting at offset.
+// The range may be served from several adjacent or overlapping spans.
+// It returns false unless the whole range is cached, in which case p may be partially overwritten.
+func (c *chunkCache) get(dgst v1.Hash, p []byte, offset int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cover(dgst, offset, offset+int64(len(p)), func(s *span, begin, end int64) {
+		copy(p[begin-offset:end-offset], s.data[begin-s.offset:end-s.offset])
+	})
+}
+
+func (c *chunkCache) add(dgst v1.Hash, offset int64, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := &span{digest: dgst, offset: offset, data: data}
+	spans := c.spans[dgst]
+	i := sort.Search(len(spans), func(i int) bool { return spans[i].offset > offset })
+	spans = append(spans, nil)
+	copy(spans[i+1:], spans[i:])
+	spans[i] = s
+	c.spans[dgst] = spans
+	s.elem = c.ll.PushFront(s)
+	c.size += int64(len(data))
+
+	for c.maxBytes > 0 && c.size > c.maxBytes && c.ll.Len() > 1 {
+		c.remove(c.ll.Back().Value.(*span))
+	}
+}
+
+// remove removes the span from the cache.
+func (c *chunkCache) remove(s *span) {
+	c.ll.Remove(s.elem)
+	c.size -= int64(len(s.data))
+
+	spans := c.spans[s.digest]
+	for i := range spans {
+		if spans[i] == s {
+			spans = append(spans[:i], spans[i+1:]...)
+			break
+		}
+	}
+	if len(spans) == 0 {
+		delete(c.spans, s.digest)
+	} else {
+		c.spans[s.digest] = spans
+	}
+}
+
+// has reports whether the whole range is cached.
+func (c *chunkCache) has(dgst v1.Hash, offset, length int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cover(dgst, offset, offset+length, func(*span, int64, int64) {})
+}
+
+// cover calls fn with the spans covering [begin, end) and the part each of them covers, in order,
+// and marks them used. It returns false if there is a gap, in which case they aren't marked.
+// It must be called with c.mu held.
+func (c *chunkCache) cover(dgst v1.Hash, begin, end int64, fn func(s *span, begin, end int64)) bool {
+	var used []*span
+	pos := begin
+	for _, s := range c.spans[dgst] {
+		if pos >= end {
+			break
+		}
+		if s.offset > pos {
+			return false
+		}
+		if s.end() <= pos {
+			continue
+		}
+		partEnd := s.end()
+		if partEnd > end {
+			partEnd = end
+		}
+		fn(s, pos, partEnd)
+		used = append(used, s)
+		pos = partEnd
+	}
+	if pos < end {
+		return false
+	}
+	for _, s := range used {
+		c.ll.MoveToFront(s.elem)
+	}
+	return true
+}
+
+// whole returns the cached blob if a span covers all the size bytes, or nil.
+func (c *chunkCache) whole(dgst v1.Hash, size int64) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.spans[dgst] {
+		if s.offset == 0 && int64(len(s.data)) >= size {
+			c.ll.MoveToFront(s.elem)
+			return s.data
+		}
+	}
+	return nil
+}
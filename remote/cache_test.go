@@ -0,0 +1,86 @@
+package remote
+
+import (
+	"bytes"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+var testDigest = v1.Hash{Algorithm: "sha256", Hex: "0000000000000000000000000000000000000000000000000000000000000000"}
+
+func TestChunkCacheAdjacentSpans(t *testing.T) {
+	c := newChunkCache(0)
+	c.add(testDigest, 10, []byte("0123456789"))
+	c.add(testDigest, 0, []byte("abcdefghij"))
+	c.add(testDigest, 15, []byte("56789KLMNO")) // overlaps the first one
+
+	tests := []struct {
+		offset int64
+		length int
+		want   string
+	}{
+		{offset: 0, length: 10, want: "abcdefghij"},
+		{offset: 5, length: 10, want: "fghij01234"},
+		{offset: 8, length: 17, want: "ij0123456789KLMNO"},
+		{offset: 0, length: 25, want: "abcdefghij0123456789KLMNO"},
+	}
+	for _, tt := range tests {
+		p := make([]byte, tt.length)
+		if !c.get(testDigest, p, tt.offset) {
+			t.Errorf("%d+%d: not cached", tt.offset, tt.length)
+			continue
+		}
+		if string(p) != tt.want {
+			t.Errorf("%d+%d: got %q, want %q", tt.offset, tt.length, p, tt.want)
+		}
+		if !c.has(testDigest, tt.offset, int64(tt.length)) {
+			t.Errorf("%d+%d: has() = false", tt.offset, tt.length)
+		}
+	}
+
+	for _, rng := range []struct{ offset, length int64 }{{20, 10}, {24, 2}, {30, 1}} {
+		if c.get(testDigest, make([]byte, rng.length), rng.offset) || c.has(testDigest, rng.offset, rng.length) {
+			t.Errorf("%d+%d: cached", rng.offset, rng.length)
+		}
+	}
+
+	// Gaps aren't filled
+	c = newChunkCache(0)
+	c.add(testDigest, 0, []byte("abc"))
+	c.add(testDigest, 4, []byte("efg"))
+	if c.has(testDigest, 0, 7) {
+		t.Error("the gap is cached")
+	}
+}
+
+func TestChunkCacheEviction(t *testing.T) {
+	c := newChunkCache(20)
+	c.add(testDigest, 0, bytes.Repeat([]byte("a"), 10))
+	c.add(testDigest, 10, bytes.Repeat([]byte("b"), 10))
+
+	// Use the first span so that the second one is the least recently used
+	if !c.has(testDigest, 0, 10) {
+		t.Fatal("not cached")
+	}
+	c.add(testDigest, 20, bytes.Repeat([]byte("c"), 10))
+
+	if c.size != 20 {
+		t.Errorf("unexpected size %d", c.size)
+	}
+	if !c.has(testDigest, 0, 10) || !c.has(testDigest, 20, 10) {
+		t.Error("recently used spans are evicted")
+	}
+	if c.has(testDigest, 10, 10) {
+		t.Error("the least recently used span isn't evicted")
+	}
+
+	// A span larger than the cap replaces everything
+	c.add(testDigest, 30, bytes.Repeat([]byte("d"), 30))
+	if c.ll.Len() != 1 || c.size != 30 {
+		t.Errorf("unexpected cache of %d spans and %d bytes", c.ll.Len(), c.size)
+	}
+	if len(c.spans) != 1 || len(c.spans[testDigest]) != 1 {
+		t.Errorf("evicted spans are left in the index: %v", c.spans)
+	}
+}
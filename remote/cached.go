@@ -0,0 +1,69 @@
+package remote
+
+import (
+	"context"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// maxGzipRead is the maximum size estargz reads at once to decompress a chunk.
+const maxGzipRead = 2 << 20
+
+// IsCached reports whether the file at the path in the merged view can be read without accessing the registry.
+// Resolving the merged view itself may access the registry unless the TOCs are cached.
+func (r Remote) IsCached(ctx context.Context, p string) (bool, error) {
+	l, e, err := r.Find(ctx, p)
+	if err != nil {
+		return false, err
+	}
+	return l.IsCached(e.Name), nil
+}
+
+// IsCached reports whether every chunk of the named file is in the memory or the disk cache.
+func (l *Layer) IsCached(name string) bool {
+	esgz, err := l.Open()
+	if err != nil {
+		return false
+	}
+	e, ok := esgz.Lookup(name)
+	if !ok || e.Type != "reg" {
+		return false
+	}
+	if l.gzipIndex != nil {
+		// The whole layer is in the index
+		return true
+	}
+
+	for _, rng := range fileRanges(esgz, e) {
+		if l.cache.has(l.digest, rng.begin, rng.end-rng.begin) {
+			continue
+		}
+		if l.diskCache != nil && l.diskCache.has(l.digest, rng.begin, int(rng.end-rng.begin)) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// fileRanges returns the blob ranges read to decompress every chunk of the file.
+// It follows how estargz reads a chunk: from the beginning of the chunk
+// up to maxGzipRead bytes or the end of the last chunk of the file.
+func fileRanges(esgz *estargz.Reader, e *estargz.TOCEntry) []byteRange {
+	if e.Size == 0 {
+		return nil
+	}
+
+	chunks := chunksOf(esgz, e)
+	last := chunks[len(chunks)-1].NextOffset()
+
+	var ranges []byteRange
+	for _, ce := range chunks {
+		end := last
+		if end-ce.Offset > maxGzipRead {
+			end = ce.Offset + maxGzipRead
+		}
+		ranges = append(ranges, byteRange{begin: ce.Offset, end: end})
+	}
+	return ranges
+}
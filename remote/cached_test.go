@@ -0,0 +1,35 @@
+package remote_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestIsCached(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0,
+		remotetest.File{Name: "warm", Content: "read before"},
+		remotetest.File{Name: "cold", Content: "never read"},
+	))
+	r := remotetest.Open(t, tr, remote.WithDiskCache(t.TempDir()))
+	ctx := context.Background()
+
+	if _, err := r.ReadFile(ctx, "warm"); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{"warm": true, "cold": false} {
+		got, err := r.IsCached(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+	if _, err := r.IsCached(ctx, "missing"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
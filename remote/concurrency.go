@@ -0,0 +1,31 @@
+package remote
+
+// semaphore bounds the number of layers processed at the same time by an operation.
+// A nil semaphore doesn't bound them.
+type semaphore chan struct{}
+
+// newSemaphore returns a semaphore admitting n at a time, or nil if n is not positive.
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+func (s semaphore) acquire() {
+	if s != nil {
+		s <- struct{}{}
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// MaxConcurrency returns the limit set by WithMaxConcurrency, or 0 if the layers are processed all at once.
+// Callers processing the layers on their own can bound themselves with it.
+func (r Remote) MaxConcurrency() int {
+	return r.opts.maxConcurrency
+}
@@ -0,0 +1,105 @@
+package remote_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// inflightTransport records the largest number of blob range requests in flight at the same time.
+// Each of them is delayed so that concurrent ones overlap.
+type inflightTransport struct {
+	inner http.RoundTripper
+
+	mu       sync.Mutex
+	cur, max int
+}
+
+func (t *inflightTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isBlobRange(req) {
+		return t.inner.RoundTrip(req)
+	}
+	t.mu.Lock()
+	t.cur++
+	if t.cur > t.max {
+		t.max = t.cur
+	}
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.cur--
+		t.mu.Unlock()
+	}()
+	time.Sleep(5 * time.Millisecond)
+	return t.inner.RoundTrip(req)
+}
+
+// reset resets the largest number of requests in flight and returns the previous one.
+func (t *inflightTransport) reset() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.max
+	t.max = 0
+	return n
+}
+
+func TestWithMaxConcurrency(t *testing.T) {
+	var blobs [][]byte
+	for i := 0; i < 8; i++ {
+		blobs = append(blobs, remotetest.Layer(t, 0, remotetest.File{Name: fmt.Sprintf("file%d", i), Content: "small"}))
+	}
+	tr := &inflightTransport{inner: remotetest.NewTransport()}
+	remotetest.PushLayers(t, tr, blobs...)
+
+	for _, tt := range []struct {
+		name string
+		op   func(r remote.Remote) error
+	}{
+		{name: "find", op: func(r remote.Remote) error {
+			_, _, err := r.Find(context.Background(), "file0")
+			return err
+		}},
+		{name: "preload", op: func(r remote.Remote) error {
+			return r.PreloadSmallFiles(context.Background(), 1024)
+		}},
+	} {
+		for _, n := range []int{1, 2} {
+			r := remotetest.Open(t, tr, remote.WithMaxConcurrency(n))
+			if got := r.MaxConcurrency(); got != n {
+				t.Errorf("got max concurrency %d, want %d", got, n)
+			}
+			tr.reset()
+			if err := tt.op(r); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if got := tr.reset(); got > n {
+				t.Errorf("%s: got %d requests in flight, want at most %d", tt.name, got, n)
+			}
+		}
+	}
+
+	// The layers are read all at once by default
+	r := remotetest.Open(t, tr)
+	if got := r.MaxConcurrency(); got != 0 {
+		t.Errorf("got max concurrency %d by default", got)
+	}
+	tr.reset()
+	if _, _, err := r.Find(context.Background(), "file0"); err != nil {
+		t.Fatal(err)
+	}
+	if got := tr.reset(); got <= 2 {
+		t.Errorf("expected the layers to be read concurrently, got %d requests in flight", got)
+	}
+
+	for _, n := range []int{0, -1} {
+		if _, err := remote.New(remotetest.Reference, remote.WithTransport(tr), remote.WithMaxConcurrency(n)); err == nil {
+			t.Errorf("expected an error for %d", n)
+		}
+	}
+}
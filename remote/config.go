@@ -0,0 +1,36 @@
+package remote
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Config returns the config file of the image.
+func (r Remote) Config() (*v1.ConfigFile, error) {
+	return r.image.ConfigFile()
+}
+
+// Labels returns the labels of the image config, e.g. org.opencontainers.image.source.
+// It returns an empty map if the image has no labels.
+func (r Remote) Labels(ctx context.Context) (map[string]string, error) {
+	config, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+	if config.Config.Labels == nil {
+		return map[string]string{}, nil
+	}
+	return config.Config.Labels, nil
+}
+
+// Created returns the creation time of the image in the config.
+// Images built reproducibly often have the Unix epoch, or the zero time if the config omits it.
+func (r Remote) Created(ctx context.Context) (time.Time, error) {
+	config, err := r.Config()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return config.Created.Time, nil
+}
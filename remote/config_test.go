@@ -0,0 +1,78 @@
+package remote_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestLabels(t *testing.T) {
+	labels := map[string]string{
+		"org.opencontainers.image.source":  "https://github.com/knqyf263/stargz-registry",
+		"org.opencontainers.image.version": "v1.0.0",
+	}
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   map[string]string
+	}{
+		{name: "labels", labels: labels, want: labels},
+		{name: "no labels", want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"})})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img, err = mutate.Config(img, v1.Config{Labels: tt.labels}); err != nil {
+				t.Fatal(err)
+			}
+			tr := remotetest.NewTransport()
+			if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := remotetest.Open(t, tr).Labels(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreated(t *testing.T) {
+	for _, want := range []time.Time{
+		time.Date(2021, 7, 1, 12, 30, 0, 0, time.UTC),
+		time.Unix(0, 0).UTC(), // reproducible builds
+	} {
+		img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"})})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img, err = mutate.CreatedAt(img, v1.Time{Time: want}); err != nil {
+			t.Fatal(err)
+		}
+		tr := remotetest.NewTransport()
+		if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := remotetest.Open(t, tr).Created(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
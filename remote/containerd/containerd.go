@@ -0,0 +1,49 @@
+// Package containerd reads layers from the content store of containerd when the blobs are stored there,
+// e.g. on nodes which have pulled the image with ctr. It is separated from the remote package
+// so that the core doesn't depend on containerd.
+package containerd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+// Store adapts the content store of containerd to remote.BlobStore.
+type Store struct {
+	provider content.Provider
+}
+
+// NewStore returns the blob store reading blobs from the provider, typically content.Store.
+func NewStore(provider content.Provider) *Store {
+	return &Store{provider: provider}
+}
+
+// ReaderAt implements remote.BlobStore.
+func (s *Store) ReaderAt(ctx context.Context, desc v1.Descriptor) (remote.BlobReaderAt, error) {
+	ra, err := s.provider.ReaderAt(ctx, ocispec.Descriptor{
+		MediaType:   string(desc.MediaType),
+		Digest:      digest.Digest(desc.Digest.String()),
+		Size:        desc.Size,
+		Annotations: desc.Annotations,
+	})
+	if errdefs.IsNotFound(err) {
+		return nil, fmt.Errorf("blob %s: %w", desc.Digest, remote.ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	return ra, nil
+}
+
+// WithContentStore reads layers from the content store of containerd when the blobs are stored there,
+// falling back to the registry otherwise.
+func WithContentStore(provider content.Provider) remote.Option {
+	return remote.WithBlobStore(NewStore(provider))
+}
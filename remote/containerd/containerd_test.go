@@ -0,0 +1,121 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// fakeProvider is a content store of the blobs keyed by their digests.
+type fakeProvider map[string][]byte
+
+func (p fakeProvider) ReaderAt(_ context.Context, desc ocispec.Descriptor) (content.ReaderAt, error) {
+	b, ok := p[desc.Digest.String()]
+	if !ok {
+		return nil, errdefs.ErrNotFound
+	}
+	return readerAt{bytes.NewReader(b)}, nil
+}
+
+type readerAt struct {
+	*bytes.Reader
+}
+
+func (readerAt) Close() error {
+	return nil
+}
+
+func TestWithContentStore(t *testing.T) {
+	var blobs [][]byte
+	for _, f := range []remotetest.File{{Name: "stored", Content: "from the store"}, {Name: "pulled", Content: "from the registry"}, {Name: "truncated", Content: "partially stored"}} {
+		blob, _, err := remotetest.BuildLayer([]remotetest.File{f})
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs = append(blobs, blob)
+	}
+	img, err := remotetest.NewImage(blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var digests []v1.Hash
+	for _, l := range layers {
+		d, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, d)
+	}
+	// The last blob is still being written
+	store := fakeProvider{
+		digests[0].String(): blobs[0],
+		digests[2].String(): blobs[2][:len(blobs[2])/2],
+	}
+
+	inner := remotetest.NewTransport()
+	if err = remotetest.Push(inner, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	requested := map[string]int{}
+	tr := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requested[path.Base(req.URL.Path)]++
+		mu.Unlock()
+		return inner.RoundTrip(req)
+	})
+	r, err := remote.New(remotetest.Reference, remote.WithTransport(tr), WithContentStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"stored": "from the store", "pulled": "from the registry", "truncated": "partially stored"} {
+		b, err := r.ReadFile(context.Background(), name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(b) != want {
+			t.Errorf("%s: got %q, want %q", name, b, want)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if n := requested[digests[0].String()]; n != 0 {
+		t.Errorf("expected no request for the stored blob, got %d", n)
+	}
+	for _, d := range digests[1:] {
+		if requested[d.String()] == 0 {
+			t.Errorf("expected %s to be fetched from the registry", d)
+		}
+	}
+}
+
+func TestStoreNotFound(t *testing.T) {
+	_, err := NewStore(fakeProvider{}).ReaderAt(context.Background(), v1.Descriptor{Digest: v1.Hash{Algorithm: "sha256", Hex: "00"}})
+	if !errors.Is(err, remote.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper so that tests can intercept requests.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
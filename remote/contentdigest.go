@@ -0,0 +1,79 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// DigestMismatchError is returned when the registry serves content of another blob than the layer.
+type DigestMismatchError struct {
+	Expected v1.Hash
+	Actual   v1.Hash
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("digest mismatch: expected %s, got %s", e.Expected, e.Actual)
+}
+
+// checkContentDigest cross-checks the Docker-Content-Digest header of the response with the digest of the layer.
+// The header is optional, and one which isn't a valid digest is ignored since some CDNs put other values there.
+func (l *Layer) checkContentDigest(h http.Header) error {
+	v := h.Get("Docker-Content-Digest")
+	if v == "" {
+		return nil
+	}
+	actual, err := v1.NewHash(v)
+	if err != nil {
+		return nil
+	}
+	if actual != l.digest {
+		return &DigestMismatchError{Expected: l.digest, Actual: actual}
+	}
+	return nil
+}
+
+// verifyingReader hashes the whole blob while it is read and fails at EOF if the digest doesn't match.
+// The mismatch is reported by a Read returning no bytes after the last ones,
+// so that callers stopping once they have got the bytes, such as io.ReadFull, can't miss it by accident.
+type verifyingReader struct {
+	rc       io.ReadCloser
+	h        hash.Hash
+	expected v1.Hash
+	err      error
+}
+
+// newVerifyingReader wraps the body of a full blob. The body is returned as is if the algorithm isn't supported.
+func newVerifyingReader(rc io.ReadCloser, expected v1.Hash) io.ReadCloser {
+	if expected.Algorithm != "sha256" {
+		return rc
+	}
+	return &verifyingReader{rc: rc, h: sha256.New(), expected: expected}
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.rc.Read(p)
+	r.h.Write(p[:n])
+	if err == io.EOF {
+		actual := v1.Hash{Algorithm: r.expected.Algorithm, Hex: fmt.Sprintf("%x", r.h.Sum(nil))}
+		if actual != r.expected {
+			r.err = &DigestMismatchError{Expected: r.expected, Actual: actual}
+			if n > 0 {
+				return n, nil
+			}
+			return 0, r.err
+		}
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,73 @@
+package remote_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// tamperingTransport serves a corrupted blob with 200 when the whole blob is requested.
+func tamperingTransport(inner http.RoundTripper) http.RoundTripper {
+	return remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := inner.RoundTrip(req)
+		if err != nil || !isBlobRange(req) || res.StatusCode != http.StatusPartialContent {
+			return res, err
+		}
+		var begin, end, size int64
+		if _, err := fmt.Sscanf(res.Header.Get("Content-Range"), "bytes %d-%d/%d", &begin, &end, &size); err != nil || begin != 0 || end != size-1 {
+			return res, nil
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		b[len(b)/2] ^= 0xff
+		res.StatusCode, res.Status = http.StatusOK, "200 OK"
+		res.Header.Del("Content-Range")
+		res.Body = ioutil.NopCloser(bytes.NewReader(b))
+		return res, nil
+	})
+}
+
+func TestReadAtFullBlobDigestMismatch(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "tampered on the way"}))
+
+	l := layersOf(t, remotetest.Open(t, tamperingTransport(tr)))[0]
+	p := make([]byte, l.Size())
+	_, err := l.ReadAt(p, 0)
+	var mismatch *remote.DigestMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected a digest mismatch, got %v", err)
+	}
+	if mismatch.Expected != l.Digest() {
+		t.Errorf("expected digest %s, got %s", mismatch.Expected, l.Digest())
+	}
+
+	// Ranges are served as is
+	if _, err = l.ReadAt(p[:10], 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadAtFullBlobVerified(t *testing.T) {
+	tr := remotetest.NewTransport()
+	blob := remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "intact"})
+	remotetest.PushLayers(t, tr, blob)
+
+	l := layersOf(t, remotetest.Open(t, tr))[0]
+	p := make([]byte, l.Size())
+	if _, err := l.ReadAt(p, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, blob) {
+		t.Error("unexpected blob content")
+	}
+}
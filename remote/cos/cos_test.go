@@ -0,0 +1,97 @@
+package cos
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsCOS(t *testing.T) {
+	for host, want := range map[string]bool{
+		"examplebucket-1250000000.cos.ap-beijing.myqcloud.com":     true,
+		"examplebucket-1250000000.cos.ap-beijing.myqcloud.com:443": true,
+		"EXAMPLEBUCKET-1250000000.COS.AP-BEIJING.MYQCLOUD.COM":     true,
+		"ccr.ccs.tencentyun.com":                                   false,
+		"cos.ap-beijing.example.com":                               false,
+		"registry.example.com":                                     false,
+	} {
+		if got := IsCOS(host); got != want {
+			t.Errorf("IsCOS(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	s := NewSigner("AKID", "secret")
+	s.now = func() time.Time { return time.Unix(1557989151, 0) }
+	req, err := http.NewRequest(http.MethodGet, "https://examplebucket-1250000000.cos.ap-beijing.myqcloud.com/exampleobject(%E8%85%BE%E8%AE%AF%E4%BA%91)?response-content-type=text/plain&Versionid=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=0-1")
+	if err = s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// The signature as documented, computed from the lowercase and sorted parameters and the host
+	const keyTime = "1557989151;1557989751"
+	httpString := "get\n/exampleobject(腾讯云)\nresponse-content-type=text%2Fplain&versionid=1\nhost=examplebucket-1250000000.cos.ap-beijing.myqcloud.com\n"
+	sum := sha1.Sum([]byte(httpString))
+	signature := hmacSHA1(hmacSHA1("secret", keyTime), "sha1\n"+keyTime+"\n"+hex.EncodeToString(sum[:])+"\n")
+
+	want := strings.Join([]string{
+		"q-sign-algorithm=sha1",
+		"q-ak=AKID",
+		"q-sign-time=" + keyTime,
+		"q-key-time=" + keyTime,
+		"q-header-list=host",
+		"q-url-param-list=response-content-type;versionid",
+		"q-signature=" + signature,
+	}, "&")
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := req.Header.Get("x-cos-security-token"); got != "" {
+		t.Errorf("got token %q without a session token", got)
+	}
+}
+
+func TestSignSkipped(t *testing.T) {
+	s := NewSigner("AKID", "secret")
+	for _, u := range []string{
+		"https://registry.example.com/v2/",
+		"https://examplebucket-1250000000.cos.ap-beijing.myqcloud.com/blob?q-sign-algorithm=sha1&q-signature=presigned",
+	} {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Sign(req); err != nil {
+			t.Fatal(err)
+		}
+		if len(req.Header) != 0 {
+			t.Errorf("%s: got headers %v", u, req.Header)
+		}
+	}
+}
+
+func TestSignSessionToken(t *testing.T) {
+	s := NewSigner("AKID", "secret")
+	s.SessionToken = "token"
+	req, err := http.NewRequest(http.MethodGet, "https://examplebucket-1250000000.cos.ap-beijing.myqcloud.com/blob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("x-cos-security-token"); got != "token" {
+		t.Errorf("got token %q", got)
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "q-signature=") {
+		t.Errorf("got authorization %q", req.Header.Get("Authorization"))
+	}
+}
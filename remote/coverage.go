@@ -0,0 +1,45 @@
+package remote
+
+import (
+	"os"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// CoverageRange returns the span [start, end) of the blob which covers the footer, the TOC,
+// and the content of the given files. Fetching the span is enough to read the files lazily.
+func (l *Layer) CoverageRange(paths []string) (start, end int64, err error) {
+	esgz, err := l.Open()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The TOC and the footer are at the end of the blob unless the TOC is stored separately.
+	start, end = l.size, l.size
+	if l.externalTOC == nil {
+		tocOffset, _, err := estargz.OpenFooter(l.footerSection())
+		if err != nil {
+			return 0, 0, err
+		}
+		start = tocOffset
+	}
+
+	for _, p := range paths {
+		e, ok := esgz.Lookup(p)
+		if !ok {
+			return 0, 0, &os.PathError{Op: "lookup", Path: p, Err: os.ErrNotExist}
+		}
+		if e.Type != "reg" || e.Size == 0 {
+			continue
+		}
+
+		chunks := chunksOf(esgz, e)
+		if e.Offset < start {
+			start = e.Offset
+		}
+		if next := chunks[len(chunks)-1].NextOffset(); next > end {
+			end = next
+		}
+	}
+	return start, end, nil
+}
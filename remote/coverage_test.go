@@ -0,0 +1,58 @@
+package remote_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestCoverageRange(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0,
+		remotetest.File{Name: "a", Content: "first"},
+		remotetest.File{Name: "b", Content: "second"},
+		remotetest.File{Name: "c", Content: "third"},
+		remotetest.File{Name: "d", Content: "fourth"},
+	))
+	l := layersOf(t, remotetest.Open(t, tr))[0]
+	esgz, err := l.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := func(name string) *estargz.TOCEntry {
+		e, ok := esgz.Lookup(name)
+		if !ok {
+			t.Fatalf("%s not found", name)
+		}
+		return e
+	}
+
+	// The span starts at the first of the files and ends at the footer
+	start, end, err := l.CoverageRange([]string{"c", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := entry("b").Offset; start != want {
+		t.Errorf("got start %d, want %d", start, want)
+	}
+	if end != l.Size() {
+		t.Errorf("got end %d, want %d", end, l.Size())
+	}
+
+	// Without files, the span is the TOC and the footer
+	tocStart, _, err := l.CoverageRange(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := entry("d"); tocStart <= d.Offset || tocStart >= l.Size() {
+		t.Errorf("got the TOC offset %d, want one between %d and %d", tocStart, d.Offset, l.Size())
+	}
+
+	if _, _, err = l.CoverageRange([]string{"missing"}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v, got %v", os.ErrNotExist, err)
+	}
+}
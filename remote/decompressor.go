@@ -0,0 +1,33 @@
+package remote
+
+import (
+	"sync"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+var (
+	decompressorsMu         sync.RWMutex
+	registeredDecompressors = map[types.MediaType]estargz.Decompressor{}
+)
+
+// RegisterDecompressor makes layers of the media type readable lazily with the decompressor,
+// e.g. for a seekable compression format this package doesn't know. Such layers have FormatCustom.
+// Registering a known media type overrides the built-in decompressor. It panics if d is nil.
+func RegisterDecompressor(mediaType string, d estargz.Decompressor) {
+	if d == nil {
+		panic("remote: RegisterDecompressor decompressor is nil")
+	}
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+	registeredDecompressors[types.MediaType(mediaType)] = d
+}
+
+// registeredDecompressor returns the decompressor registered for the media type.
+func registeredDecompressor(mt types.MediaType) (estargz.Decompressor, bool) {
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+	d, ok := registeredDecompressors[mt]
+	return d, ok
+}
@@ -0,0 +1,87 @@
+package remote_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// tokenRegistry serves blobs directly without redirects
+// and requires a bearer token on every request. The token expires after every range read of a file.
+type tokenRegistry struct {
+	reg http.Handler
+
+	mu         sync.Mutex
+	generation int
+	tokens     int
+	ranges     []string // the paths of the range requests except the probes
+}
+
+func (h *tokenRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		h.tokens++
+		json.NewEncoder(w).Encode(map[string]string{"token": fmt.Sprintf("token-%d", h.generation)})
+		return
+	}
+	if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", h.generation) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="registry"`, r.Host))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.reg.ServeHTTP(w, r)
+	if r.Header.Get("Range") != "" && strings.Contains(r.URL.Path, "/blobs/") && !isProbe(r) {
+		h.ranges = append(h.ranges, r.URL.Path)
+		h.generation++
+	}
+}
+
+func TestDirectBlobWithAuth(t *testing.T) {
+	h := &tokenRegistry{}
+	srv := serveImage(t, func(reg http.Handler) http.Handler {
+		h.reg = reg
+		return h
+	}, remotetest.Layer(t, 0,
+		remotetest.File{Name: "a", Content: "served directly"},
+		remotetest.File{Name: "b", Content: "after the token expired"},
+	))
+
+	r, err := remote.New(srv.Listener.Addr().String() + "/test/image:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{"a": "served directly", "b": "after the token expired"} {
+		b, err := r.ReadFile(context.Background(), path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if string(b) != want {
+			t.Errorf("%s: got %q, want %q", path, b, want)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.ranges) == 0 {
+		t.Fatal("no range request")
+	}
+	for _, p := range h.ranges {
+		if !strings.HasPrefix(p, "/v2/test/image/blobs/") {
+			t.Errorf("range request to %s, want the blob URL of the registry", p)
+		}
+	}
+	// The first token and a new token after each range read but the last one
+	if h.tokens < len(h.ranges) {
+		t.Errorf("got %d token requests for %d range requests, want the expired tokens to be refreshed", h.tokens, len(h.ranges))
+	}
+}
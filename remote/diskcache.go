@@ -0,0 +1,173 @@
+package remote
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// defaultDiskCacheMaxBytes is the default size cap of the disk cache.
+const defaultDiskCacheMaxBytes = 1 << 30
+
+// diskCache persists blob ranges fetched from the registry, keyed by layer digest and range.
+// The least recently used ranges are evicted when the total size exceeds maxBytes.
+type diskCache struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	index map[string]*diskCacheEntry // keyed by the file path
+	total int64
+}
+
+type diskCacheEntry struct {
+	size     int64
+	lastUsed time.Time
+}
+
+func newDiskCache(dir string, maxBytes int64) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	c := &diskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		index:    map[string]*diskCacheEntry{},
+	}
+
+	// Load ranges cached by previous runs
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path == filepath.Join(dir, metadataDir) {
+			// Manifests and configs are not subject to eviction
+			return filepath.SkipDir
+		}
+		if info.IsDir() || filepath.Ext(path) == ".tmp" {
+			return nil
+		}
+		c.index[path] = &diskCacheEntry{size: info.Size(), lastUsed: info.ModTime()}
+		c.total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the disk cache: %w", err)
+	}
+	return c, nil
+}
+
+func (c *diskCache) path(dgst v1.Hash, offset int64, length int) string {
+	return filepath.Join(c.dir, dgst.Algorithm, dgst.Hex, fmt.Sprintf("%d-%d", offset, length))
+}
+
+// get fills p with the cached range starting at offset. It returns false when the range isn't cached.
+func (c *diskCache) get(dgst v1.Hash, p []byte, offset int64) bool {
+	path := c.path(dgst, offset, len(p))
+
+	c.mu.Lock()
+	entry, ok := c.index[path]
+	if ok {
+		entry.lastUsed = time.Now()
+	}
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil || len(b) != len(p) {
+		c.remove(path)
+		return false
+	}
+	copy(p, b)
+
+	// Keep the LRU order across runs
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return true
+}
+
+// has reports whether the range is cached.
+func (c *diskCache) has(dgst v1.Hash, offset int64, length int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.index[c.path(dgst, offset, length)]
+	return ok
+}
+
+// add stores the range. Failures are ignored since the cache is best-effort.
+func (c *diskCache) add(dgst v1.Hash, offset int64, data []byte) {
+	path := c.path(dgst, offset, len(data))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+
+	// Write to a temporary file first so that readers never see a partial range
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.index[path]; ok {
+		c.total -= old.size
+	}
+	c.index[path] = &diskCacheEntry{size: int64(len(data)), lastUsed: time.Now()}
+	c.total += int64(len(data))
+	c.evict()
+}
+
+func (c *diskCache) remove(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.index[path]; ok {
+		c.total -= entry.size
+		delete(c.index, path)
+	}
+	os.Remove(path)
+}
+
+// evict removes the least recently used ranges until the total size fits in maxBytes.
+// c.mu must be held.
+func (c *diskCache) evict() {
+	if c.total <= c.maxBytes {
+		return
+	}
+
+	paths := make([]string, 0, len(c.index))
+	for path := range c.index {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return c.index[paths[i]].lastUsed.Before(c.index[paths[j]].lastUsed)
+	})
+
+	for _, path := range paths {
+		if c.total <= c.maxBytes {
+			break
+		}
+		c.total -= c.index[path].size
+		delete(c.index, path)
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,56 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// blobSwitch fails range requests of blobs while it is off, like a network going down after the image is resolved.
+// The probes resolving redirects still succeed.
+type blobSwitch struct {
+	inner http.RoundTripper
+	off   int32
+}
+
+func (s *blobSwitch) RoundTrip(req *http.Request) (*http.Response, error) {
+	if atomic.LoadInt32(&s.off) == 1 && isBlobRange(req) && !isProbe(req) {
+		return nil, errors.New("network is disabled")
+	}
+	return s.inner.RoundTrip(req)
+}
+
+func TestDiskCache(t *testing.T) {
+	tr := &blobSwitch{inner: remotetest.NewTransport()}
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0,
+		remotetest.File{Name: "a", Content: "cached on disk"},
+		remotetest.File{Name: "b", Content: "not cached"},
+	))
+	dir := t.TempDir()
+
+	r := remotetest.Open(t, tr, remote.WithDiskCache(dir), remote.WithRetry(1, 0))
+	if _, err := r.ReadFile(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another Remote, e.g. of another process, reads the file from the disk
+	atomic.StoreInt32(&tr.off, 1)
+	r = remotetest.Open(t, tr, remote.WithDiskCache(dir), remote.WithRetry(1, 0))
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "cached on disk" {
+		t.Errorf("got %q, want %q", b, "cached on disk")
+	}
+
+	// The TOC is cached, but the content of b isn't
+	if _, err = r.ReadFile(context.Background(), "b"); err == nil {
+		t.Error("expected b to be read from the registry")
+	}
+}
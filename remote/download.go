@@ -0,0 +1,47 @@
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Download writes the whole blob of the layer to w as is, i.e. the compressed estargz bytes.
+// When the connection breaks in the middle, the download resumes from where it stopped.
+// The digest of the downloaded blob is verified. The progress is reported to the callback set by WithProgress.
+func (l *Layer) Download(ctx context.Context, w io.Writer) (int64, error) {
+	if l.digest.Algorithm != "sha256" {
+		return 0, fmt.Errorf("unsupported digest algorithm: %s", l.digest.Algorithm)
+	}
+
+	h := sha256.New()
+	mw := io.MultiWriter(w, h, newProgress(l.progress, l.size))
+
+	var written int64
+	for attempt := 1; written < l.size; attempt++ {
+		rc, err := l.fetch(ctx, written, l.size-1)
+		if err != nil {
+			return written, err
+		}
+		n, err := io.Copy(mw, rc)
+		rc.Close()
+		written += n
+		if err != nil {
+			if attempt >= l.retry.attempts || ctx.Err() != nil {
+				return written, fmt.Errorf("failed to download %s: %w", l.digest, err)
+			}
+			// Resume from the current offset
+			continue
+		}
+		if written < l.size && n == 0 {
+			return written, fmt.Errorf("failed to download %s: %w", l.digest, io.ErrUnexpectedEOF)
+		}
+	}
+
+	if got := hex.EncodeToString(h.Sum(nil)); got != l.digest.Hex {
+		return written, fmt.Errorf("digest mismatch: got sha256:%s, want %s", got, l.digest)
+	}
+	return written, nil
+}
@@ -0,0 +1,93 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// brokenBody returns the first n bytes of the body and then fails like a broken connection.
+type brokenBody struct {
+	io.ReadCloser
+	n int
+}
+
+func (b *brokenBody) Read(p []byte) (int, error) {
+	if b.n <= 0 {
+		return 0, errors.New("connection reset")
+	}
+	if len(p) > b.n {
+		p = p[:b.n]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n -= n
+	return n, err
+}
+
+func TestDownload(t *testing.T) {
+	blob := remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: strings.Repeat("downloaded ", 100)})
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, blob)
+
+	// The connection of the first download breaks in the middle
+	var broken int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := inner.RoundTrip(req)
+		if err == nil && isBlobRange(req) && !isProbe(req) && atomic.AddInt32(&broken, 1) == 1 {
+			res.Body = &brokenBody{ReadCloser: res.Body, n: len(blob) / 2}
+		}
+		return res, err
+	})
+	l := layersOf(t, remotetest.Open(t, tr))[0]
+
+	var buf bytes.Buffer
+	n, err := l.Download(context.Background(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(blob)) || !bytes.Equal(buf.Bytes(), blob) {
+		t.Fatalf("got %d bytes differing from the blob of %d bytes", n, len(blob))
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	if got := "sha256:" + hex.EncodeToString(sum[:]); got != l.Digest().String() {
+		t.Errorf("got digest %s, want %s", got, l.Digest())
+	}
+	if atomic.LoadInt32(&broken) != 2 {
+		t.Errorf("expected the download to be resumed once, got %d requests", broken)
+	}
+}
+
+func TestDownloadDigestMismatch(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "tampered"}))
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := inner.RoundTrip(req)
+		if err != nil || !isBlobRange(req) || isProbe(req) {
+			return res, err
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		b[len(b)/2] ^= 0xff
+		res.Body = ioutil.NopCloser(bytes.NewReader(b))
+		return res, nil
+	})
+	l := layersOf(t, remotetest.Open(t, tr, remote.WithRetry(1, 0)))[0]
+
+	if _, err := l.Download(context.Background(), ioutil.Discard); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("expected a digest mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// Package ecr provides a keychain authenticating to Amazon ECR registries
+// with authorization tokens obtained through the AWS SDK.
+// It is useful where docker-credential-ecr-login isn't configured,
+// e.g. on EC2 instances or in CI jobs having only AWS credentials.
+package ecr
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// registryPattern matches ECR registry hosts and captures the account ID and the region,
+// e.g. 123456789012.dkr.ecr.us-east-1.amazonaws.com.
+var registryPattern = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// IsECR reports whether the registry host is an ECR registry.
+func IsECR(host string) bool {
+	return registryPattern.MatchString(host)
+}
+
+// tokenRefreshMargin is how long before the expiry a cached token is refreshed.
+const tokenRefreshMargin = 5 * time.Minute
+
+// Keychain resolves ECR registries to the credentials in their authorization tokens.
+// Other registries, and all registries where no AWS credentials are configured, are resolved to anonymous
+// so that public images can be pulled and another keychain can be tried with authn.NewMultiKeychain.
+// Tokens are cached until shortly before they expire.
+type Keychain struct {
+	// Endpoint overrides the ECR API endpoint, e.g. for a VPC endpoint.
+	Endpoint string
+
+	mu     sync.Mutex
+	tokens map[string]token // keyed by registry host
+}
+
+// errNoCredentials is returned by getToken when the AWS credential chain finds no credentials.
+var errNoCredentials = errors.New("no AWS credentials")
+
+type token struct {
+	auth    authn.AuthConfig
+	expires time.Time
+}
+
+// NewKeychain returns a Keychain using the default AWS credential chain,
+// i.e. the environment variables, the shared config files, and the instance or task role.
+func NewKeychain() *Keychain {
+	return &Keychain{tokens: map[string]token{}}
+}
+
+// Resolve implements authn.Keychain.
+func (k *Keychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	host := target.RegistryStr()
+	m := registryPattern.FindStringSubmatch(host)
+	if m == nil {
+		return authn.Anonymous, nil
+	}
+	account, region := m[1], m[2]
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if t, ok := k.tokens[host]; ok && time.Now().Add(tokenRefreshMargin).Before(t.expires) {
+		return authn.FromConfig(t.auth), nil
+	}
+
+	t, err := k.getToken(account, region)
+	if errors.Is(err, errNoCredentials) {
+		return authn.Anonymous, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get ECR authorization token for %s: %w", host, err)
+	}
+	if k.tokens == nil {
+		k.tokens = map[string]token{}
+	}
+	k.tokens[host] = t
+	return authn.FromConfig(t.auth), nil
+}
+
+// getToken calls GetAuthorizationToken of the registry in the region.
+func (k *Keychain) getToken(account, region string) (token, error) {
+	cfg := aws.NewConfig().WithRegion(region)
+	if k.Endpoint != "" {
+		cfg = cfg.WithEndpoint(k.Endpoint)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return token{}, err
+	}
+	if _, err := sess.Config.Credentials.Get(); err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == "NoCredentialProviders" {
+			return token{}, errNoCredentials
+		}
+		return token{}, err
+	}
+
+	out, err := ecr.New(sess).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(account)},
+	})
+	if err != nil {
+		return token{}, err
+	}
+	if len(out.AuthorizationData) == 0 {
+		return token{}, fmt.Errorf("no authorization data returned")
+	}
+	data := out.AuthorizationData[0]
+
+	// The token is base64-encoded "AWS:<password>"
+	b, err := base64.StdEncoding.DecodeString(aws.StringValue(data.AuthorizationToken))
+	if err != nil {
+		return token{}, fmt.Errorf("malformed authorization token: %w", err)
+	}
+	user, pass, ok := cut(string(b), ":")
+	if !ok {
+		return token{}, fmt.Errorf("malformed authorization token")
+	}
+	return token{
+		auth:    authn.AuthConfig{Username: user, Password: pass},
+		expires: aws.TimeValue(data.ExpiresAt),
+	}, nil
+}
+
+// cut is strings.Cut, which isn't available in Go 1.16.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,145 @@
+package ecr
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+const testRegistry = "123456789012.dkr.ecr.us-east-1.amazonaws.com"
+
+// setenv sets the environment variables for the test, like t.Setenv, which isn't available in Go 1.16.
+func setenv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for k, v := range env {
+		old, ok := os.LookupEnv(k)
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+// noAWSConfig points the AWS credential chain at nothing.
+func noAWSConfig(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	setenv(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":                      "",
+		"AWS_SECRET_ACCESS_KEY":                  "",
+		"AWS_SESSION_TOKEN":                      "",
+		"AWS_PROFILE":                            "",
+		"AWS_ROLE_ARN":                           "",
+		"AWS_WEB_IDENTITY_TOKEN_FILE":            "",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI":     "",
+		"AWS_SHARED_CREDENTIALS_FILE":            filepath.Join(dir, "credentials"),
+		"AWS_CONFIG_FILE":                        filepath.Join(dir, "config"),
+		"AWS_EC2_METADATA_DISABLED":              "true",
+	})
+}
+
+func resolve(t *testing.T, k *Keychain, repo string) (authn.Authenticator, error) {
+	t.Helper()
+	r, err := name.NewRepository(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k.Resolve(r)
+}
+
+func TestKeychainOtherRegistry(t *testing.T) {
+	auth, err := resolve(t, NewKeychain(), "docker.io/library/alpine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != authn.Anonymous {
+		t.Errorf("expected anonymous, got %v", auth)
+	}
+}
+
+func TestKeychainNoCredentials(t *testing.T) {
+	noAWSConfig(t)
+
+	auth, err := resolve(t, NewKeychain(), testRegistry+"/image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != authn.Anonymous {
+		t.Errorf("expected anonymous, got %v", auth)
+	}
+}
+
+func TestKeychain(t *testing.T) {
+	noAWSConfig(t)
+	setenv(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "SECRET",
+	})
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if got := r.Header.Get("X-Amz-Target"); !strings.HasSuffix(got, ".GetAuthorizationToken") {
+			t.Errorf("unexpected target %q", got)
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(b), "123456789012") {
+			t.Errorf("registry ID isn't requested: %s", b)
+		}
+		tok := base64.StdEncoding.EncodeToString([]byte("AWS:password"))
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d}]}`, tok, time.Now().Add(time.Hour).Unix())
+	}))
+	defer srv.Close()
+
+	k := NewKeychain()
+	k.Endpoint = srv.URL
+	for i := 0; i < 2; i++ {
+		auth, err := resolve(t, k, testRegistry+"/image")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := auth.Authorization()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Username != "AWS" || cfg.Password != "password" {
+			t.Errorf("unexpected credentials %+v", cfg)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the token to be cached, got %d calls", calls)
+	}
+}
+
+func TestIsECR(t *testing.T) {
+	for host, want := range map[string]bool{
+		testRegistry: true,
+		"123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com": true,
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn":      true,
+		"public.ecr.aws": false,
+		"123456789012.dkr.ecr.us-east-1.evil.com": false,
+	} {
+		if got := IsECR(host); got != want {
+			t.Errorf("IsECR(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Explanation tells how the layers of the image make up a path in the merged view.
+type Explanation struct {
+	// Path is the cleaned path.
+	Path string
+
+	// PresentIn lists the indexes of the layers containing the path, from the bottom.
+	PresentIn []int
+
+	// VisibleIn is the index of the layer providing the path in the merged view, or -1 if the path doesn't exist.
+	// The path in lower layers is shadowed by this layer.
+	VisibleIn int
+
+	// WhitedOutIn is the index of the layer hiding the path in lower layers
+	// with a whiteout of the path or one of its parents, or -1 if it isn't whited out.
+	WhitedOutIn int
+}
+
+// Exists reports whether the path exists in the merged view.
+func (e Explanation) Exists() bool {
+	return e.VisibleIn >= 0
+}
+
+// String describes the outcome in a line.
+func (e Explanation) String() string {
+	switch {
+	case e.VisibleIn >= 0:
+		var shadowed []string
+		for _, i := range e.PresentIn {
+			if i < e.VisibleIn {
+				shadowed = append(shadowed, fmt.Sprint(i))
+			}
+		}
+		if len(shadowed) == 0 {
+			return fmt.Sprintf("%s: provided by layer %d", e.Path, e.VisibleIn)
+		}
+		return fmt.Sprintf("%s: provided by layer %d, shadowing layers %s", e.Path, e.VisibleIn, strings.Join(shadowed, ", "))
+	case e.WhitedOutIn >= 0 && len(e.PresentIn) > 0:
+		return fmt.Sprintf("%s: present in layers %s, whited out in layer %d", e.Path, joinInts(e.PresentIn), e.WhitedOutIn)
+	case e.WhitedOutIn >= 0:
+		return fmt.Sprintf("%s: never present, whited out in layer %d", e.Path, e.WhitedOutIn)
+	}
+	return fmt.Sprintf("%s: never present", e.Path)
+}
+
+func joinInts(a []int) string {
+	s := make([]string, len(a))
+	for i, v := range a {
+		s[i] = fmt.Sprint(v)
+	}
+	return strings.Join(s, ", ")
+}
+
+// Explain tells why the path exists or not in the merged view of the image,
+// i.e. which layers contain it, which one provides it, and which one whites it out.
+func (r Remote) Explain(ctx context.Context, p string) (Explanation, error) {
+	layers, err := r.openLayers(ctx)
+	if err != nil {
+		return Explanation{}, err
+	}
+
+	p = cleanPath(p)
+	ex := Explanation{Path: p, VisibleIn: -1, WhitedOutIn: -1}
+	for i := len(layers) - 1; i >= 0; i-- {
+		esgz, _ := layers[i].Open()
+		if _, ok := esgz.Lookup(p); ok {
+			ex.PresentIn = append(ex.PresentIn, layers[i].Index())
+			if ex.VisibleIn < 0 && ex.WhitedOutIn < 0 {
+				ex.VisibleIn = layers[i].Index()
+			}
+		}
+		if ex.VisibleIn < 0 && ex.WhitedOutIn < 0 && whitedOut(esgz, p) {
+			ex.WhitedOutIn = layers[i].Index()
+		}
+	}
+	sort.Ints(ex.PresentIn)
+	return ex, nil
+}
@@ -0,0 +1,58 @@
+package remote_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+func TestExplain(t *testing.T) {
+	r := newRemote(t, overlayLayers)
+	tests := []struct {
+		name string
+		path string
+		want remote.Explanation
+	}{
+		{
+			name: "present",
+			path: "etc",
+			want: remote.Explanation{Path: "etc", PresentIn: []int{0, 1, 2}, VisibleIn: 2, WhitedOutIn: -1},
+		},
+		{
+			name: "shadowed",
+			path: "/etc/os-release",
+			want: remote.Explanation{Path: "etc/os-release", PresentIn: []int{0, 2}, VisibleIn: 2, WhitedOutIn: -1},
+		},
+		{
+			name: "whited out",
+			path: "etc/removed",
+			want: remote.Explanation{Path: "etc/removed", PresentIn: []int{0}, VisibleIn: -1, WhitedOutIn: 1},
+		},
+		{
+			name: "opaque directory",
+			path: "var/lib/data",
+			want: remote.Explanation{Path: "var/lib/data", PresentIn: []int{0}, VisibleIn: -1, WhitedOutIn: 1},
+		},
+		{
+			name: "never present",
+			path: "etc/missing",
+			want: remote.Explanation{Path: "etc/missing", VisibleIn: -1, WhitedOutIn: -1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Explain(context.Background(), tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if got.Exists() != (tt.want.VisibleIn >= 0) {
+				t.Errorf("Exists() = %v", got.Exists())
+			}
+		})
+	}
+}
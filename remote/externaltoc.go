@@ -0,0 +1,149 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/knqyf263/stargz-registry/remote/internal/footer"
+)
+
+// ExternalTOCDigestAnnotation is the default layer annotation pointing to a blob which holds the TOC of the layer
+// instead of the layer itself. The blob lives in the same repository and has the same format as
+// the TOC embedded in an estargz layer, i.e. a gzip-compressed tar containing stargz.index.json.
+// The key is owned by this project since neither estargz nor stargz-snapshotter defines such an annotation,
+// so use WithExternalTOCAnnotation for layers annotated by other tools.
+const ExternalTOCDigestAnnotation = "com.github.knqyf263.stargz-registry.toc.external.digest"
+
+// maxExternalTOCSize is the maximum size of an external TOC blob, which is buffered in memory.
+// It is far larger than the compressed TOC of a layer with a million files.
+const maxExternalTOCSize = 64 << 20
+
+// externalTOC is a TOC stored in a separate blob.
+type externalTOC struct {
+	digest v1.Hash
+	url    string
+	size   int64 // known once the TOC is fetched
+}
+
+// parseExternalTOC returns the digest of the external TOC blob of the layer in the annotation of the key, if any.
+func parseExternalTOC(annotations map[string]string, key string) (v1.Hash, bool, error) {
+	s, ok := annotations[key]
+	if !ok {
+		return v1.Hash{}, false, nil
+	}
+	h, err := v1.NewHash(s)
+	if err != nil {
+		return v1.Hash{}, false, fmt.Errorf("invalid %s annotation %q: %w", key, s, err)
+	}
+	return h, true, nil
+}
+
+// openWithExternalTOC opens the layer with the TOC stored in a separate blob.
+func (l *Layer) openWithExternalTOC(ra io.ReaderAt) (*estargz.Reader, error) {
+	toc, err := l.fetchExternalTOC(l.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the external TOC %s: %w", l.externalTOC.digest, err)
+	}
+	return l.openExternalTOC(ra, toc)
+}
+
+// openExternalTOC parses the external TOC of the layer whose blob is read through ra.
+// The TOC and a footer pointing to it are appended to the layer virtually
+// so that estargz.Open can parse them as if they were embedded.
+func (l *Layer) openExternalTOC(ra io.ReaderAt, toc []byte) (*estargz.Reader, error) {
+	l.externalTOC.size = int64(len(toc))
+	// toc may be shared through the LayerCache, so the footer is appended to a copy
+	tail := append(toc[:len(toc):len(toc)], footer.Bytes(l.size)...)
+	vr := &appendedReaderAt{ra: ra, size: l.size, tail: tail}
+	return estargz.Open(io.NewSectionReader(vr, 0, l.size+int64(len(tail))))
+}
+
+func (l *Layer) fetchExternalTOC(ctx context.Context) ([]byte, error) {
+	var b []byte
+	err := l.retry.do(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", l.externalTOC.url, nil)
+		if err != nil {
+			return err
+		}
+		if err = modifyRequest(req, l.modifyRequest); err != nil {
+			return err
+		}
+		res, err := (&http.Client{Transport: l.rt}).Do(req)
+		if err != nil {
+			return retryable(ctx, err, 0)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			err = fmt.Errorf("unexpected status code: %v", res.Status)
+			if retryableStatus(res.StatusCode) {
+				return retryable(ctx, err, retryAfter(res.Header))
+			}
+			return err
+		}
+		b, err = ioutil.ReadAll(io.LimitReader(res.Body, maxExternalTOCSize+1))
+		if err != nil {
+			return retryable(ctx, err, 0)
+		}
+		if len(b) > maxExternalTOCSize {
+			return fmt.Errorf("the TOC exceeds %d bytes", maxExternalTOCSize)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h, _, err := v1.SHA256(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if h != l.externalTOC.digest {
+		return nil, fmt.Errorf("digest mismatch: got %s", h)
+	}
+	return b, nil
+}
+
+// appendedReaderAt reads size bytes from ra followed by tail.
+type appendedReaderAt struct {
+	ra   io.ReaderAt
+	size int64
+	tail []byte
+}
+
+func (r *appendedReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	var n int
+	if offset < r.size {
+		head := p
+		if remain := r.size - offset; int64(len(head)) > remain {
+			head = head[:remain]
+		}
+		m, err := r.ra.ReadAt(head, offset)
+		n += m
+		if err != nil && !(err == io.EOF && m == len(head)) {
+			return n, err
+		}
+		p, offset = p[m:], offset+int64(m)
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	tailOffset := offset - r.size
+	if tailOffset >= int64(len(r.tail)) {
+		return n, io.EOF
+	}
+	m := copy(p, r.tail[tailOffset:])
+	n += m
+	if m < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,138 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	gremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// pushExternalTOC pushes an image whose estargz layer has the TOC stored in a separate blob,
+// which is pointed to by the annotation of the key. It returns the digest of the TOC blob.
+func pushExternalTOC(t *testing.T, tr http.RoundTripper, key string, files ...remotetest.File) v1.Hash {
+	t.Helper()
+	blob := remotetest.Layer(t, 0, files...)
+	tocOffset, footerSize, err := estargz.OpenFooter(io.NewSectionReader(bytes.NewReader(blob), 0, int64(len(blob))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, toc := blob[:tocOffset], blob[tocOffset:int64(len(blob))-footerSize]
+
+	tocLayer := layerOf(t, toc)
+	tocDigest, err := tocLayer.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The TOC blob is uploaded to the repository without being referenced by the manifest
+	ref, err := name.ParseReference(remotetest.Reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = gremote.WriteLayer(ref.Context(), tocLayer, gremote.WithTransport(tr)); err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Append(empty.Image,
+		mutate.Addendum{Layer: layerOf(t, data), MediaType: types.OCILayer, Annotations: map[string]string{key: tocDigest.String()}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+	return tocDigest
+}
+
+func layerOf(t *testing.T, b []byte) v1.Layer {
+	t.Helper()
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestExternalTOC(t *testing.T) {
+	for _, key := range []string{remote.ExternalTOCDigestAnnotation, "org.example.toc.digest"} {
+		t.Run(key, func(t *testing.T) {
+			tr := remotetest.NewTransport()
+			tocDigest := pushExternalTOC(t, tr, key, remotetest.File{Name: "hello", Content: "world"})
+
+			var modified bool
+			opts := []remote.Option{remote.WithRequestModifier(func(req *http.Request) error {
+				if strings.HasSuffix(req.URL.Path, tocDigest.String()) {
+					modified = true
+				}
+				return nil
+			})}
+			if key != remote.ExternalTOCDigestAnnotation {
+				opts = append(opts, remote.WithExternalTOCAnnotation(key))
+			}
+			r := remotetest.Open(t, tr, opts...)
+
+			b, err := r.ReadFile(context.Background(), "hello")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "world" {
+				t.Errorf("unexpected content %q", b)
+			}
+			if !modified {
+				t.Error("the request of the TOC isn't modified")
+			}
+		})
+	}
+}
+
+func TestExternalTOCTooLarge(t *testing.T) {
+	inner := remotetest.NewTransport()
+	tocDigest := pushExternalTOC(t, inner, remote.ExternalTOCDigestAnnotation, remotetest.File{Name: "hello", Content: "world"})
+
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.HasSuffix(req.URL.Path, tocDigest.String()) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(io.LimitReader(zeros{}, 1<<30)),
+				Request:    req,
+			}, nil
+		}
+		return inner.RoundTrip(req)
+	})
+	_, err := remotetest.Open(t, tr).ReadFile(context.Background(), "hello")
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("expected the size error, got %v", err)
+	}
+}
+
+// zeros reads endless zeros.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestWithExternalTOCAnnotationEmpty(t *testing.T) {
+	if _, err := remote.New(remotetest.Reference, remote.WithExternalTOCAnnotation("")); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,230 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// CopyFile writes the content of the named file to w, reporting the progress to the callback set by WithProgress.
+func (l *Layer) CopyFile(w io.Writer, name string) (int64, error) {
+	var pr *progress
+	return l.copyFile(w, name, func(size int64) {
+		pr = newProgress(l.progress, size)
+		if size == 0 && pr != nil {
+			// Nothing is written to report the completion of an empty file
+			pr.fn(0, 0)
+		}
+	}, func(written int64) {
+		pr.set(written)
+	})
+}
+
+// copyFile is CopyFile calling start with the size of the file and report with the bytes written so far.
+func (l *Layer) copyFile(w io.Writer, name string, start func(size int64), report func(written int64)) (int64, error) {
+	var written int64
+	err := l.readChunks(name, 0, -1, start, func(_ *estargz.TOCEntry, p []byte) error {
+		n, err := w.Write(p)
+		written += int64(n)
+		report(written)
+		return err
+	})
+	return written, err
+}
+
+// ReadFileRange reads at most length bytes of the named file starting at offset.
+func (l *Layer) ReadFileRange(name string, offset, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+	if length > maxInt || offset > math.MaxInt64-length {
+		return nil, fmt.Errorf("range too large: offset %d, length %d", offset, length)
+	}
+
+	var b []byte
+	err := l.readChunks(name, offset, offset+length, nil, func(_ *estargz.TOCEntry, p []byte) error {
+		b = append(b, p...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readChunks reads [begin, end) of the named file and passes the content to fn chunk by chunk.
+// A negative end means the end of the file. Holes of sparse files are passed as zeros with a nil chunk.
+// The content is in a pooled buffer, so fn must not retain it after returning.
+// start, if not nil, is called with the size of the file once it's looked up, before fn.
+//
+// Each chunk is read by a single ReadAt so that the gzip stream of the chunk is decompressed only once.
+// Chunks of a file live in separate gzip streams, so a range across chunks is read chunk by chunk.
+// Reading the file through small sequential reads would decompress the chunk from its beginning every time.
+func (l *Layer) readChunks(name string, begin, end int64, start func(size int64), fn func(ce *estargz.TOCEntry, p []byte) error) error {
+	// Look up the file without parsing the whole TOC if the layer isn't opened yet
+	if l.canStreamTOC() {
+		chunks, err := l.streamLookup(name)
+		if err == nil {
+			if start != nil {
+				start(chunks[0].entry.Size)
+			}
+			return l.readStreamedChunks(name, chunks, begin, end, fn)
+		} else if !errors.Is(err, errNoFastPath) {
+			return err
+		}
+	}
+
+	esgz, err := l.Open()
+	if err != nil {
+		return err
+	}
+
+	e, ok := esgz.Lookup(name)
+	if !ok {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if e.Type != "reg" {
+		return &os.PathError{Op: "open", Path: name, Err: errors.New("not a regular file")}
+	}
+
+	// estargz doesn't wrap errors of ReadAt, so detect uncached chunks beforehand
+	if l.offline && !l.IsCached(e.Name) {
+		return &os.PathError{Op: "open", Path: name, Err: ErrOffline}
+	}
+
+	sr, err := esgz.OpenFile(e.Name)
+	if err != nil {
+		return err
+	}
+
+	var v estargz.TOCEntryVerifier
+	if l.strict {
+		if v, err = l.strictVerifier(); err != nil {
+			return err
+		}
+	}
+	if start != nil {
+		start(e.Size)
+	}
+
+	return forEachChunk(chunksOf(esgz, e), e.Size, begin, end, func(ce *estargz.TOCEntry, chunkBegin, chunkEnd int64) error {
+		if ce == nil {
+			return readHole(chunkBegin, chunkEnd, fn)
+		}
+
+		readBegin, readEnd := chunkBegin, chunkEnd
+		if v != nil {
+			// The whole chunk is needed to verify it
+			readBegin, readEnd = ce.ChunkOffset, ce.ChunkOffset+ce.ChunkSize
+		}
+
+		bp, err := getBuffer(readEnd - readBegin)
+		if err != nil {
+			return err
+		}
+		defer putBuffer(bp)
+		p := *bp
+		if _, err := sr.ReadAt(p, readBegin); err != nil {
+			return l.budget.wrap(fmt.Errorf("failed to read %s at %d: %w", name, readBegin, err))
+		}
+		if v != nil {
+			if err = verifyChunk(v, name, ce, p); err != nil {
+				return err
+			}
+		}
+		return fn(ce, p[chunkBegin-readBegin:chunkEnd-readBegin])
+	})
+}
+
+// readStreamedChunks is readChunks for the chunks found by streamLookup.
+func (l *Layer) readStreamedChunks(name string, chunks []streamedChunk, begin, end int64, fn func(ce *estargz.TOCEntry, p []byte) error) error {
+	entries := make([]*estargz.TOCEntry, len(chunks))
+	next := make(map[*estargz.TOCEntry]int64, len(chunks))
+	for i, c := range chunks {
+		entries[i] = c.entry
+		next[c.entry] = c.next
+	}
+
+	return forEachChunk(entries, entries[0].Size, begin, end, func(ce *estargz.TOCEntry, chunkBegin, chunkEnd int64) error {
+		if ce == nil {
+			return readHole(chunkBegin, chunkEnd, fn)
+		}
+
+		bp, err := l.readStreamedChunk(ce, next[ce])
+		if err != nil {
+			return fmt.Errorf("failed to read %s at %d: %w", name, chunkBegin, err)
+		}
+		defer putBuffer(bp)
+		return fn(ce, (*bp)[chunkBegin-ce.ChunkOffset:chunkEnd-ce.ChunkOffset])
+	})
+}
+
+// forEachChunk calls fn with the part of each chunk overlapping [begin, end) of the file.
+// A negative end means the end of the file.
+// Sparse files may have holes between their chunks, which are passed to fn with a nil chunk.
+func forEachChunk(chunks []*estargz.TOCEntry, size, begin, end int64, fn func(ce *estargz.TOCEntry, chunkBegin, chunkEnd int64) error) error {
+	if end < 0 || end > size {
+		end = size
+	}
+
+	pos := begin
+	for _, ce := range chunks {
+		chunkBegin, chunkEnd := ce.ChunkOffset, ce.ChunkOffset+ce.ChunkSize
+		if chunkBegin < begin {
+			chunkBegin = begin
+		}
+		if chunkEnd > end {
+			chunkEnd = end
+		}
+		if chunkBegin >= chunkEnd {
+			continue
+		}
+		if pos < chunkBegin {
+			if err := fn(nil, pos, chunkBegin); err != nil {
+				return err
+			}
+		}
+		if err := fn(ce, chunkBegin, chunkEnd); err != nil {
+			return err
+		}
+		pos = chunkEnd
+	}
+	if pos < end {
+		return fn(nil, pos, end)
+	}
+	return nil
+}
+
+// zeros is passed to fn piece by piece for holes of sparse files, which may be far larger than the memory.
+// It must never be written.
+var zeros = make([]byte, 32<<10)
+
+// readHole passes the zeros of the hole in [begin, end) of a sparse file to fn in pieces of at most len(zeros) bytes.
+func readHole(begin, end int64, fn func(ce *estargz.TOCEntry, p []byte) error) error {
+	for pos := begin; pos < end; pos += int64(len(zeros)) {
+		n := end - pos
+		if n > int64(len(zeros)) {
+			n = int64(len(zeros))
+		}
+		if err := fn(nil, zeros[:n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxInt is the maximum value of int.
+// On 32-bit platforms, it is smaller than offsets and sizes in large layers, which are int64.
+const maxInt = int64(^uint(0) >> 1)
+
+// makeBuffer allocates n bytes, failing instead of truncating n when it doesn't fit in int.
+func makeBuffer(n int64) ([]byte, error) {
+	if n < 0 || n > maxInt {
+		return nil, fmt.Errorf("cannot allocate %d bytes on this platform", n)
+	}
+	return make([]byte, n), nil
+}
@@ -0,0 +1,296 @@
+package remote_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// chunkedLayers returns the layers of an image with a file of content split into chunks of chunkSize bytes.
+// The first layer is opened and the second one isn't, so that both ways of looking up the file are exercised.
+func chunkedLayers(t *testing.T, content string, chunkSize int) map[string]*remote.Layer {
+	t.Helper()
+	return openedAndUnopened(t, remotetest.Layer(t, chunkSize, remotetest.File{Name: "file", Content: content}))
+}
+
+// openedAndUnopened returns the layers of an image with the blob twice, the first one opened and the second one not.
+func openedAndUnopened(t *testing.T, blob []byte) map[string]*remote.Layer {
+	t.Helper()
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, blob, blob)
+	layers := layersOf(t, remotetest.Open(t, tr))
+	if _, err := layers[0].Open(); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]*remote.Layer{"opened": layers[0], "unopened": layers[1]}
+}
+
+func TestCopyFileChunked(t *testing.T) {
+	content := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	for name, l := range chunkedLayers(t, string(content), 64) {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := l.CopyFile(&buf, "file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(content)) {
+				t.Errorf("got %d bytes written, want %d", n, len(content))
+			}
+			if !bytes.Equal(buf.Bytes(), content) {
+				t.Error("the reassembled content differs")
+			}
+		})
+	}
+}
+
+func TestReadFileRange(t *testing.T) {
+	content := "0123456789abcdefghij"
+	tests := []struct {
+		name           string
+		offset, length int64
+		want           string
+	}{
+		{name: "within a chunk", offset: 1, length: 2, want: "12"},
+		{name: "across chunks", offset: 3, length: 10, want: "3456789abc"},
+		{name: "whole file", offset: 0, length: 20, want: content},
+		{name: "beyond the end", offset: 15, length: 10, want: "fghij"},
+		{name: "at the end", offset: 20, length: 10, want: ""},
+	}
+	for name, l := range chunkedLayers(t, content, 4) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				b, err := l.ReadFileRange("file", tt.offset, tt.length)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != tt.want {
+					t.Errorf("got %q, want %q", b, tt.want)
+				}
+			})
+		}
+		if _, err := l.ReadFileRange("file", -1, 1); err == nil {
+			t.Errorf("%s: expected an error for a negative offset", name)
+		}
+		if _, err := l.ReadFileRange("missing", 0, 1); err == nil {
+			t.Errorf("%s: expected an error for a missing file", name)
+		}
+	}
+}
+
+func TestReadFileRangeLargeOffsets(t *testing.T) {
+	l := chunkedLayers(t, "small", 0)["opened"]
+
+	// Offsets beyond 2^31 are past the end of the file, not wrapped around
+	b, err := l.ReadFileRange("file", 1<<31, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 0 {
+		t.Errorf("got %q beyond the end of the file", b)
+	}
+	if _, err = l.ReadFileRange("file", math.MaxInt64-5, 10); err == nil {
+		t.Error("expected an error for an overflowing range")
+	}
+}
+
+func TestReadAcrossGzipStreams(t *testing.T) {
+	content := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(content)
+	layers := chunkedLayers(t, string(content), 100)
+
+	// Each chunk is in its own gzip stream
+	esgz, err := layers["opened"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prev int64
+	for off := int64(0); off < int64(len(content)); off += 100 {
+		ce, ok := esgz.ChunkEntryForOffset("file", off)
+		if !ok {
+			t.Fatalf("no chunk at %d", off)
+		}
+		if off > 0 && ce.Offset <= prev {
+			t.Fatalf("the chunk at %d doesn't begin a new gzip stream", off)
+		}
+		prev = ce.Offset
+	}
+
+	for name, l := range layers {
+		for boundary := int64(100); boundary < int64(len(content)); boundary += 100 {
+			b, err := l.ReadFileRange("file", boundary-3, 6)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if !bytes.Equal(b, content[boundary-3:boundary+3]) {
+				t.Errorf("%s: got %x across %d, want %x", name, b, boundary, content[boundary-3:boundary+3])
+			}
+		}
+		// Across all the streams
+		b, err := l.ReadFileRange("file", 50, 900)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(b, content[50:950]) {
+			t.Errorf("%s: the content across all the streams differs", name)
+		}
+	}
+}
+
+// sparseLayer builds an estargz layer with a file of content split into chunks of chunkSize bytes,
+// and removes the chunks at the offsets from the TOC so that the file has holes there as a sparse file.
+func sparseLayer(t *testing.T, content string, chunkSize int, holes ...int64) []byte {
+	t.Helper()
+	blob := remotetest.Layer(t, chunkSize, remotetest.File{Name: "file", Content: content})
+	tocOffset, footerSize, err := estargz.OpenFooter(io.NewSectionReader(bytes.NewReader(blob), 0, int64(len(blob))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	footer := blob[int64(len(blob))-footerSize:]
+
+	gz, err := gzip.NewReader(bytes.NewReader(blob[tocOffset : int64(len(blob))-footerSize]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	if _, err = tr.Next(); err != nil {
+		t.Fatal(err)
+	}
+	var toc estargz.JTOC
+	if err = json.NewDecoder(tr).Decode(&toc); err != nil {
+		t.Fatal(err)
+	}
+	var entries []*estargz.TOCEntry
+	for _, e := range toc.Entries {
+		removed := false
+		for _, off := range holes {
+			removed = removed || (e.Type == "chunk" && e.ChunkOffset == off)
+		}
+		if !removed {
+			entries = append(entries, e)
+		}
+	}
+	toc.Entries = entries
+	tocJSON, err := json.Marshal(toc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The TOC is at the same offset, so the footer is kept
+	sparse := bytes.NewBuffer(append([]byte(nil), blob[:tocOffset]...))
+	gw := gzip.NewWriter(sparse)
+	tw := tar.NewWriter(gw)
+	if err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: estargz.TOCTarName, Size: int64(len(tocJSON))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tw.Write(tocJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sparse.Write(footer)
+	return sparse.Bytes()
+}
+
+func TestSparseFile(t *testing.T) {
+	const chunkSize = 16
+	content := strings.Repeat("0123456789abcdef", 4)
+	// The second chunk is a hole, and so is the last one at the end of the file
+	want := content[:16] + strings.Repeat("\x00", 16) + content[32:48] + strings.Repeat("\x00", 16)
+
+	for name, l := range openedAndUnopened(t, sparseLayer(t, content, chunkSize, 16, 48)) {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := l.CopyFile(&buf, "file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(want)) || buf.String() != want {
+				t.Errorf("got %q, want %q", buf.String(), want)
+			}
+
+			for _, r := range []struct{ offset, length int64 }{{10, 12}, {20, 8}, {30, 30}} {
+				b, err := l.ReadFileRange("file", r.offset, r.length)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if w := want[r.offset : r.offset+r.length]; string(b) != w {
+					t.Errorf("range %d+%d: got %q, want %q", r.offset, r.length, b, w)
+				}
+			}
+		})
+	}
+}
+
+func TestReadFileRangeConcurrent(t *testing.T) {
+	content := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	for name, l := range chunkedLayers(t, string(content), 256) {
+		t.Run(name, func(t *testing.T) {
+			// Results are checked once all reads are done, so that a buffer reused by another read would show up.
+			results := make([][]byte, 64)
+			var wg sync.WaitGroup
+			for i := range results {
+				i := i
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					b, err := l.ReadFileRange("file", int64(i*64), 300)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					results[i] = b
+				}()
+			}
+			wg.Wait()
+			for i, b := range results {
+				begin := i * 64
+				end := begin + 300
+				if end > len(content) {
+					end = len(content)
+				}
+				if !bytes.Equal(b, content[begin:end]) {
+					t.Errorf("range at %d differs", begin)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadFileRange(b *testing.B) {
+	content := strings.Repeat("x", 1<<16)
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(b, tr, remotetest.Layer(b, 4096, remotetest.File{Name: "file", Content: content}))
+	l := layersOf(b, remotetest.Open(b, tr))[0]
+	if _, err := l.ReadFileRange("file", 0, 1<<16); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := l.ReadFileRange("file", 0, 1<<16); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
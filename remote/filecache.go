@@ -0,0 +1,84 @@
+package remote
+
+import (
+	"container/list"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// FileCache caches whole file contents read by ReadFile keyed by the image manifest digest and the path.
+// An image pinned by its manifest digest is immutable, so the cached content never gets stale.
+// Unlike the chunk and the disk caches, a hit serves the content without fetching or decompressing anything.
+// It can be shared by multiple Remotes with WithFileCache.
+// The least recently used files are evicted when the total size exceeds the limit.
+type FileCache struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	ll    *list.List // *fileCacheEntry, the front is the most recently used
+	items map[fileCacheKey]*list.Element
+}
+
+type fileCacheKey struct {
+	image v1.Hash
+	path  string
+}
+
+type fileCacheEntry struct {
+	key  fileCacheKey
+	data []byte
+}
+
+// NewFileCache returns a FileCache holding at most maxBytes of file contents.
+func NewFileCache(maxBytes int64) *FileCache {
+	return &FileCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    map[fileCacheKey]*list.Element{},
+	}
+}
+
+// Size returns the total size of the cached files.
+func (c *FileCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// get returns a copy of the cached content so that callers can't modify the cache.
+func (c *FileCache) get(key fileCacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	data := elem.Value.(*fileCacheEntry).data
+	return append([]byte(nil), data...), true
+}
+
+// add caches the content, which must not be modified afterwards. Files larger than the limit are not cached.
+func (c *FileCache) add(key fileCacheKey, data []byte) {
+	if int64(len(data)) > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; ok {
+		return
+	}
+	c.items[key] = c.ll.PushFront(&fileCacheEntry{key: key, data: data})
+	c.size += int64(len(data))
+	for c.size > c.maxBytes {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		entry := oldest.Value.(*fileCacheEntry)
+		delete(c.items, entry.key)
+		c.size -= int64(len(entry.data))
+	}
+}
@@ -0,0 +1,96 @@
+package remote_test
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/containerd/stargz-snapshotter/estargz/zstdchunked"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// countingDecompressor counts the chunks decompressed by the decompressor.
+type countingDecompressor struct {
+	estargz.Decompressor
+	n int32
+}
+
+func (d *countingDecompressor) Reader(r io.Reader) (io.ReadCloser, error) {
+	atomic.AddInt32(&d.n, 1)
+	return d.Decompressor.Reader(r)
+}
+
+func (d *countingDecompressor) count() int {
+	return int(atomic.LoadInt32(&d.n))
+}
+
+func TestFileCache(t *testing.T) {
+	// The layer is decompressed by the counting decompressor registered for its media type
+	const mediaType = "application/vnd.example.layer.v1.tar+zstd-counted"
+	d := &countingDecompressor{Decompressor: new(zstdchunked.Decompressor)}
+	remote.RegisterDecompressor(mediaType, d)
+	tr := &countingTransport{inner: remotetest.NewTransport()}
+	pushZstd(t, tr, mediaType,
+		remotetest.File{Name: "a", Content: "aaaa"},
+		remotetest.File{Name: "b", Content: "bbbb"},
+		remotetest.File{Name: "c", Content: "cccc"},
+		remotetest.File{Name: "large", Content: "larger than the cache"},
+	)
+
+	cache := remote.NewFileCache(10)
+	// read reads the file with a new Remote, returning the requests and the decompressions of the read
+	read := func(p string) (requests, decompressions int) {
+		t.Helper()
+		r := remotetest.Open(t, tr, remote.WithFileCache(cache))
+		n, m := tr.count(), d.count()
+		b, err := r.ReadFile(context.Background(), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"a": "aaaa", "b": "bbbb", "c": "cccc", "large": "larger than the cache"}[p]
+		if string(b) != want {
+			t.Errorf("%s: got %q, want %q", p, b, want)
+		}
+		// The caller owns the content
+		b[0] = 'x'
+		return tr.count() - n, d.count() - m
+	}
+
+	if requests, decompressions := read("a"); requests == 0 || decompressions == 0 {
+		t.Errorf("the first read sent %d requests and decompressed %d times", requests, decompressions)
+	}
+	if requests, decompressions := read("a"); requests != 0 || decompressions != 0 {
+		t.Errorf("the second read sent %d requests and decompressed %d times", requests, decompressions)
+	}
+	if size := cache.Size(); size != 4 {
+		t.Errorf("got size %d, want 4", size)
+	}
+
+	// b is evicted by c as the least recently used one
+	read("b")
+	read("a")
+	read("c")
+	if size := cache.Size(); size != 8 {
+		t.Errorf("got size %d, want 8", size)
+	}
+	if _, decompressions := read("a"); decompressions != 0 {
+		t.Error("a was evicted")
+	}
+	if _, decompressions := read("b"); decompressions == 0 {
+		t.Error("b was not evicted")
+	}
+
+	// A file larger than the cache isn't cached
+	read("large")
+	if _, decompressions := read("large"); decompressions == 0 {
+		t.Error("the large file was cached")
+	}
+
+	if _, err := remote.New(remotetest.Reference, remote.WithTransport(tr), remote.WithFileCache(nil)); err == nil {
+		t.Error("expected an error for a nil cache")
+	}
+}
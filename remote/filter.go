@@ -0,0 +1,81 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// maxFilterLineLength is the length of a line ReadFileFiltered matches at most.
+// The rest of a longer line, e.g. of a minified file, is dropped so that it doesn't have to be buffered.
+const maxFilterLineLength = 1 << 20
+
+// errEnoughMatches stops reading chunks once ReadFileFilteredN has got the matches.
+var errEnoughMatches = errors.New("enough matches")
+
+// ReadFileFiltered returns the lines of the file at the path in the merged view which match re, without the newlines.
+// The file is streamed chunk by chunk without holding the whole content.
+func (r Remote) ReadFileFiltered(ctx context.Context, p string, re *regexp.Regexp) ([]string, error) {
+	return r.ReadFileFilteredN(ctx, p, re, -1)
+}
+
+// ReadFileFilteredN is ReadFileFiltered returning at most n lines. n < 0 means no limit.
+// The remaining chunks are not fetched once n lines have matched, e.g. to find the first error in a large log.
+// Lines longer than 1MiB are matched and returned truncated.
+func (r Remote) ReadFileFilteredN(ctx context.Context, p string, re *regexp.Regexp, n int) ([]string, error) {
+	l, e, err := r.Find(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []string{}
+	if n == 0 {
+		return matches, nil
+	}
+
+	var line []byte
+	match := func() error {
+		if re.Match(line) {
+			matches = append(matches, string(line))
+		}
+		line = line[:0]
+		if len(matches) == n {
+			return errEnoughMatches
+		}
+		return nil
+	}
+	err = l.readChunks(e.Name, 0, -1, nil, func(_ *estargz.TOCEntry, p []byte) error {
+		for len(p) > 0 {
+			i := bytes.IndexByte(p, '\n')
+			if i < 0 {
+				line = appendLine(line, p)
+				return nil
+			}
+			line = appendLine(line, p[:i])
+			p = p[i+1:]
+			if err := match(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && len(line) > 0 {
+		// The last line without a trailing newline
+		err = match()
+	}
+	if err != nil && err != errEnoughMatches {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// appendLine appends p to the line up to maxFilterLineLength.
+func appendLine(line, p []byte) []byte {
+	if rest := maxFilterLineLength - len(line); len(p) > rest {
+		p = p[:rest]
+	}
+	return append(line, p...)
+}
@@ -0,0 +1,89 @@
+package remote_test
+
+import (
+	"context"
+	"encoding/hex"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestReadFileFiltered(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+	tr := remotetest.NewTransport()
+	// Chunks of 8 bytes split most of the lines, while the long line spans fewer chunks of 64KiB
+	remotetest.PushLayers(t, tr,
+		remotetest.Layer(t, 8,
+			remotetest.File{Name: "log", Content: "info: start\nerror: disk full\ninfo: retry\nerror: again\nerror: no newline"},
+			remotetest.File{Name: "empty"},
+		),
+		remotetest.Layer(t, 64<<10, remotetest.File{Name: "long", Content: "short x\n" + long + "tail x\nend x\n"}),
+	)
+	r := remotetest.Open(t, tr)
+
+	tests := []struct {
+		path    string
+		pattern string
+		n       int
+		want    []string
+	}{
+		{path: "log", pattern: "^error", n: -1, want: []string{"error: disk full", "error: again", "error: no newline"}},
+		{path: "log", pattern: "^error", n: 2, want: []string{"error: disk full", "error: again"}},
+		{path: "log", pattern: "^error", n: 0, want: []string{}},
+		{path: "log", pattern: "debug", n: -1, want: []string{}},
+		// The line longer than 1MiB is matched without the rest
+		{path: "long", pattern: "x$", n: -1, want: []string{"short x", long, "end x"}},
+		{path: "empty", pattern: "", n: -1, want: []string{}},
+	}
+	for _, tt := range tests {
+		got, err := r.ReadFileFilteredN(context.Background(), tt.path, regexp.MustCompile(tt.pattern), tt.n)
+		if err != nil {
+			t.Fatalf("%s %q: %v", tt.path, tt.pattern, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q %d: got %d lines %.100q, want %d lines", tt.path, tt.pattern, tt.n, len(got), got, len(tt.want))
+		}
+	}
+
+	got, err := r.ReadFileFiltered(context.Background(), "log", regexp.MustCompile("^info"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"info: start", "info: retry"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err = r.ReadFileFiltered(context.Background(), "missing", regexp.MustCompile("")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestReadFileFilteredStopsEarly(t *testing.T) {
+	// Random lines barely compress, so the file spans many chunks in the blob
+	rnd := rand.New(rand.NewSource(1))
+	var sb strings.Builder
+	line := make([]byte, 32)
+	for sb.Len() < 8<<20 {
+		rnd.Read(line)
+		sb.WriteString(hex.EncodeToString(line) + "\n")
+	}
+	content := sb.String()
+	tr := &bytesTransport{inner: remotetest.NewTransport()}
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 1<<20, remotetest.File{Name: "log", Content: content}))
+	r := remotetest.Open(t, tr)
+
+	got, err := r.ReadFileFilteredN(context.Background(), "log", regexp.MustCompile("^[0-9a-f]"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := content[:64]; len(got) != 1 || got[0] != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// The first chunk is read with up to 2MiB of the blob, as estargz does, besides the TOC
+	if n := tr.bytes(); n > 3<<20 {
+		t.Errorf("expected only the first chunk to be fetched, got %d bytes", n)
+	}
+}
@@ -0,0 +1,75 @@
+package remote
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// FlatView is the merged view of the image resolved once, as if it were a single flattened layer.
+// Lookups are answered from the index without walking the layers again.
+type FlatView struct {
+	entries  map[string]flatEntry
+	children map[string][]string // directory -> sorted base names
+}
+
+type flatEntry struct {
+	layer *Layer
+	entry *estargz.TOCEntry
+}
+
+// Flatten resolves the merged view of the image, applying whiteouts, into a FlatView.
+// It parses the TOCs of all layers.
+func (r Remote) Flatten(ctx context.Context) (*FlatView, error) {
+	v := &FlatView{
+		entries:  map[string]flatEntry{},
+		children: map[string][]string{},
+	}
+	err := r.Walk(ctx, func(l *Layer, e *estargz.TOCEntry) error {
+		v.entries[e.Name] = flatEntry{layer: l, entry: e}
+		if e.Name != "" {
+			dir := path.Dir(e.Name)
+			if dir == "." {
+				dir = ""
+			}
+			v.children[dir] = append(v.children[dir], path.Base(e.Name))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, names := range v.children {
+		sort.Strings(names)
+	}
+	return v, nil
+}
+
+// Lookup returns the entry of the path and the layer containing it.
+// It returns ErrNotFound if the path doesn't exist in the merged view.
+func (v *FlatView) Lookup(p string) (*Layer, *estargz.TOCEntry, error) {
+	fe, ok := v.entries[cleanPath(p)]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	return fe.layer, fe.entry, nil
+}
+
+// ReadDir returns the sorted base names of the entries in the directory.
+// It returns ErrNotFound if the directory doesn't exist in the merged view.
+func (v *FlatView) ReadDir(dir string) ([]string, error) {
+	dir = cleanPath(dir)
+	fe, ok := v.entries[dir]
+	if !ok || fe.entry.Type != "dir" {
+		return nil, ErrNotFound
+	}
+	return v.children[dir], nil
+}
+
+// Len returns the number of entries including the root directory.
+func (v *FlatView) Len() int {
+	return len(v.entries)
+}
@@ -0,0 +1,63 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+func TestFlatten(t *testing.T) {
+	r := newRemote(t, overlayLayers)
+	ctx := context.Background()
+	v, err := r.Flatten(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flattened lookups match the resolution of each lookup
+	for _, p := range []string{"", "etc", "/etc/os-release", "etc/removed", "etc/missing", "var", "var/lib", "var/lib/data"} {
+		wantLayer, wantEntry, wantErr := r.Find(ctx, p)
+		gotLayer, gotEntry, gotErr := v.Lookup(p)
+		if !errors.Is(gotErr, wantErr) {
+			t.Errorf("%q: got %v, want %v", p, gotErr, wantErr)
+			continue
+		}
+		if wantErr != nil {
+			continue
+		}
+		if gotLayer.Index() != wantLayer.Index() || gotEntry.Name != wantEntry.Name {
+			t.Errorf("%q: got %s in layer %d, want %s in layer %d", p, gotEntry.Name, gotLayer.Index(), wantEntry.Name, wantLayer.Index())
+		}
+	}
+
+	tests := []struct {
+		dir  string
+		want []string
+	}{
+		{dir: "/", want: []string{"etc", "var"}},
+		{dir: "etc", want: []string{"os-release"}},
+		{dir: "var", want: nil},
+	}
+	for _, tt := range tests {
+		got, err := v.ReadDir(tt.dir)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.dir, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+	for _, dir := range []string{"etc/os-release", "var/lib"} {
+		if _, err = v.ReadDir(dir); !errors.Is(err, remote.ErrNotFound) {
+			t.Errorf("%s: got %v, want ErrNotFound", dir, err)
+		}
+	}
+
+	// The root directory, etc, etc/os-release and var
+	if n := v.Len(); n != 4 {
+		t.Errorf("got %d entries, want 4", n)
+	}
+}
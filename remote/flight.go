@@ -0,0 +1,119 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// readShared is readRange shared by concurrent identical reads of the blob,
+// e.g. the footer read by estargz.Open of two layers of the same digest returned by separate Layers calls.
+// Every caller gets its own copy since p may be modified after ReadAt returns.
+func (l *Layer) readShared(p []byte, offset int64) error {
+	key := fmt.Sprintf("%s@%d+%d", l.digest, offset, len(p))
+	return l.flight.do(l.ctx, key, p, func(ctx context.Context, buf []byte) error {
+		return l.readRange(ctx, buf, offset)
+	})
+}
+
+// readFlight shares concurrent identical reads between the layers of a Remote.
+// A shared read runs on a context detached from every caller, so that canceling the context of the layer
+// which happened to start it doesn't fail the others. Each caller stops waiting once its own context is done,
+// and the read is canceled once no caller is waiting for it.
+type readFlight struct {
+	mu    sync.Mutex
+	calls map[string]*readCall
+}
+
+// readCall is a read in flight.
+type readCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int // guarded by readFlight.mu
+
+	finished bool // guarded by readFlight.mu
+	buf      *[]byte
+	err      error
+}
+
+func newReadFlight() *readFlight {
+	return &readFlight{calls: map[string]*readCall{}}
+}
+
+// do fills p by fn, or with the result of the identical read in flight.
+// The bytes are read into a pooled buffer, which is returned to the pool by the last caller copying it.
+func (f *readFlight) do(ctx context.Context, key string, p []byte, fn func(ctx context.Context, buf []byte) error) error {
+	f.mu.Lock()
+	c, ok := f.calls[key]
+	if !ok {
+		c = f.start(key, int64(len(p)), fn)
+	}
+	c.waiters++
+	f.mu.Unlock()
+
+	select {
+	case <-c.done:
+		if c.err == nil {
+			copy(p, *c.buf)
+		}
+		f.leave(key, c)
+		return c.err
+	case <-ctx.Done():
+		f.leave(key, c)
+		return ctx.Err()
+	}
+}
+
+// start starts the read of n bytes by fn in the background. It must be called with f.mu held.
+func (f *readFlight) start(key string, n int64, fn func(ctx context.Context, buf []byte) error) *readCall {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &readCall{done: make(chan struct{}), cancel: cancel}
+	f.calls[key] = c
+
+	go func() {
+		defer cancel()
+		bp, err := getBuffer(n)
+		if err == nil {
+			if err = fn(ctx, *bp); err != nil {
+				putBuffer(bp)
+				bp = nil
+			}
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.calls[key] == c {
+			delete(f.calls, key)
+		}
+		c.buf, c.err, c.finished = bp, err, true
+		close(c.done)
+		if c.waiters == 0 && bp != nil {
+			// Every caller has given up
+			putBuffer(bp)
+		}
+	}()
+	return c
+}
+
+// leave marks that a caller stops waiting for the call.
+// The last caller returns the buffer to the pool, or cancels the read if it hasn't finished.
+func (f *readFlight) leave(key string, c *readCall) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+	if !c.finished {
+		// Later callers start another read instead of joining the canceled one
+		if f.calls[key] == c {
+			delete(f.calls, key)
+		}
+		c.cancel()
+		return
+	}
+	if c.buf != nil {
+		putBuffer(c.buf)
+		c.buf = nil
+	}
+}
@@ -0,0 +1,70 @@
+package remote_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// TestSharedReadLeaderCanceled opens the same layer through two Layers calls of a Remote concurrently
+// and cancels the context of the first one while its range requests are in flight.
+func TestSharedReadLeaderCanceled(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"}))
+
+	var requests int32
+	started := make(chan struct{}, 16)
+	release := make(chan struct{})
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if isBlobRange(req) && !isProbe(req) {
+			atomic.AddInt32(&requests, 1)
+			started <- struct{}{}
+			select {
+			case <-release:
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+		return inner.RoundTrip(req)
+	})
+	r := remotetest.Open(t, tr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	la, err := r.Layers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb := layersOf(t, r)
+
+	leader := make(chan error, 1)
+	go func() {
+		_, err := la[0].Open()
+		leader <- err
+	}()
+	<-started // the footer is being fetched for the leader
+
+	follower := make(chan error, 1)
+	go func() {
+		_, err := lb[0].Open()
+		follower <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // let the follower join the read of the footer
+
+	cancel()
+	if err := <-leader; err == nil {
+		t.Error("expected the leader to fail")
+	}
+	close(release)
+	if err := <-follower; err != nil {
+		t.Fatalf("the follower fails with the leader: %v", err)
+	}
+
+	// The footer and the TOC are fetched once each
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected 2 range requests, got %d", n)
+	}
+}
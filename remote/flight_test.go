@@ -0,0 +1,146 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadFlightShared(t *testing.T) {
+	f := newReadFlight()
+	release := make(chan struct{})
+	var calls int32
+	fn := func(ctx context.Context, buf []byte) error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		copy(buf, "data")
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 4)
+	for i := range results {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := make([]byte, 4)
+			if err := f.do(context.Background(), "key", p, fn); err != nil {
+				t.Error(err)
+			}
+			results[i] = string(p)
+		}()
+	}
+	waitWaiters(t, f, "key", len(results))
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expected a single read, got %d", n)
+	}
+	for _, r := range results {
+		if r != "data" {
+			t.Errorf("unexpected result %q", r)
+		}
+	}
+}
+
+func TestReadFlightLeaderCanceled(t *testing.T) {
+	f := newReadFlight()
+	release := make(chan struct{})
+	readErr := make(chan error, 1)
+	fn := func(ctx context.Context, buf []byte) error {
+		<-release
+		readErr <- ctx.Err()
+		copy(buf, "data")
+		return nil
+	}
+
+	// The leader gives up while the read is in flight
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error)
+	go func() {
+		leader <- f.do(ctx, "key", make([]byte, 4), fn)
+	}()
+	waitWaiters(t, f, "key", 1)
+
+	follower := make(chan error)
+	p := make([]byte, 4)
+	go func() {
+		follower <- f.do(context.Background(), "key", p, fn)
+	}()
+	waitWaiters(t, f, "key", 2)
+
+	cancel()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the leader to stop waiting, got %v", err)
+	}
+	close(release)
+	if err := <-follower; err != nil {
+		t.Fatal(err)
+	}
+	if string(p) != "data" {
+		t.Errorf("unexpected result %q", p)
+	}
+	if err := <-readErr; err != nil {
+		t.Errorf("the shared read is canceled with the leader: %v", err)
+	}
+}
+
+func TestReadFlightAbandoned(t *testing.T) {
+	f := newReadFlight()
+	canceled := make(chan struct{})
+	fn := func(ctx context.Context, buf []byte) error {
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- f.do(ctx, "key", make([]byte, 4), fn)
+	}()
+	waitWaiters(t, f, "key", 1)
+	cancel()
+	<-done
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the read isn't canceled after every caller gave up")
+	}
+
+	// A later caller starts another read
+	p := make([]byte, 4)
+	err := f.do(context.Background(), "key", p, func(ctx context.Context, buf []byte) error {
+		copy(buf, "next")
+		return nil
+	})
+	if err != nil || string(p) != "next" {
+		t.Errorf("got %q, %v", p, err)
+	}
+}
+
+// waitWaiters waits until n callers wait for the read of the key.
+func waitWaiters(t *testing.T, f *readFlight, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		c, ok := f.calls[key]
+		waiters := 0
+		if ok {
+			waiters = c.waiters
+		}
+		f.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d callers don't wait for %s", n, key)
+}
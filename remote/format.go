@@ -0,0 +1,207 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/containerd/stargz-snapshotter/estargz/zstdchunked"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Format is the compression format of a layer blob.
+type Format string
+
+const (
+	// FormatUnknown is a layer which can't be read lazily, such as an uncompressed tar.
+	FormatUnknown Format = ""
+
+	// FormatGzip is a gzip-compressed tar layer. It can be opened as estargz if it was built as such.
+	FormatGzip Format = "gzip"
+
+	// FormatZstd is a zstd-compressed tar layer. It can be opened as estargz if it was built with a TOC as zstd:chunked.
+	FormatZstd Format = "zstd"
+
+	// FormatCustom is a layer of a media type registered by RegisterDecompressor.
+	FormatCustom Format = "custom"
+)
+
+// ociLayerZstd is the media type of zstd-compressed OCI layers, which go-containerregistry doesn't define yet.
+const ociLayerZstd types.MediaType = "application/vnd.oci.image.layer.v1.tar+zstd"
+
+// mediaTypeFormats maps layer media types to their formats.
+// Both the OCI and the Docker media types are listed
+// since images built by older tools carry estargz layers with the Docker media type.
+// Foreign layers, e.g. Windows base layers, are not listed: their blobs are served from the URLs
+// in their descriptors instead of the registry, and they are plain gzip-compressed tars anyway.
+var mediaTypeFormats = map[types.MediaType]Format{
+	types.OCILayer:           FormatGzip,
+	types.OCIRestrictedLayer: FormatGzip,
+	types.DockerLayer:        FormatGzip,
+	ociLayerZstd:             FormatZstd,
+}
+
+// formatOf returns the format of the given layer media type.
+// Media types registered by RegisterDecompressor take precedence over the known ones.
+func formatOf(mt types.MediaType) Format {
+	if _, ok := registeredDecompressor(mt); ok {
+		return FormatCustom
+	}
+	return mediaTypeFormats[mt]
+}
+
+// IsEStargz reports whether any layer of the image is estargz, judging from the media types and the annotations
+// of the layers in the manifest without fetching the layers. Layers converted by tools such as ctr-remote
+// carry the TOC digest annotation.
+func (r Remote) IsEStargz(ctx context.Context) (bool, error) {
+	manifest, err := r.image.Manifest()
+	if err != nil {
+		return false, err
+	}
+	for _, desc := range manifest.Layers {
+		if formatOf(desc.MediaType) == FormatUnknown {
+			continue
+		}
+		for _, key := range []string{estargz.TOCJSONDigestAnnotation, r.opts.externalTOCAnnotation, zstdchunked.ZstdChunkedManifestChecksumAnnotation} {
+			if _, ok := desc.Annotations[key]; ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// decompressors returns the decompressors to open the layer with in addition to gzip, which estargz always tries.
+func (l *Layer) decompressors() []estargz.Decompressor {
+	if l.format == FormatGzip {
+		return nil
+	}
+	return []estargz.Decompressor{l.decompressor()}
+}
+
+// decompressor returns the decompressor of the chunks of the layer.
+func (l *Layer) decompressor() estargz.Decompressor {
+	switch l.format {
+	case FormatZstd:
+		return new(zstdchunked.Decompressor)
+	case FormatCustom:
+		if d, ok := registeredDecompressor(l.mediaType); ok {
+			return d
+		}
+	}
+	return new(estargz.GzipDecompressor)
+}
+
+// Variant is the variant of the stargz format a layer is built with.
+type Variant string
+
+const (
+	// VariantEStargz is the current eStargz format with the 51-byte footer.
+	VariantEStargz Variant = "estargz"
+
+	// VariantLegacyStargz is the original stargz format with the 47-byte footer.
+	VariantLegacyStargz Variant = "stargz"
+
+	// VariantZstdChunked is the eStargz format compressed with zstd, known as zstd:chunked.
+	VariantZstdChunked Variant = "zstdchunked"
+)
+
+// Variant detects the variant of the layer from the size of its footer.
+// estargz.Open accepts both variants, but they differ in what they can do,
+// e.g. legacy stargz layers have no chunk digests to verify.
+func (l *Layer) Variant() (Variant, error) {
+	if l.externalTOC != nil {
+		return VariantEStargz, nil
+	}
+	switch l.Format() {
+	case FormatZstd:
+		if _, _, err := l.parseFooter(); err != nil {
+			return "", err
+		}
+		return VariantZstdChunked, nil
+	case FormatCustom:
+		// The footer is defined by the registered decompressor
+		if _, _, err := l.parseFooter(); err != nil {
+			return "", err
+		}
+		return VariantEStargz, nil
+	}
+
+	_, footerSize, err := estargz.OpenFooter(l.footerSection())
+	if err != nil {
+		return "", err
+	}
+	if footerSize == estargz.FooterSize {
+		return VariantEStargz, nil
+	}
+	return VariantLegacyStargz, nil
+}
+
+// parseFooter parses the footer of the layer with its decompressor and returns the offset and the size of the TOC.
+// Unlike estargz.OpenFooter, it isn't limited to gzip.
+func (l *Layer) parseFooter() (tocOffset, tocSize int64, err error) {
+	d := l.decompressor()
+	if l.size < d.FooterSize() {
+		return 0, 0, fmt.Errorf("blob size %d is smaller than the footer size", l.size)
+	}
+	footer := make([]byte, d.FooterSize())
+	if _, err := l.footerSection().ReadAt(footer, l.size-d.FooterSize()); err != nil {
+		return 0, 0, err
+	}
+	if tocOffset, tocSize, err = d.ParseFooter(footer); err != nil {
+		return 0, 0, err
+	}
+	if tocSize <= 0 {
+		tocSize = l.size - tocOffset - d.FooterSize()
+	}
+	return tocOffset, tocSize, nil
+}
+
+// footerSection returns the blob for parsing the footer.
+// Once the layer is opened, the end of the blob read by estargz.Open is served from memory
+// so that the footer isn't fetched again.
+func (l *Layer) footerSection() *io.SectionReader {
+	tail, _ := l.tail.Load().([]byte)
+	if len(tail) == 0 {
+		return io.NewSectionReader(l, 0, l.size)
+	}
+	n := int64(len(tail))
+	return io.NewSectionReader(&appendedReaderAt{ra: l, size: l.size - n, tail: tail}, 0, l.size)
+}
+
+// tailRecorder is an io.ReaderAt keeping the longest read reaching the end of the blob,
+// which holds the footer read by estargz.Open.
+// With suffix set, it also keeps the reads joining the recorded end, such as the TOC read after the footer,
+// so that the end of the blob from the TOC is recorded.
+type tailRecorder struct {
+	ra     io.ReaderAt
+	size   int64
+	suffix bool
+
+	mu   sync.Mutex
+	tail []byte
+}
+
+func (r *tailRecorder) ReadAt(p []byte, offset int64) (int, error) {
+	n, err := r.ra.ReadAt(p, offset)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	start := r.size - int64(len(r.tail))
+	switch {
+	case offset+int64(n) == r.size:
+		if n > len(r.tail) {
+			r.tail = append([]byte(nil), p[:n]...)
+		}
+	case r.suffix && len(r.tail) > 0 && offset < start && offset+int64(n) >= start:
+		r.tail = append(append([]byte(nil), p[:start-offset]...), r.tail...)
+	}
+	return n, err
+}
+
+func (r *tailRecorder) bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tail
+}
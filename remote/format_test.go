@@ -0,0 +1,479 @@
+package remote_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/containerd/stargz-snapshotter/estargz/zstdchunked"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestForeignLayersSkipped(t *testing.T) {
+	img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "hello", Content: "world"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := random.Layer(1024, types.DockerForeignLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img, err = mutate.Append(img, mutate.Addendum{Layer: foreign, MediaType: types.DockerForeignLayer}); err != nil {
+		t.Fatal(err)
+	}
+	tr := remotetest.NewTransport()
+	if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]remote.Option{nil, {remote.WithForceFormat(remote.FormatGzip)}} {
+		r := remotetest.Open(t, tr, opts...)
+		layers := layersOf(t, r)
+		if len(layers) != 1 || layers[0].Index() != 0 {
+			t.Fatalf("expected only the estargz layer, got %d layers", len(layers))
+		}
+		b, err := r.ReadFile(context.Background(), "hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "world" {
+			t.Errorf("unexpected content %q", b)
+		}
+	}
+}
+
+func TestMixedMediaTypes(t *testing.T) {
+	img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "lower", Content: "lower"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped := map[string]bool{}
+	for _, mt := range []types.MediaType{"application/vnd.in-toto+json", types.OCIUncompressedLayer} {
+		l, err := random.Layer(1024, mt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dgst, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		skipped[dgst.String()] = true
+		if img, err = mutate.Append(img, mutate.Addendum{Layer: l, MediaType: mt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(remotetest.Layer(t, 0, remotetest.File{Name: "upper", Content: "upper"}))), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img, err = mutate.Append(img, mutate.Addendum{Layer: layer, MediaType: types.OCILayer}); err != nil {
+		t.Fatal(err)
+	}
+	inner := remotetest.NewTransport()
+	if err = remotetest.Push(inner, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+
+	// The skipped layers are not even probed
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if skipped[path.Base(req.URL.Path)] {
+			t.Errorf("unexpected request to a skipped layer: %s %s", req.Method, req.URL.Path)
+		}
+		return inner.RoundTrip(req)
+	})
+	r := remotetest.Open(t, tr)
+	var indexes []int
+	for _, l := range layersOf(t, r) {
+		indexes = append(indexes, l.Index())
+	}
+	if want := []int{0, 3}; !reflect.DeepEqual(indexes, want) {
+		t.Errorf("got layers %v, want %v", indexes, want)
+	}
+	for _, p := range []string{"lower", "upper"} {
+		if _, err = r.ReadFile(context.Background(), p); err != nil {
+			t.Errorf("%s: %v", p, err)
+		}
+	}
+}
+
+func TestDockerMediaType(t *testing.T) {
+	blob := remotetest.Layer(t, 0, remotetest.File{Name: "hello", Content: "docker"})
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(blob)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := mutate.MediaType(empty.Image, types.DockerManifestSchema2)
+	if img, err = mutate.Append(img, mutate.Addendum{Layer: layer, MediaType: types.DockerLayer}); err != nil {
+		t.Fatal(err)
+	}
+	tr := remotetest.NewTransport()
+	if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+
+	layers, err := remotetest.Open(t, tr).Layers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 {
+		t.Fatalf("got %d layers, want 1", len(layers))
+	}
+	if f := layers[0].Format(); f != remote.FormatGzip {
+		t.Errorf("got format %s, want %s", f, remote.FormatGzip)
+	}
+	esgz, err := layers[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr, err := esgz.OpenFile("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "docker" {
+		t.Errorf("unexpected content %q", b)
+	}
+}
+
+func TestDockerLayerFormat(t *testing.T) {
+	for mt, want := range map[types.MediaType]remote.Format{
+		types.OCILayer:    remote.FormatGzip,
+		types.DockerLayer: remote.FormatGzip,
+	} {
+		img, err := remotetest.NewImage(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blob := remotetest.Layer(t, 0, remotetest.File{Name: "hello", Content: "world"})
+		layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(blob)), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img, err = mutate.Append(img, mutate.Addendum{Layer: layer, MediaType: mt}); err != nil {
+			t.Fatal(err)
+		}
+		tr := remotetest.NewTransport()
+		if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+			t.Fatal(err)
+		}
+		layers, err := remotetest.Open(t, tr).Layers(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := layers[0].Format(); f != want {
+			t.Errorf("%s: got format %q, want %q", mt, f, want)
+		}
+	}
+}
+
+// legacyStargz converts the estargz blob to the legacy stargz format by replacing the footer.
+func legacyStargz(t *testing.T, blob []byte) []byte {
+	t.Helper()
+	tocOffset, footerSize, err := estargz.OpenFooter(io.NewSectionReader(bytes.NewReader(blob), 0, int64(len(blob))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The legacy footer is a gzip header with the TOC offset as the whole extra field, followed by an empty stream
+	extra := fmt.Sprintf("%016xSTARGZ", tocOffset)
+	footer := []byte{0x1f, 0x8b, 8, 1 << 2, 0, 0, 0, 0, 0, 0xff, 0, 0}
+	binary.LittleEndian.PutUint16(footer[10:], uint16(len(extra)))
+	footer = append(footer, extra...)
+	footer = append(footer, 0x01, 0x00, 0x00, 0xff, 0xff) // final empty stored block
+	footer = append(footer, make([]byte, 8)...)           // CRC32 and ISIZE of the empty data
+
+	return append(append([]byte(nil), blob[:int64(len(blob))-footerSize]...), footer...)
+}
+
+func TestVariant(t *testing.T) {
+	// The layers differ since go-containerregistry pushes only one of the layers with the same diff ID
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr,
+		remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "variant"}, remotetest.File{Name: "estargz"}),
+		legacyStargz(t, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "variant"}, remotetest.File{Name: "stargz"})),
+	)
+	r := remotetest.Open(t, tr)
+
+	for i, want := range []remote.Variant{remote.VariantEStargz, remote.VariantLegacyStargz} {
+		l := layersOf(t, r)[i]
+		got, err := l.Variant()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("layer %d: got %s, want %s", i, got, want)
+		}
+		b, err := l.ReadFileRange("a", 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "variant" {
+			t.Errorf("layer %d: got %q, want %q", i, b, "variant")
+		}
+	}
+}
+
+// pushZstd pushes an image with a zstd:chunked layer of the files and the media type to tr.
+func pushZstd(t *testing.T, tr http.RoundTripper, mediaType types.MediaType, files ...remotetest.File) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		h := &tar.Header{Name: f.Name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(f.Content))}
+		if strings.HasSuffix(f.Name, "/") {
+			h.Typeflag, h.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.Content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	w := estargz.NewWriterWithCompressor(&out, &zstdchunked.Compressor{CompressionLevel: 1})
+	w.ChunkSize = 64
+	if err := w.AppendTar(&buf); err != nil {
+		t.Fatal(err)
+	}
+	toc, err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       remotetest.RawLayer{Blob: out.Bytes(), Type: mediaType},
+		MediaType:   mediaType,
+		Annotations: map[string]string{estargz.TOCJSONDigestAnnotation: toc.String()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZstd(t *testing.T) {
+	body := strings.Repeat("zstd framed ", 50)
+	tr := remotetest.NewTransport()
+	pushZstd(t, tr, "application/vnd.oci.image.layer.v1.tar+zstd", remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/z", Content: body})
+
+	for _, opts := range [][]remote.Option{nil, {remote.WithStrictVerification()}} {
+		r := remotetest.Open(t, tr, opts...)
+		b, err := r.ReadFile(context.Background(), "etc/z")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != body {
+			t.Errorf("unexpected content %q", b)
+		}
+		layers := layersOf(t, r)
+		if len(layers) != 1 {
+			t.Fatalf("expected 1 layer, got %d", len(layers))
+		}
+		v, err := layers[0].Variant()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != remote.VariantZstdChunked {
+			t.Errorf("expected variant %q, got %q", remote.VariantZstdChunked, v)
+		}
+		// The range spans several chunks, each in its own zstd frame
+		b, err = layers[0].ReadFileRange("etc/z", 60, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := body[60:160]; string(b) != want {
+			t.Errorf("expected %q, got %q", want, b)
+		}
+	}
+}
+
+func TestRegisterDecompressor(t *testing.T) {
+	inner := remotetest.NewTransport()
+	var whole int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.Contains(req.URL.Path, "/blobs/") && !isBlobRange(req) {
+			atomic.AddInt32(&whole, 1)
+		}
+		return inner.RoundTrip(req)
+	})
+	body := strings.Repeat("zstd framed ", 50)
+	pushZstd(t, tr, "application/vnd.example.layer.v1.tar+seekable", remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/z", Content: body})
+
+	if layers := layersOf(t, remotetest.Open(t, tr)); len(layers) != 0 {
+		t.Fatalf("expected the unknown media type to be skipped, got %d layers", len(layers))
+	}
+
+	remote.RegisterDecompressor("application/vnd.example.layer.v1.tar+seekable", new(zstdchunked.Decompressor))
+	r := remotetest.Open(t, tr)
+	layers := layersOf(t, r)
+	if len(layers) != 1 {
+		t.Fatalf("expected 1 layer, got %d", len(layers))
+	}
+	if f := layers[0].Format(); f != remote.FormatCustom {
+		t.Errorf("expected format %q, got %q", remote.FormatCustom, f)
+	}
+	// The config has been fetched as a whole, while the layer is read by ranges
+	atomic.StoreInt32(&whole, 0)
+	b, err := layers[0].ReadFileRange("etc/z", 60, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := body[60:160]; string(b) != want {
+		t.Errorf("expected %q, got %q", want, b)
+	}
+	if n := atomic.LoadInt32(&whole); n != 0 {
+		t.Errorf("expected the layer to be read lazily, got %d requests of whole blobs", n)
+	}
+	if b, err = r.ReadFile(context.Background(), "etc/z"); err != nil || string(b) != body {
+		t.Errorf("unexpected content %q: %v", b, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a nil decompressor")
+		}
+	}()
+	remote.RegisterDecompressor("application/vnd.example.layer.v1.tar+nil", nil)
+}
+
+func TestForceFormat(t *testing.T) {
+	mislabeled := remotetest.RawLayer{
+		Blob: remotetest.Layer(t, 0, remotetest.File{Name: "hello", Content: "forced"}),
+		Type: types.OCIUncompressedLayer,
+	}
+	notStargz := remotetest.RawLayer{Blob: bytes.Repeat([]byte("not estargz"), 100), Type: types.OCIUncompressedLayer}
+	img, err := mutate.Append(empty.Image,
+		mutate.Addendum{Layer: notStargz, MediaType: types.OCIUncompressedLayer},
+		mutate.Addendum{Layer: mislabeled, MediaType: types.OCIUncompressedLayer},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := remotetest.NewTransport()
+	if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+
+	if layers := layersOf(t, remotetest.Open(t, tr)); len(layers) != 0 {
+		t.Fatalf("expected uncompressed layers to be skipped, got %d layers", len(layers))
+	}
+
+	layers := layersOf(t, remotetest.Open(t, tr, remote.WithForceFormat(remote.FormatGzip)))
+	if len(layers) != 2 {
+		t.Fatalf("expected 2 layers, got %d", len(layers))
+	}
+	for _, l := range layers {
+		if l.Format() != remote.FormatGzip {
+			t.Errorf("layer %d: unexpected format %q", l.Index(), l.Format())
+		}
+	}
+	if _, err = layers[0].Open(); err == nil {
+		t.Error("expected a parse error for the layer which isn't estargz")
+	}
+	var buf bytes.Buffer
+	if _, err = layers[1].CopyFile(&buf, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "forced" {
+		t.Errorf("unexpected content %q", buf.String())
+	}
+}
+
+func TestIsEStargz(t *testing.T) {
+	plain, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, tocDigest, err := remotetest.BuildLayer([]remotetest.File{{Name: "a", Content: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotated := mutate.Addendum{
+		Layer:       remotetest.RawLayer{Blob: blob, Type: types.OCILayer},
+		MediaType:   types.OCILayer,
+		Annotations: map[string]string{estargz.TOCJSONDigestAnnotation: tocDigest},
+	}
+	estargzImg, err := mutate.Append(empty.Image, annotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An estargz layer on plain ones, e.g. built on a base image which isn't converted
+	mixed, err := mutate.Append(plain, annotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the manifest is checked, so estargz blobs without the annotation don't count
+	unannotated, err := remotetest.NewImage([][]byte{blob})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		img  v1.Image
+		want bool
+	}{
+		{name: "estargz", img: estargzImg, want: true},
+		{name: "plain", img: plain, want: false},
+		{name: "mixed", img: mixed, want: true},
+		{name: "unannotated", img: unannotated, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := remotetest.NewTransport()
+			if err := remotetest.Push(inner, remotetest.Reference, tt.img); err != nil {
+				t.Fatal(err)
+			}
+			var blobs int32
+			tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if isBlobRange(req) {
+					atomic.AddInt32(&blobs, 1)
+				}
+				return inner.RoundTrip(req)
+			})
+			got, err := remotetest.Open(t, tr).IsEStargz(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if n := atomic.LoadInt32(&blobs); n != 0 {
+				t.Errorf("expected no layer to be fetched, got %d range requests", n)
+			}
+		})
+	}
+}
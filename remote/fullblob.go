@@ -0,0 +1,46 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// defaultMaxFullBlobSize is the default size limit of blobs downloaded whole from servers ignoring range requests.
+const defaultMaxFullBlobSize = 64 << 20
+
+// fullBlob returns the whole blob kept after the server ignored a range request, or nil.
+// It is kept in the chunk cache of the Remote so that the layers returned by every Layers call share it.
+func (l *Layer) fullBlob() []byte {
+	return l.cache.whole(l.digest, l.size)
+}
+
+// keepFullBlob reads the whole blob from the response to a range request which the server ignored.
+// Some origin servers always send the whole blob, so every later read is served from it
+// instead of downloading the blob again for each chunk.
+func (l *Layer) keepFullBlob(body io.Reader) ([]byte, error) {
+	if l.size > l.maxFullBlobSize {
+		return nil, fmt.Errorf("the server of %s ignores range requests and the blob of %d bytes exceeds the limit of %d bytes",
+			l.digest, l.size, l.maxFullBlobSize)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(newVerifyingReader(ioutil.NopCloser(body), l.digest), l.size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) != l.size {
+		return nil, fmt.Errorf("the server sent %d bytes of %s, expected %d", len(b), l.digest, l.size)
+	}
+
+	l.cache.add(l.digest, 0, b)
+	return b, nil
+}
+
+// sliceBlob returns [begin, end] of the blob kept in memory.
+func sliceBlob(b []byte, begin, end int64) (io.ReadCloser, error) {
+	if end >= int64(len(b)) {
+		return nil, fmt.Errorf("range %d-%d exceeds the blob of %d bytes", begin, end, len(b))
+	}
+	return ioutil.NopCloser(bytes.NewReader(b[begin : end+1])), nil
+}
@@ -0,0 +1,64 @@
+package remote_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// rangeIgnoringTransport serves the whole blob for every range request like origin servers without range support.
+// It counts the blob requests except the probes resolving redirects.
+type rangeIgnoringTransport struct {
+	inner http.RoundTripper
+	n     int32
+}
+
+func (t *rangeIgnoringTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isBlobRange(req) {
+		return t.inner.RoundTrip(req)
+	}
+	if !isProbe(req) {
+		atomic.AddInt32(&t.n, 1)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Del("Range")
+	return t.inner.RoundTrip(req)
+}
+
+func (t *rangeIgnoringTransport) count() int {
+	return int(atomic.LoadInt32(&t.n))
+}
+
+func TestRangeIgnored(t *testing.T) {
+	files := []remotetest.File{
+		{Name: "a", Content: strings.Repeat("range ignored ", 100)},
+		{Name: "b", Content: "bbb"},
+	}
+	tr := &rangeIgnoringTransport{inner: remotetest.NewTransport()}
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, files...))
+
+	r := remotetest.Open(t, tr)
+	for _, f := range files {
+		b, err := r.ReadFile(context.Background(), f.Name)
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		if string(b) != f.Content {
+			t.Errorf("%s: got %q, want %q", f.Name, b, f.Content)
+		}
+	}
+	if n := tr.count(); n != 1 {
+		t.Errorf("expected the blob to be fetched once, got %d requests", n)
+	}
+
+	// Blobs beyond the limit aren't kept
+	r = remotetest.Open(t, tr, remote.WithMaxFullBlobSize(16))
+	if _, err := r.ReadFile(context.Background(), "b"); err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("got %v, want the blob to exceed the limit", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package gcp provides a keychain authenticating to Google Container Registry and Artifact Registry
+// with Google application default credentials (ADC).
+// It works wherever ADC is available, e.g. on GCE, GKE, and Cloud Run,
+// or with GOOGLE_APPLICATION_CREDENTIALS, without configuring docker-credential-gcr.
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// cloudPlatformScope is the OAuth2 scope required to pull from GCR and Artifact Registry.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// IsGCP reports whether the registry host is GCR or Artifact Registry.
+func IsGCP(host string) bool {
+	return host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || strings.HasSuffix(host, ".pkg.dev")
+}
+
+// Keychain resolves GCR and Artifact Registry hosts to access tokens minted from ADC.
+// Other registries, and all registries where ADC is not configured, are resolved to anonymous
+// so that public images can be pulled and another keychain can be tried with authn.NewMultiKeychain.
+// Tokens are reused until they expire.
+type Keychain struct {
+	// findCredentials finds ADC. Nil means google.FindDefaultCredentials.
+	findCredentials func(ctx context.Context, scopes ...string) (*google.Credentials, error)
+
+	once sync.Once
+	ts   oauth2.TokenSource
+	err  error
+}
+
+// NewKeychain returns a Keychain using ADC.
+func NewKeychain() *Keychain {
+	return &Keychain{}
+}
+
+// Resolve implements authn.Keychain.
+func (k *Keychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	if !IsGCP(target.RegistryStr()) {
+		return authn.Anonymous, nil
+	}
+
+	k.once.Do(func() {
+		find := k.findCredentials
+		if find == nil {
+			find = google.FindDefaultCredentials
+		}
+		var creds *google.Credentials
+		creds, k.err = find(context.Background(), cloudPlatformScope)
+		if k.err != nil {
+			return
+		}
+		k.ts = oauth2.ReuseTokenSource(nil, creds.TokenSource)
+	})
+	if k.err != nil {
+		if noCredentials(k.err) {
+			return authn.Anonymous, nil
+		}
+		return nil, fmt.Errorf("failed to find application default credentials: %w", k.err)
+	}
+	return &tokenAuthenticator{ts: k.ts}, nil
+}
+
+// noCredentials reports whether the error of google.FindDefaultCredentials means that ADC is not configured at all,
+// as opposed to broken credentials. The error has no type to tell it.
+func noCredentials(err error) bool {
+	return strings.Contains(err.Error(), "could not find default credentials")
+}
+
+// tokenAuthenticator authenticates with the access token of the token source.
+type tokenAuthenticator struct {
+	ts oauth2.TokenSource
+}
+
+// Authorization implements authn.Authenticator.
+func (a *tokenAuthenticator) Authorization() (*authn.AuthConfig, error) {
+	t, err := a.ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &authn.AuthConfig{Username: "oauth2accesstoken", Password: t.AccessToken}, nil
+}
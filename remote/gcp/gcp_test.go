@@ -0,0 +1,107 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+func resolve(t *testing.T, k *Keychain, repo string) (authn.Authenticator, error) {
+	t.Helper()
+	r, err := name.NewRepository(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k.Resolve(r)
+}
+
+func TestKeychain(t *testing.T) {
+	tests := []struct {
+		name     string
+		repo     string
+		find     func(ctx context.Context, scopes ...string) (*google.Credentials, error)
+		wantAnon bool
+		wantErr  bool
+		wantPass string
+	}{
+		{
+			name:     "other registry",
+			repo:     "docker.io/library/alpine",
+			wantAnon: true,
+		},
+		{
+			name: "no ADC",
+			repo: "gcr.io/distroless/static",
+			find: func(context.Context, ...string) (*google.Credentials, error) {
+				return nil, errors.New("google: could not find default credentials. See https://developers.google.com/accounts/docs/application-default-credentials for more information.")
+			},
+			wantAnon: true,
+		},
+		{
+			name: "broken ADC",
+			repo: "us-docker.pkg.dev/project/repo/image",
+			find: func(context.Context, ...string) (*google.Credentials, error) {
+				return nil, errors.New("google: error getting credentials using GOOGLE_APPLICATION_CREDENTIALS environment variable: invalid character")
+			},
+			wantErr: true,
+		},
+		{
+			name: "ADC",
+			repo: "gcr.io/project/image",
+			find: func(_ context.Context, scopes ...string) (*google.Credentials, error) {
+				if len(scopes) != 1 || scopes[0] != cloudPlatformScope {
+					t.Errorf("unexpected scopes %v", scopes)
+				}
+				return &google.Credentials{TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})}, nil
+			},
+			wantPass: "token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &Keychain{findCredentials: tt.find}
+			auth, err := resolve(t, k, tt.repo)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantAnon {
+				if auth != authn.Anonymous {
+					t.Fatalf("expected anonymous, got %v", auth)
+				}
+				return
+			}
+			cfg, err := auth.Authorization()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Username != "oauth2accesstoken" || cfg.Password != tt.wantPass {
+				t.Errorf("unexpected credentials %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestIsGCP(t *testing.T) {
+	for host, want := range map[string]bool{
+		"gcr.io":                     true,
+		"asia.gcr.io":                true,
+		"us-central1-docker.pkg.dev": true,
+		"docker.io":                  false,
+		"evilgcr.io":                 false,
+	} {
+		if got := IsGCP(host); got != want {
+			t.Errorf("IsGCP(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
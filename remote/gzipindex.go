@@ -0,0 +1,87 @@
+package remote
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+
+	"github.com/knqyf263/stargz-registry/remote/internal/footer"
+)
+
+// openGzipIndex opens a plain gzip layer, which has no TOC, through its index in the directory set by WithGzipIndex.
+// The index is a seekable eStargz copy of the layer built from the whole blob on first access,
+// so it is expensive only once and subsequent reads are served locally without downloading the blob again.
+func (l *Layer) openGzipIndex() (*estargz.Reader, error) {
+	p := filepath.Join(l.gzipIndexDir, l.digest.Algorithm, l.digest.Hex+".estargz")
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		if l.offline {
+			return nil, fmt.Errorf("gzip index of %s: %w", l.digest, ErrOffline)
+		}
+		if err = l.buildGzipIndex(p); err != nil {
+			return nil, fmt.Errorf("failed to build gzip index of %s: %w", l.digest, err)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// The file is kept open while the reader is in use
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := estargz.Open(io.NewSectionReader(f, 0, fi.Size()))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("broken gzip index %s: %w", p, err)
+	}
+	l.gzipIndex = f
+	return r, nil
+}
+
+// buildGzipIndex downloads the layer and writes its eStargz copy to p.
+func (l *Layer) buildGzipIndex(p string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := l.Download(l.ctx, pw)
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close()
+
+	zr, err := gzip.NewReader(pr)
+	if err != nil {
+		return err
+	}
+
+	// Favor the build time since the copy is only a local index
+	w := estargz.NewWriterWithCompressor(tmp, footer.NewCompressor(gzip.BestSpeed))
+	if err = w.AppendTar(zr); err != nil {
+		return err
+	}
+	if _, err = w.Close(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
@@ -0,0 +1,84 @@
+package remote_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// plainGzipLayer builds a plain gzip layer, which isn't estargz, of the files.
+func plainGzipLayer(t testing.TB, files ...remotetest.File) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.Name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(f.Content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.Content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGzipIndex(t *testing.T) {
+	big := strings.Repeat("x", 4<<20) + "needle"
+	inner := remotetest.NewTransport()
+	var downloads int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		// Only the footer is read at the tail of the blob except for downloading the whole blob
+		if isBlobRange(req) && !isProbe(req) && strings.HasPrefix(req.Header.Get("Range"), "bytes=0-") {
+			atomic.AddInt32(&downloads, 1)
+		}
+		return inner.RoundTrip(req)
+	})
+	remotetest.PushLayers(t, tr, plainGzipLayer(t,
+		remotetest.File{Name: "small", Content: "small"},
+		remotetest.File{Name: "big", Content: big},
+	))
+	ctx := context.Background()
+
+	// Plain gzip layers can't be read without the index
+	if _, err := remotetest.Open(t, tr).ReadFile(ctx, "small"); err == nil {
+		t.Fatal("expected an error without the gzip index")
+	}
+
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		r := remotetest.Open(t, tr, remote.WithGzipIndex(dir))
+		b, err := layersOf(t, r)[0].ReadFileRange("big", 4<<20, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "needle" {
+			t.Errorf("got %q, want %q", b, "needle")
+		}
+		if b, err = r.ReadFile(ctx, "small"); err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "small" {
+			t.Errorf("got %q, want %q", b, "small")
+		}
+	}
+
+	// The index built on first access is reused without downloading the blob again
+	if n := atomic.LoadInt32(&downloads); n != 1 {
+		t.Errorf("expected the blob to be downloaded once, got %d", n)
+	}
+}
@@ -0,0 +1,53 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// errEnoughLines stops reading chunks once Head has got the lines.
+var errEnoughLines = errors.New("enough lines")
+
+// Head returns the first lines of the file at the path in the merged view, including the newlines.
+// The file is read chunk by chunk and the remaining chunks are not fetched once the lines are found.
+// The whole file is returned if it has fewer lines. The last line may have no trailing newline.
+func (r Remote) Head(ctx context.Context, p string, lines int) ([]byte, error) {
+	if lines < 0 {
+		return nil, fmt.Errorf("invalid number of lines %d: must not be negative", lines)
+	}
+
+	l, e, err := r.Find(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	b := []byte{}
+	if lines == 0 {
+		return b, nil
+	}
+
+	n := 0
+	err = l.readChunks(e.Name, 0, -1, nil, func(_ *estargz.TOCEntry, p []byte) error {
+		for len(p) > 0 {
+			i := bytes.IndexByte(p, '\n')
+			if i < 0 {
+				b = append(b, p...)
+				return nil
+			}
+			b = append(b, p[:i+1]...)
+			p = p[i+1:]
+			if n++; n == lines {
+				return errEnoughLines
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errEnoughLines {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,96 @@
+package remote_test
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestHead(t *testing.T) {
+	r := newRemote(t, [][]remotetest.File{{
+		{Name: "lines", Content: "one\ntwo\nthree\n"},
+		{Name: "no-newline", Content: "one\ntwo"},
+		{Name: "empty"},
+	}})
+	tests := []struct {
+		path  string
+		lines int
+		want  string
+	}{
+		{path: "lines", lines: 2, want: "one\ntwo\n"},
+		{path: "lines", lines: 3, want: "one\ntwo\nthree\n"},
+		{path: "lines", lines: 10, want: "one\ntwo\nthree\n"},
+		{path: "lines", lines: 0, want: ""},
+		{path: "no-newline", lines: 2, want: "one\ntwo"},
+		{path: "no-newline", lines: 1, want: "one\n"},
+		{path: "empty", lines: 1, want: ""},
+	}
+	for _, tt := range tests {
+		got, err := r.Head(context.Background(), tt.path, tt.lines)
+		if err != nil {
+			t.Fatalf("%s %d: %v", tt.path, tt.lines, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s %d: got %q, want %q", tt.path, tt.lines, got, tt.want)
+		}
+	}
+
+	if _, err := r.Head(context.Background(), "lines", -1); err == nil {
+		t.Error("expected an error for negative lines")
+	}
+}
+
+// bytesTransport sums the lengths of the blob ranges requested except the probes resolving redirects.
+type bytesTransport struct {
+	inner http.RoundTripper
+	n     int64
+}
+
+func (t *bytesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isBlobRange(req) && !isProbe(req) {
+		var begin, end int64
+		if _, err := fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-%d", &begin, &end); err == nil {
+			atomic.AddInt64(&t.n, end-begin+1)
+		}
+	}
+	return t.inner.RoundTrip(req)
+}
+
+func (t *bytesTransport) bytes() int64 {
+	return atomic.LoadInt64(&t.n)
+}
+
+func TestHeadLargeFile(t *testing.T) {
+	// Random lines barely compress, so the file spans many chunks in the blob
+	rnd := rand.New(rand.NewSource(1))
+	var sb strings.Builder
+	line := make([]byte, 32)
+	for sb.Len() < 16<<20 {
+		rnd.Read(line)
+		sb.WriteString(hex.EncodeToString(line) + "\n")
+	}
+	content := sb.String()
+
+	tr := &bytesTransport{inner: remotetest.NewTransport()}
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 1<<20, remotetest.File{Name: "log", Content: content}))
+	r := remotetest.Open(t, tr)
+
+	got, err := r.Head(context.Background(), "log", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := content[:2*65]; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// The first chunk is read with up to 2MiB of the blob, as estargz does, besides the TOC
+	if n := tr.bytes(); n > 3<<20 {
+		t.Errorf("expected only the first chunk to be fetched, got %d bytes", n)
+	}
+}
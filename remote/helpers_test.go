@@ -0,0 +1,140 @@
+package remote_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// countingTransport counts the range requests of blobs except the probes resolving redirects.
+type countingTransport struct {
+	inner http.RoundTripper
+	n     int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isBlobRange(req) && !isProbe(req) {
+		atomic.AddInt32(&t.n, 1)
+	}
+	return t.inner.RoundTrip(req)
+}
+
+func (t *countingTransport) count() int {
+	return int(atomic.LoadInt32(&t.n))
+}
+
+// isBlobRange reports whether the request reads a range of a blob.
+func isBlobRange(req *http.Request) bool {
+	return strings.Contains(req.URL.Path, "/blobs/") && req.Header.Get("Range") != ""
+}
+
+// isProbe reports whether the request is the probe resolving the redirect of a blob.
+func isProbe(req *http.Request) bool {
+	return req.Header.Get("Range") == "bytes=0-1"
+}
+
+// serveImage starts a registry over http with an image of the blobs, from the bottom, as test/image:latest.
+// The handler of the registry is wrapped by wrap unless it's nil. It returns the server.
+func serveImage(t testing.TB, wrap func(http.Handler) http.Handler, blobs ...[]byte) *httptest.Server {
+	t.Helper()
+	h := remotetest.NewHandler()
+	img, err := remotetest.NewImage(blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Push the image before wrapping the handler, which may require credentials
+	// atomic.Value requires the same concrete type, so the handlers are stored wrapped
+	type holder struct{ http.Handler }
+	var handler atomic.Value
+	handler.Store(holder{h})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.Load().(holder).ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	if err = remotetest.Push(http.DefaultTransport, srv.Listener.Addr().String()+"/test/image:latest", img); err != nil {
+		t.Fatal(err)
+	}
+	if wrap != nil {
+		handler.Store(holder{wrap(h)})
+	}
+	return srv
+}
+
+// newRemote returns a Remote of an image whose layers are the files, from the bottom.
+func newRemote(t testing.TB, layers [][]remotetest.File, opts ...remote.Option) remote.Remote {
+	t.Helper()
+	r, err := remotetest.New(layers, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// layersOf returns the layers of the Remote.
+func layersOf(t testing.TB, r remote.Remote) []*remote.Layer {
+	t.Helper()
+	layers, err := r.Layers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layers
+}
+
+// cdnHost is the host withCDN redirects blob requests to.
+const cdnHost = "cdn.test"
+
+// withCDN redirects blob requests to the registry to cdnHost, like registries storing blobs on CDNs.
+// Requests to cdnHost are served by the inner transport as well.
+func withCDN(inner http.RoundTripper) http.RoundTripper {
+	return remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host != cdnHost && req.Method == http.MethodGet && strings.Contains(req.URL.Path, "/blobs/") {
+			return redirectResponse(req, "https://"+cdnHost+req.URL.Path), nil
+		}
+		return inner.RoundTrip(req)
+	})
+}
+
+// redirectResponse returns a 307 response to the request redirecting to the location.
+func redirectResponse(req *http.Request, location string) *http.Response {
+	return &http.Response{
+		Status:     "307 Temporary Redirect",
+		StatusCode: http.StatusTemporaryRedirect,
+		Header:     http.Header{"Location": {location}},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// statusResponse returns an empty response to the request with the status code.
+func statusResponse(req *http.Request, code int) *http.Response {
+	return &http.Response{
+		Status:     http.StatusText(code),
+		StatusCode: code,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// setenv sets the environment variable for the test, like t.Setenv, which isn't available in Go 1.16.
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
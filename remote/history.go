@@ -0,0 +1,46 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Attribute returns the index of the layer providing the file at the path in the merged view
+// and the history entry of the build step that created the layer, e.g. a RUN instruction of Dockerfile.
+func (r Remote) Attribute(ctx context.Context, p string) (int, v1.History, error) {
+	layers, li, _, err := r.find(ctx, p)
+	if err != nil {
+		return 0, v1.History{}, err
+	}
+	index := layers[li].Index()
+
+	h, err := r.LayerHistory(index)
+	if err != nil {
+		return 0, v1.History{}, err
+	}
+	return index, h, nil
+}
+
+// LayerHistory returns the history entry of the build step that created the layer at the index in the manifest,
+// which is returned by Layer.Index.
+func (r Remote) LayerHistory(index int) (v1.History, error) {
+	config, err := r.Config()
+	if err != nil {
+		return v1.History{}, err
+	}
+
+	// History entries with empty_layer, e.g. ENV, have no corresponding layer
+	i := 0
+	for _, h := range config.History {
+		if h.EmptyLayer {
+			continue
+		}
+		if i == index {
+			return h, nil
+		}
+		i++
+	}
+	return v1.History{}, fmt.Errorf("no history entry for layer %d: the config has %d non-empty history entries", index, i)
+}
@@ -0,0 +1,61 @@
+package remote_test
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestAttribute(t *testing.T) {
+	img, err := remotetest.NewImage([][]byte{
+		remotetest.Layer(t, 0, remotetest.File{Name: "base", Content: "base"}),
+		remotetest.Layer(t, 0, remotetest.File{Name: "usr/"}, remotetest.File{Name: "usr/bin/"}, remotetest.File{Name: "usr/bin/curl", Content: "curl"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf.History = []v1.History{
+		{CreatedBy: "ADD rootfs.tar /"},
+		{CreatedBy: "ENV PATH=/usr/bin", EmptyLayer: true},
+		{CreatedBy: "RUN apk add curl"},
+		{CreatedBy: `CMD ["curl"]`, EmptyLayer: true},
+	}
+	if img, err = mutate.ConfigFile(img, cf); err != nil {
+		t.Fatal(err)
+	}
+	tr := remotetest.NewTransport()
+	if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+	r := remotetest.Open(t, tr)
+
+	tests := []struct {
+		path      string
+		wantIndex int
+		wantBy    string
+	}{
+		{path: "base", wantIndex: 0, wantBy: "ADD rootfs.tar /"},
+		{path: "usr/bin/curl", wantIndex: 1, wantBy: "RUN apk add curl"},
+	}
+	for _, tt := range tests {
+		index, h, err := r.Attribute(context.Background(), tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if index != tt.wantIndex || h.CreatedBy != tt.wantBy {
+			t.Errorf("%s: got %d %q, want %d %q", tt.path, index, h.CreatedBy, tt.wantIndex, tt.wantBy)
+		}
+	}
+
+	if _, _, err = r.Attribute(context.Background(), "missing"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
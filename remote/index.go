@@ -0,0 +1,48 @@
+package remote
+
+import (
+	"encoding/json"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// fetchImage fetches the image of the reference. When the reference is an image index,
+// e.g. repo@sha256:<index-digest>, the image of the platform given by remote.WithPlatform is picked from it.
+func fetchImage(ref name.Reference, opts ...remote.Option) (v1.Image, error) {
+	desc, err := remote.Get(ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// go-containerregistry tells an index from the Content-Type, which some registries don't set correctly.
+	// Such an index would be read as an image without layers.
+	desc.MediaType = manifestMediaType(desc.MediaType, desc.Manifest)
+	return desc.Image()
+}
+
+// manifestMediaType returns the media type of the manifest, falling back to the body when mt is not a manifest type.
+func manifestMediaType(mt types.MediaType, manifest []byte) types.MediaType {
+	for _, known := range manifestMediaTypes {
+		if mt == known {
+			return mt
+		}
+	}
+
+	var m struct {
+		MediaType types.MediaType `json:"mediaType"`
+		Manifests json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return mt
+	}
+	switch {
+	case m.MediaType != "":
+		return m.MediaType
+	case m.Manifests != nil:
+		// The media type is optional in an OCI index
+		return types.OCIImageIndex
+	}
+	return mt
+}
@@ -0,0 +1,83 @@
+// Package footer writes estargz footers composed by hand.
+// estargz writes the footer as an empty stream with gzip.NoCompression, whose size differs between Go versions,
+// while the footer must be exactly estargz.FooterSize bytes.
+package footer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	gzipID1       = 0x1f
+	gzipID2       = 0x8b
+	gzipDeflate   = 8
+	gzipFlagExtra = 1 << 2
+)
+
+// Bytes returns an estargz footer pointing to the TOC at tocOffset.
+func Bytes(tocOffset int64) []byte {
+	subfield := fmt.Sprintf("%016xSTARGZ", tocOffset)
+
+	buf := make([]byte, estargz.FooterSize)
+	copy(buf, []byte{gzipID1, gzipID2, gzipDeflate, gzipFlagExtra, 0, 0, 0, 0, 0, 0xff}) // header without mtime
+	binary.LittleEndian.PutUint16(buf[10:], uint16(4+len(subfield)))                     // XLEN
+	buf[12], buf[13] = 'S', 'G'                                                          // SI1, SI2
+	binary.LittleEndian.PutUint16(buf[14:], uint16(len(subfield)))                       // LEN
+	copy(buf[16:], subfield)
+	copy(buf[38:], []byte{0x01, 0x00, 0x00, 0xff, 0xff}) // final empty stored block
+	// The remaining 8 bytes are CRC32 and ISIZE of the empty data, which are zero.
+	return buf
+}
+
+// Compressor is the gzip compressor of estargz writing the footer with Bytes.
+type Compressor struct {
+	estargz.Compressor
+	level int
+}
+
+// NewCompressor returns a Compressor compressing with the gzip level.
+func NewCompressor(level int) *Compressor {
+	return &Compressor{Compressor: estargz.NewGzipCompressorWithLevel(level), level: level}
+}
+
+// WriteTOCAndFooter writes the TOC as a tar entry in a gzip stream followed by the footer as estargz does.
+func (c *Compressor) WriteTOCAndFooter(w io.Writer, off int64, toc *estargz.JTOC, diffHash hash.Hash) (digest.Digest, error) {
+	tocJSON, err := json.MarshalIndent(toc, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	gz, err := gzip.NewWriterLevel(w, c.level)
+	if err != nil {
+		return "", err
+	}
+	gw := io.Writer(gz)
+	if diffHash != nil {
+		gw = io.MultiWriter(gz, diffHash)
+	}
+	tw := tar.NewWriter(gw)
+	if err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: estargz.TOCTarName, Size: int64(len(tocJSON))}); err != nil {
+		return "", err
+	}
+	if _, err = tw.Write(tocJSON); err != nil {
+		return "", err
+	}
+	if err = tw.Close(); err != nil {
+		return "", err
+	}
+	if err = gz.Close(); err != nil {
+		return "", err
+	}
+	if _, err = w.Write(Bytes(off)); err != nil {
+		return "", err
+	}
+	return digest.FromBytes(tocJSON), nil
+}
@@ -0,0 +1,27 @@
+package footer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+func TestBytes(t *testing.T) {
+	for _, tocOffset := range []int64{0, 12345, 1 << 40} {
+		b := Bytes(tocOffset)
+		if len(b) != estargz.FooterSize {
+			t.Fatalf("got %d bytes, want %d", len(b), estargz.FooterSize)
+		}
+		// Prepend enough bytes for the footer to be read at the end of a blob
+		blob := append(make([]byte, 64), b...)
+		got, footerSize, err := estargz.OpenFooter(io.NewSectionReader(bytes.NewReader(blob), 0, int64(len(blob))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tocOffset || footerSize != estargz.FooterSize {
+			t.Errorf("got offset %d and size %d, want %d and %d", got, footerSize, tocOffset, estargz.FooterSize)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package remote
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// configKeychain resolves credentials from the docker config file at path like authn.DefaultKeychain.
+// path is either a config file or a directory containing config.json.
+// A missing config resolves to anonymous so that the next keychain is tried.
+type configKeychain struct {
+	path string
+}
+
+func (k configKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	p := k.path
+	fi, err := os.Stat(p)
+	if err == nil && fi.IsDir() {
+		p = filepath.Join(p, config.ConfigFileName)
+		_, err = os.Stat(p)
+	}
+	if os.IsNotExist(err) {
+		return authn.Anonymous, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cf, err := config.LoadFromReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Docker Hub credentials are stored under the legacy index URL
+	key := target.RegistryStr()
+	if key == name.DefaultRegistry {
+		key = authn.DefaultAuthKey
+	}
+	cfg, err := cf.GetAuthConfig(key)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == (types.AuthConfig{}) {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(authn.AuthConfig{
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		Auth:          cfg.Auth,
+		IdentityToken: cfg.IdentityToken,
+		RegistryToken: cfg.RegistryToken,
+	}), nil
+}
@@ -0,0 +1,85 @@
+package remote_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestWithKeychainPaths(t *testing.T) {
+	srv := serveImage(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}, remotetest.Layer(t, 0, remotetest.File{Name: "hello", Content: "world"}))
+	host := srv.Listener.Addr().String()
+	ref := host + "/test/image:latest"
+
+	// The default config has no credentials, and the others are directories containing config.json
+	dir := t.TempDir()
+	config := func(name, host, pass string) string {
+		p := filepath.Join(dir, name)
+		if err := os.Mkdir(p, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeDockerConfig(t, p, host, "user", pass)
+		return p
+	}
+	setenv(t, "DOCKER_CONFIG", config("default", "other.example.com", "pass"))
+	other := config("other", "other.example.com", "pass")
+	secondary := config("secondary", host, "pass")
+	wrong := config("wrong", host, "wrong")
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name    string
+		paths   []string
+		wantErr bool
+	}{
+		{name: "secondary directory", paths: []string{missing, other, secondary}},
+		{name: "secondary file", paths: []string{filepath.Join(other, "config.json"), filepath.Join(secondary, "config.json")}},
+		{name: "first wins", paths: []string{wrong, secondary}, wantErr: true},
+		{name: "no credentials", paths: []string{missing, other}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := remote.New(ref, remote.WithKeychainPaths(tt.paths))
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := r.ReadFile(context.Background(), "hello")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "world" {
+				t.Errorf("got %q", b)
+			}
+		})
+	}
+
+	// The default config is searched last
+	setenv(t, "DOCKER_CONFIG", secondary)
+	if _, err := remote.New(ref, remote.WithKeychainPaths([]string{missing, other})); err != nil {
+		t.Errorf("the default config isn't searched: %v", err)
+	}
+
+	if _, err := remote.New(ref, remote.WithKeychainPaths([]string{""})); err == nil {
+		t.Error("expected an error for an empty path")
+	}
+}
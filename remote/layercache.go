@@ -0,0 +1,137 @@
+package remote
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// LayerCache caches the TOCs and the footers of layers as stored in the blobs, keyed by digest.
+// It can be shared by multiple Remotes with WithLayerCache
+// so that the TOC of a base layer used by many images is fetched only once.
+// The least recently used TOCs are evicted when they exceed the size of the cache.
+//
+// Only the bytes are shared: each layer parses its own reader from them and reads file contents through itself,
+// so the requests are bound to the context, the credentials, the request budget and the rate limit of its Remote.
+type LayerCache struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	ll    *list.List // *layerCacheEntry, the front is the most recently used
+	items map[v1.Hash]*list.Element
+	size  int64 // the sum of the sizes of the entries
+}
+
+type layerCacheEntry struct {
+	digest v1.Hash
+	tail   []byte // the end of the blob from the TOC, or the external TOC
+}
+
+// NewLayerCache returns a LayerCache holding footers and TOCs totaling at most maxBytes bytes
+// as stored in the blobs. Zero means no limit.
+func NewLayerCache(maxBytes int64) *LayerCache {
+	return &LayerCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    map[v1.Hash]*list.Element{},
+	}
+}
+
+// Len returns the number of cached TOCs.
+func (c *LayerCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Size returns the total size of the cached footers and TOCs.
+func (c *LayerCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// open parses the TOC of the layer from the cache, fetching it through the layer if it is not cached yet.
+func (c *LayerCache) open(l *Layer) (*estargz.Reader, error) {
+	if l.externalTOC != nil {
+		return c.openExternalTOC(l)
+	}
+	if tail, ok := c.get(l.digest); ok {
+		// The TOC and the footer are read from memory, and file contents through the layer
+		l.tail.Store(tail)
+		r, err := estargz.Open(l.footerSection(),
+			estargz.WithTOCOffset(l.size-int64(len(tail))), estargz.WithDecompressors(l.decompressors()...))
+		return r, l.budget.wrap(err)
+	}
+
+	r, err := l.openEStargz(l)
+	if err != nil {
+		return nil, l.budget.wrap(err)
+	}
+	if tail, ok := l.recordedTOC(); ok {
+		c.add(l.digest, tail)
+	}
+	return r, nil
+}
+
+// openExternalTOC parses the external TOC of the layer from the cache, fetching it if it is not cached yet.
+// It's keyed by the digest of the TOC blob since images may annotate the same layer with different ones.
+func (c *LayerCache) openExternalTOC(l *Layer) (*estargz.Reader, error) {
+	toc, ok := c.get(l.externalTOC.digest)
+	if !ok {
+		var err error
+		if toc, err = l.fetchExternalTOC(l.ctx); err != nil {
+			return nil, l.budget.wrap(fmt.Errorf("failed to fetch the external TOC %s: %w", l.externalTOC.digest, err))
+		}
+		c.add(l.externalTOC.digest, toc)
+	}
+	return l.openExternalTOC(l, toc)
+}
+
+// get returns the cached bytes of the key, marking them as the most recently used.
+func (c *LayerCache) get(key v1.Hash) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*layerCacheEntry).tail, true
+}
+
+// add caches the bytes of the key, evicting the least recently used ones beyond the size of the cache.
+func (c *LayerCache) add(key v1.Hash, b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; ok {
+		// Another layer has fetched the same TOC concurrently.
+		return
+	}
+	c.items[key] = c.ll.PushFront(&layerCacheEntry{digest: key, tail: b})
+	c.size += int64(len(b))
+	for c.maxBytes > 0 && c.size > c.maxBytes && c.ll.Len() > 1 {
+		oldest := c.ll.Back()
+		entry := oldest.Value.(*layerCacheEntry)
+		c.ll.Remove(oldest)
+		delete(c.items, entry.digest)
+		c.size -= int64(len(entry.tail))
+	}
+}
+
+// recordedTOC returns the end of the blob from the TOC recorded while opening the layer.
+// It fails when the TOC isn't recorded, e.g. since it's spilled to a file or the layer is read through the gzip index.
+func (l *Layer) recordedTOC() ([]byte, bool) {
+	if l.gzipIndex != nil {
+		return nil, false
+	}
+	tail, _ := l.tail.Load().([]byte)
+	footer, toc, err := l.metadataSize()
+	if err != nil || toc <= 0 || int64(len(tail)) < footer+toc {
+		return nil, false
+	}
+	return tail[int64(len(tail))-footer-toc:], true
+}
@@ -0,0 +1,163 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestLayerCacheSharedAcrossRemotes(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "etc/os-release", Content: "ID=base\n"}))
+	cache := remote.NewLayerCache(0)
+
+	var layers []*remote.Layer
+	var transports []*countingTransport
+	for i := 0; i < 2; i++ {
+		ct := &countingTransport{inner: tr}
+		l := layersOf(t, remotetest.Open(t, ct, remote.WithLayerCache(cache)))[0]
+		if _, err := l.Open(); err != nil {
+			t.Fatal(err)
+		}
+		layers, transports = append(layers, l), append(transports, ct)
+	}
+	if n := transports[1].count(); n != 0 {
+		t.Errorf("the TOC is fetched again for the second Remote with %d requests", n)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected 1 cached TOC, got %d", cache.Len())
+	}
+
+	// Each Remote reads file contents through its own transport
+	for i, l := range layers {
+		before := [2]int{transports[0].count(), transports[1].count()}
+		b, err := l.ReadFileRange("etc/os-release", 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "ID=base\n" {
+			t.Errorf("unexpected content %q", b)
+		}
+		if transports[i].count() == before[i] {
+			t.Errorf("layer %d isn't read through its Remote", i)
+		}
+		if other := 1 - i; transports[other].count() != before[other] {
+			t.Errorf("layer %d is read through another Remote", i)
+		}
+	}
+}
+
+func TestLayerCacheEviction(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr,
+		remotetest.Layer(t, 0, remotetest.File{Name: "file", Content: "layer 0"}),
+		remotetest.Layer(t, 0, remotetest.File{Name: "file", Content: "layer 1"}),
+		remotetest.Layer(t, 0, remotetest.File{Name: "file", Content: "layer 2"}),
+	)
+
+	// Measure the size of a TOC, which is almost the same for the layers
+	probe := remote.NewLayerCache(0)
+	if _, err := layersOf(t, remotetest.Open(t, tr, remote.WithLayerCache(probe)))[0].Open(); err != nil {
+		t.Fatal(err)
+	}
+	size := probe.Size()
+	if size <= 0 {
+		t.Fatalf("unexpected size %d", size)
+	}
+
+	cache := remote.NewLayerCache(2*size + size/2)
+	for _, l := range layersOf(t, remotetest.Open(t, tr, remote.WithLayerCache(cache))) {
+		if _, err := l.Open(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 cached TOCs, got %d", cache.Len())
+	}
+	if cache.Size() > 2*size+size/2 {
+		t.Errorf("the cache holds %d bytes over the limit", cache.Size())
+	}
+
+	// The most recently used TOC is cached, and the evicted one is fetched again
+	ct := &countingTransport{inner: tr}
+	layers := layersOf(t, remotetest.Open(t, ct, remote.WithLayerCache(cache)))
+	if _, err := layers[2].Open(); err != nil {
+		t.Fatal(err)
+	}
+	if n := ct.count(); n != 0 {
+		t.Errorf("the most recently used TOC is evicted and fetched with %d requests", n)
+	}
+	if _, err := layers[0].Open(); err != nil {
+		t.Fatal(err)
+	}
+	if ct.count() == 0 {
+		t.Error("the least recently used TOC isn't evicted")
+	}
+}
+
+func TestLayerCacheBudget(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "aaaa"}, remotetest.File{Name: "b", Content: "bbbb"}))
+	cache := remote.NewLayerCache(0)
+	if _, err := layersOf(t, remotetest.Open(t, tr, remote.WithLayerCache(cache)))[0].Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Measure the requests reading a file of the cached layer
+	var requests int
+	counting := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return tr.RoundTrip(req)
+	})
+	r := remotetest.Open(t, counting, remote.WithLayerCache(cache))
+	requests = 0 // only the requests after opening the image are counted
+	l := layersOf(t, r)[0]
+	if _, err := l.ReadFileRange("a", 0, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cached TOC costs nothing, but file contents are counted in the budget of the reading Remote
+	l = layersOf(t, remotetest.Open(t, tr, remote.WithLayerCache(cache), remote.WithMaxRequests(requests)))[0]
+	b, err := l.ReadFileRange("a", 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "aaaa" {
+		t.Errorf("unexpected content %q", b)
+	}
+	if _, err := l.ReadFileRange("b", 0, 4); !errors.Is(err, remote.ErrRequestBudgetExceeded) {
+		t.Fatalf("expected the budget to be spent, got %v", err)
+	}
+}
+
+func TestLayerCacheExternalTOC(t *testing.T) {
+	inner := remotetest.NewTransport()
+	tocDigest := pushExternalTOC(t, inner, remote.ExternalTOCDigestAnnotation, remotetest.File{Name: "hello", Content: "world"})
+	var fetches int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.HasSuffix(req.URL.Path, tocDigest.String()) {
+			atomic.AddInt32(&fetches, 1)
+		}
+		return inner.RoundTrip(req)
+	})
+
+	cache := remote.NewLayerCache(0)
+	for i := 0; i < 2; i++ {
+		b, err := remotetest.Open(t, tr, remote.WithLayerCache(cache)).ReadFile(context.Background(), "hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "world" {
+			t.Errorf("unexpected content %q", b)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("expected the external TOC to be fetched once, got %d", n)
+	}
+}
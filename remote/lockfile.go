@@ -0,0 +1,92 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// LockEntry is an image pinned in a lock file, e.g. by a CI pipeline.
+type LockEntry struct {
+	// Reference is the image reference, typically pinned by digest.
+	Reference string
+
+	// Platform is the platform to select from an image index, or nil.
+	Platform *v1.Platform
+}
+
+// ParseLockEntry parses the content of a lock file.
+// The file has a single line of a reference optionally followed by a platform separated by spaces, e.g.
+//
+//	ghcr.io/org/app@sha256:0123... linux/arm64
+//
+// Empty lines and lines starting with "#" are ignored.
+func ParseLockEntry(b []byte) (LockEntry, error) {
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := s.Err(); err != nil {
+		return LockEntry{}, err
+	}
+	if len(lines) != 1 {
+		return LockEntry{}, fmt.Errorf("lock file must have exactly one entry, got %d", len(lines))
+	}
+
+	fields := strings.Fields(lines[0])
+	if len(fields) > 2 {
+		return LockEntry{}, fmt.Errorf("invalid lock entry %q: want a reference and an optional platform", lines[0])
+	}
+	if _, err := parseReference(fields[0]); err != nil {
+		return LockEntry{}, fmt.Errorf("invalid reference in lock entry: %w", err)
+	}
+
+	entry := LockEntry{Reference: fields[0]}
+	if len(fields) == 2 {
+		p, err := ParsePlatform(fields[1])
+		if err != nil {
+			return LockEntry{}, err
+		}
+		entry.Platform = p
+	}
+	return entry, nil
+}
+
+// NewFromLockEntry opens the image pinned in the lock file at the path.
+// The platform of the entry, if any, takes precedence over WithPlatform in the options.
+func NewFromLockEntry(path string, opts ...Option) (Remote, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Remote{}, err
+	}
+	entry, err := ParseLockEntry(b)
+	if err != nil {
+		return Remote{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if entry.Platform != nil {
+		opts = append(opts, WithPlatform(*entry.Platform))
+	}
+	return New(entry.Reference, opts...)
+}
+
+// ParsePlatform parses a platform in the form of os/arch[/variant], e.g. linux/arm64/v8.
+func ParsePlatform(s string) (*v1.Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid platform %q: want os/arch[/variant]", s)
+	}
+	p := &v1.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
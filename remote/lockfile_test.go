@@ -0,0 +1,90 @@
+package remote_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestParseLockEntry(t *testing.T) {
+	const ref = "ghcr.io/org/app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name    string
+		content string
+		want    remote.LockEntry
+		wantErr bool
+	}{
+		{name: "reference", content: ref + "\n", want: remote.LockEntry{Reference: ref}},
+		{
+			name:    "platform",
+			content: "# pinned by CI\n\n" + ref + " linux/arm64/v8\n",
+			want:    remote.LockEntry{Reference: ref, Platform: &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		},
+		{name: "empty", content: "# nothing\n", wantErr: true},
+		{name: "multiple entries", content: ref + "\n" + ref + "\n", wantErr: true},
+		{name: "extra field", content: ref + " linux/amd64 extra", wantErr: true},
+		{name: "invalid platform", content: ref + " linux", wantErr: true},
+		{name: "invalid reference", content: "ghcr.io/org/app@sha256:short", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := remote.ParseLockEntry([]byte(tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFromLockEntry(t *testing.T) {
+	img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "pinned"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := remotetest.NewTransport()
+	if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "image.lock")
+	ref := strings.TrimSuffix(remotetest.Reference, ":latest") + "@" + dgst.String()
+	if err = ioutil.WriteFile(path, []byte(ref+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := remote.NewFromLockEntry(path, remote.WithTransport(tr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "pinned" {
+		t.Errorf("got %q, want %q", b, "pinned")
+	}
+
+	if _, err = remote.NewFromLockEntry(filepath.Join(t.TempDir(), "missing.lock")); err == nil {
+		t.Error("expected an error for a missing lock file")
+	}
+}
@@ -0,0 +1,110 @@
+package remote
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ManifestCache caches the manifests and the configs of resolved images keyed by reference.
+// It can be shared by multiple Remotes with WithManifestCache
+// so that opening the same image repeatedly, e.g. in a long-running service, doesn't fetch the manifest every time.
+// Images referenced by digest are immutable and cached until they're evicted, while tags are cached for the TTL.
+//
+// Only the bytes are cached: each Remote still authenticates to the registry with its own options,
+// so Remotes sharing a cache may use different credentials and transports.
+type ManifestCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu    sync.Mutex
+	ll    *list.List // *manifestCacheEntry, the front is the most recently used
+	items map[string]*list.Element
+}
+
+type manifestCacheEntry struct {
+	key     string
+	image   *cachedImage
+	expires time.Time // zero for digest references
+}
+
+// NewManifestCache returns a ManifestCache which caches images referenced by tag for ttl.
+// It holds at most maxEntries images, evicting the least recently used ones. Zero means no limit.
+func NewManifestCache(ttl time.Duration, maxEntries int) *ManifestCache {
+	return &ManifestCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+	}
+}
+
+// Len returns the number of cached images.
+func (c *ManifestCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// imageKey returns the key of the image of the reference for the platform, which may be nil.
+// It keys the images in the ManifestCache and in the disk cache so that platforms of an index don't mix up.
+func imageKey(ref name.Reference, platform *v1.Platform) string {
+	if platform == nil {
+		return ref.Name()
+	}
+	return ref.Name() + " " + platform.OS + "/" + platform.Architecture + "/" + platform.Variant
+}
+
+// get returns the cached image of the reference if it has not expired.
+func (c *ManifestCache) get(ref name.Reference, platform *v1.Platform) (v1.Image, bool) {
+	key := imageKey(ref, platform)
+
+	c.mu.Lock()
+	elem, ok := c.items[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, false
+	}
+	e := elem.Value.(*manifestCacheEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.ll.Remove(elem)
+		delete(c.items, key)
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	c.mu.Unlock()
+
+	img, err := e.image.image()
+	if err != nil {
+		return nil, false
+	}
+	return img, true
+}
+
+// add caches the manifest and the config of the image. Failures are ignored since the cache is best-effort.
+func (c *ManifestCache) add(ref name.Reference, platform *v1.Platform, img v1.Image) {
+	ci, err := newCachedImage(img)
+	if err != nil {
+		return
+	}
+	e := &manifestCacheEntry{key: imageKey(ref, platform), image: ci}
+	if _, ok := ref.(name.Digest); !ok {
+		e.expires = time.Now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[e.key]; ok {
+		c.ll.Remove(elem)
+	}
+	c.items[e.key] = c.ll.PushFront(e)
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*manifestCacheEntry).key)
+	}
+}
@@ -0,0 +1,134 @@
+package remote_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestManifestCache(t *testing.T) {
+	img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := remotetest.NewTransport()
+	if err = remotetest.Push(inner, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+	var manifests int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.Contains(req.URL.Path, "/manifests/") {
+			atomic.AddInt32(&manifests, 1)
+		}
+		return inner.RoundTrip(req)
+	})
+
+	byDigest := strings.TrimSuffix(remotetest.Reference, ":latest") + "@" + dgst.String()
+	tests := []struct {
+		name string
+		ref  string
+		ttl  time.Duration
+		want int32
+	}{
+		// Digests are immutable and cached regardless of the TTL
+		{name: "digest", ref: byDigest, ttl: time.Nanosecond, want: 1},
+		{name: "tag", ref: remotetest.Reference, ttl: time.Hour, want: 1},
+		{name: "expired tag", ref: remotetest.Reference, ttl: time.Nanosecond, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&manifests, 0)
+			cache := remote.NewManifestCache(tt.ttl, 0)
+			for i := 0; i < 2; i++ {
+				r, err := remote.New(tt.ref, remote.WithTransport(tr), remote.WithManifestCache(cache))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err = r.ReadFile(context.Background(), "a"); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(time.Millisecond) // expire the TTL of a nanosecond
+			}
+			if got := atomic.LoadInt32(&manifests); got != tt.want {
+				t.Errorf("got %d manifest requests, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestCacheTransports(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"}))
+	counting := func(requests, manifests *int32) http.RoundTripper {
+		return remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(requests, 1)
+			if strings.Contains(req.URL.Path, "/manifests/") {
+				atomic.AddInt32(manifests, 1)
+			}
+			return inner.RoundTrip(req)
+		})
+	}
+	var requestsA, manifestsA, requestsB, manifestsB int32
+	cache := remote.NewManifestCache(time.Hour, 0)
+	remotetest.Open(t, counting(&requestsA, &manifestsA), remote.WithManifestCache(cache))
+	before := atomic.LoadInt32(&requestsA)
+
+	// The second Remote hits the cache but reads through its own transport
+	r := remotetest.Open(t, counting(&requestsB, &manifestsB), remote.WithManifestCache(cache))
+	if _, err := r.ReadFile(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&manifestsB); got != 0 {
+		t.Errorf("got %d manifest requests, want 0", got)
+	}
+	if atomic.LoadInt32(&requestsB) == 0 {
+		t.Error("the second Remote issued no requests through its transport")
+	}
+	if got := atomic.LoadInt32(&requestsA); got != before {
+		t.Errorf("the first transport got %d requests of the second Remote", got-before)
+	}
+}
+
+func TestManifestCacheMaxEntries(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"}))
+	img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "b", Content: "b"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := strings.TrimSuffix(remotetest.Reference, ":latest") + ":other"
+	if err = remotetest.Push(inner, other, img); err != nil {
+		t.Fatal(err)
+	}
+	var manifests int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.Contains(req.URL.Path, "/manifests/") {
+			atomic.AddInt32(&manifests, 1)
+		}
+		return inner.RoundTrip(req)
+	})
+
+	cache := remote.NewManifestCache(time.Hour, 1)
+	for _, ref := range []string{remotetest.Reference, other, remotetest.Reference} {
+		if _, err = remote.New(ref, remote.WithTransport(tr), remote.WithManifestCache(cache)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := cache.Len(); got != 1 {
+		t.Errorf("got %d cached images, want 1", got)
+	}
+	// The first image was evicted by the other one and fetched again
+	if got := atomic.LoadInt32(&manifests); got != 3 {
+		t.Errorf("got %d manifest requests, want 3", got)
+	}
+}
@@ -0,0 +1,13 @@
+package remote
+
+import "fmt"
+
+// TooManyLayersError is returned when the image has more layers than the limit set by WithMaxLayers.
+type TooManyLayersError struct {
+	Layers int
+	Max    int
+}
+
+func (e *TooManyLayersError) Error() string {
+	return fmt.Sprintf("the image has %d layers, exceeding the limit of %d", e.Layers, e.Max)
+}
@@ -0,0 +1,44 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestMaxLayers(t *testing.T) {
+	layers := [][]remotetest.File{
+		{{Name: "a", Content: "a"}},
+		{{Name: "b", Content: "b"}},
+		{{Name: "c", Content: "c"}},
+	}
+	tests := []struct {
+		max     int
+		wantErr bool
+	}{
+		{max: 2, wantErr: true},
+		{max: 3},
+		{max: 0},
+	}
+	for _, tt := range tests {
+		r := newRemote(t, layers, remote.WithMaxLayers(tt.max))
+		_, err := r.Layers(context.Background())
+		if !tt.wantErr {
+			if err != nil {
+				t.Errorf("max %d: %v", tt.max, err)
+			}
+			continue
+		}
+
+		var tooMany *remote.TooManyLayersError
+		if !errors.As(err, &tooMany) {
+			t.Fatalf("max %d: got %v, want TooManyLayersError", tt.max, err)
+		}
+		if tooMany.Layers != 3 || tooMany.Max != tt.max {
+			t.Errorf("max %d: got %+v", tt.max, tooMany)
+		}
+	}
+}
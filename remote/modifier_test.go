@@ -0,0 +1,86 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestWithRequestModifier(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "from the private bucket"}))
+
+	// The mock signature covers the method and the URL the request is sent to
+	sign := func(req *http.Request) string {
+		return "signed " + req.Method + " " + req.URL.Host + req.URL.Path
+	}
+
+	var mu sync.Mutex
+	var signed, unsigned int
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		switch {
+		case req.URL.Host == "bucket.far.test":
+			return statusResponse(req, http.StatusInternalServerError), nil
+		case req.URL.Host == "bucket.near.test":
+			mu.Lock()
+			ok := req.Header.Get("X-Signature") == sign(req)
+			if ok {
+				signed++
+			} else {
+				unsigned++
+			}
+			mu.Unlock()
+			if !ok {
+				return statusResponse(req, http.StatusForbidden), nil
+			}
+		case isBlobRange(req):
+			// The config is fetched by go-containerregistry, which follows redirects itself
+			return redirectResponse(req, "https://bucket.far.test"+req.URL.Path), nil
+		}
+		return inner.RoundTrip(req)
+	})
+
+	// The redirect is rewritten before the request is signed
+	rewrite := remote.WithRedirectRewriter(func(u *url.URL) *url.URL {
+		u.Host = strings.Replace(u.Host, "far", "near", 1)
+		return u
+	})
+	modifier := func(req *http.Request) error {
+		if req.URL.Host == "bucket.near.test" {
+			req.Header.Set("X-Signature", sign(req))
+		}
+		return nil
+	}
+	r := remotetest.Open(t, tr, rewrite, remote.WithRequestModifier(modifier))
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "from the private bucket" {
+		t.Errorf("unexpected content %q", b)
+	}
+	mu.Lock()
+	if signed == 0 || unsigned != 0 {
+		t.Errorf("got %d signed and %d unsigned requests to the bucket", signed, unsigned)
+	}
+	mu.Unlock()
+
+	errSign := errors.New("no credentials")
+	_, err = remotetest.Open(t, tr, rewrite, remote.WithRetry(1, 0), remote.WithRequestModifier(func(*http.Request) error {
+		return errSign
+	})).ReadFile(context.Background(), "a")
+	if !errors.Is(err, errSign) {
+		t.Errorf("expected the error of the modifier, got %v", err)
+	}
+
+	if _, err = remote.New(remotetest.Reference, remote.WithTransport(tr), remote.WithRequestModifier(nil)); err == nil {
+		t.Error("expected an error for a nil modifier")
+	}
+}
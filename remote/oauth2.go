@@ -0,0 +1,79 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// oauth2Transport authorizes the requests to the registry with a token of the OAuth2 client credentials flow.
+// Requests to other hosts, e.g. CDNs the registry redirects to, are sent without the token.
+type oauth2Transport struct {
+	inner  http.RoundTripper
+	config *clientcredentials.Config
+	host   string
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+func newOAuth2Transport(inner http.RoundTripper, config *clientcredentials.Config, host string) *oauth2Transport {
+	return &oauth2Transport{inner: inner, config: config, host: host}
+}
+
+func (t *oauth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.inner.RoundTrip(req)
+	}
+
+	token, err := t.getToken(req.Context(), false)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.inner.RoundTrip(authorize(req, token))
+	if err != nil || res.StatusCode != http.StatusUnauthorized || (req.Body != nil && req.GetBody == nil) {
+		return res, err
+	}
+
+	// The token may have been revoked or expired earlier than told
+	res.Body.Close()
+	if token, err = t.getToken(req.Context(), true); err != nil {
+		return nil, err
+	}
+	retry := authorize(req, token)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.inner.RoundTrip(retry)
+}
+
+// getToken returns the cached token unless it's expired or refresh is true.
+func (t *oauth2Transport) getToken(ctx context.Context, refresh bool) (*oauth2.Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !refresh && t.token.Valid() {
+		return t.token, nil
+	}
+	// The token endpoint is requested through the inner transport as well
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: t.inner})
+	token, err := t.config.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get an OAuth2 token from %s: %w", t.config.TokenURL, err)
+	}
+	t.token = token
+	return token, nil
+}
+
+// authorize returns a copy of the request with the token.
+func authorize(req *http.Request, token *oauth2.Token) *http.Request {
+	req = req.Clone(req.Context())
+	token.SetAuthHeader(req)
+	return req
+}
@@ -0,0 +1,88 @@
+package remote_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// oauth2Registry guards a registry with bearer tokens issued by its OAuth2 client credentials endpoint, /oauth/token.
+// The token is revoked after every range request of blobs, so that clients have to refresh it.
+type oauth2Registry struct {
+	mu       sync.Mutex
+	valid    string // the token accepted now
+	issued   int
+	rejected int
+}
+
+func (o *oauth2Registry) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+
+		if r.URL.Path == "/oauth/token" {
+			id, secret, ok := r.BasicAuth()
+			if err := r.ParseForm(); err != nil || !ok || id != "client" || secret != "secret" ||
+				r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("scope") != "registry:pull" {
+				http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+				return
+			}
+			o.issued++
+			o.valid = fmt.Sprintf("token-%d", o.issued)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": o.valid, "token_type": "bearer", "expires_in": 3600})
+			return
+		}
+
+		if o.valid == "" || r.Header.Get("Authorization") != "Bearer "+o.valid {
+			o.rejected++
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if isBlobRange(r) && !isProbe(r) {
+			o.valid = ""
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestOAuth2(t *testing.T) {
+	o := &oauth2Registry{}
+	// A single layer is read sequentially, which the revocation after every range request requires
+	srv := serveImage(t, o.wrap, remotetest.Layer(t, 0,
+		remotetest.File{Name: "a", Content: "first"},
+		remotetest.File{Name: "b", Content: "second"},
+	))
+	ref := srv.Listener.Addr().String() + "/test/image:latest"
+
+	r, err := remote.New(ref, remote.WithOAuth2(srv.URL+"/oauth/token", "client", "secret", []string{"registry:pull"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"a": "first", "b": "second"} {
+		b, err := r.ReadFile(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s: unexpected content %q", name, b)
+		}
+	}
+	o.mu.Lock()
+	issued, rejected := o.issued, o.rejected
+	o.mu.Unlock()
+	if issued < 2 || rejected == 0 {
+		t.Errorf("expected the revoked token to be refreshed, got %d tokens issued and %d requests rejected", issued, rejected)
+	}
+
+	_, err = remote.New(ref, remote.WithOAuth2(srv.URL+"/oauth/token", "client", "wrong", []string{"registry:pull"}))
+	if err == nil {
+		t.Error("expected an error for a wrong client secret")
+	}
+}
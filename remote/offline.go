@@ -0,0 +1,131 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ErrOffline is returned in offline mode when reading data which isn't cached.
+var ErrOffline = errors.New("not available offline")
+
+// offlineTransport fails every request in offline mode.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Redacted(), ErrOffline)
+}
+
+// metadataDir is the directory in the disk cache storing manifests and configs of references.
+const metadataDir = "metadata"
+
+func (c *diskCache) metadataPath(ref name.Reference, platform *v1.Platform, file string) string {
+	sum := sha256.Sum256([]byte(imageKey(ref, platform)))
+	return filepath.Join(c.dir, metadataDir, hex.EncodeToString(sum[:]), file)
+}
+
+// saveImage stores the manifest and the config of the image of the platform for offline mode.
+// Failures are ignored since the cache is best-effort.
+func (c *diskCache) saveImage(ref name.Reference, platform *v1.Platform, img v1.Image) {
+	ci, err := newCachedImage(img)
+	if err != nil {
+		return
+	}
+
+	meta, _ := json.Marshal(imageMetadata{MediaType: ci.mediaType})
+	for file, b := range map[string][]byte{"manifest": ci.manifest, "config": ci.config, "metadata.json": meta} {
+		path := c.metadataPath(ref, platform, file)
+		if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return
+		}
+		if err = ioutil.WriteFile(path, b, 0o644); err != nil {
+			return
+		}
+	}
+}
+
+// loadImage returns the image stored by saveImage.
+func (c *diskCache) loadImage(ref name.Reference, platform *v1.Platform) (v1.Image, error) {
+	var img cachedImage
+	for file, dst := range map[string]*[]byte{"manifest": &img.manifest, "config": &img.config} {
+		b, err := ioutil.ReadFile(c.metadataPath(ref, platform, file))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: %w", ref, ErrOffline)
+		} else if err != nil {
+			return nil, err
+		}
+		*dst = b
+	}
+
+	b, err := ioutil.ReadFile(c.metadataPath(ref, platform, "metadata.json"))
+	if err != nil {
+		return nil, err
+	}
+	var meta imageMetadata
+	if err = json.Unmarshal(b, &meta); err != nil {
+		return nil, err
+	}
+	img.mediaType = meta.MediaType
+
+	return img.image()
+}
+
+type imageMetadata struct {
+	MediaType types.MediaType `json:"mediaType"`
+}
+
+// cachedImage is an image restored from its manifest and config kept by the disk cache or the ManifestCache.
+// Its layers are read through Remote.Layers.
+type cachedImage struct {
+	manifest  []byte
+	config    []byte
+	mediaType types.MediaType
+}
+
+// newCachedImage returns the manifest and the config of the image.
+func newCachedImage(img v1.Image) (*cachedImage, error) {
+	manifest, err := img.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	config, err := img.RawConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	return &cachedImage{manifest: manifest, config: config, mediaType: mediaType}, nil
+}
+
+func (i *cachedImage) image() (v1.Image, error) {
+	return partial.CompressedToImage(i)
+}
+
+func (i *cachedImage) RawManifest() ([]byte, error) {
+	return i.manifest, nil
+}
+
+func (i *cachedImage) RawConfigFile() ([]byte, error) {
+	return i.config, nil
+}
+
+func (i *cachedImage) MediaType() (types.MediaType, error) {
+	return i.mediaType, nil
+}
+
+func (i *cachedImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	return nil, fmt.Errorf("layer %s: %w", h, ErrOffline)
+}
@@ -0,0 +1,50 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestOffline(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0,
+		remotetest.File{Name: "cached", Content: "read online"},
+		remotetest.File{Name: "uncached", Content: "never read online"},
+	))
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// Warm the disk cache, which also stores the manifest and the config
+	if _, err := remotetest.Open(t, tr, remote.WithDiskCache(dir)).ReadFile(ctx, "cached"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Any request through the transport fails the test
+	failing := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+		return nil, errors.New("unexpected request")
+	})
+	r := remotetest.Open(t, failing, remote.WithDiskCache(dir), remote.WithOffline())
+	b, err := r.ReadFile(ctx, "cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "read online" {
+		t.Errorf("got %q", b)
+	}
+	if _, err = r.ReadFile(ctx, "uncached"); !errors.Is(err, remote.ErrOffline) {
+		t.Errorf("got %v, want ErrOffline", err)
+	}
+}
+
+func TestOfflineWithoutDiskCache(t *testing.T) {
+	_, err := remote.New(remotetest.Reference, remote.WithOffline())
+	if err == nil {
+		t.Fatal("expected an error without a disk cache")
+	}
+}
@@ -0,0 +1,102 @@
+package remote
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+func TestForEachChunkLargeOffsets(t *testing.T) {
+	// A sparse file of 5GiB with chunks beyond 2^31 and 2^32, which overflow int on 32-bit platforms
+	const gib = int64(1) << 30
+	chunks := []*estargz.TOCEntry{
+		{Size: 5 * gib, ChunkOffset: 0, ChunkSize: 1 << 20},
+		{ChunkOffset: 3 * gib, ChunkSize: 1 << 20},
+		{ChunkOffset: 5*gib - 1<<20, ChunkSize: 1 << 20},
+	}
+
+	type part struct {
+		chunk      int // -1 for a hole
+		begin, end int64
+	}
+	var got []part
+	err := forEachChunk(chunks, 5*gib, 3*gib-10, 5*gib-1<<20+10, func(ce *estargz.TOCEntry, begin, end int64) error {
+		i := -1
+		for j, c := range chunks {
+			if c == ce {
+				i = j
+			}
+		}
+		got = append(got, part{chunk: i, begin: begin, end: end})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []part{
+		{chunk: -1, begin: 3*gib - 10, end: 3 * gib},
+		{chunk: 1, begin: 3 * gib, end: 3*gib + 1<<20},
+		{chunk: -1, begin: 3*gib + 1<<20, end: 5*gib - 1<<20},
+		{chunk: 2, begin: 5*gib - 1<<20, end: 5*gib - 1<<20 + 10},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReadHole(t *testing.T) {
+	// A hole larger than the zeros passed at once, ending in a partial piece
+	size := int64(3*len(zeros) + 10)
+	var pieces []int
+	err := readHole(100, 100+size, func(ce *estargz.TOCEntry, p []byte) error {
+		if ce != nil {
+			t.Errorf("got a chunk for a hole")
+		}
+		for _, b := range p {
+			if b != 0 {
+				t.Fatal("got a non-zero byte in a hole")
+			}
+		}
+		pieces = append(pieces, len(p))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{len(zeros), len(zeros), len(zeros), 10}
+	if !reflect.DeepEqual(pieces, want) {
+		t.Errorf("got pieces %v, want %v", pieces, want)
+	}
+
+	// A hole of 5GiB is streamed without allocating it, and stops at the first error
+	errStop := errors.New("stop")
+	calls := 0
+	err = readHole(0, 5<<30, func(_ *estargz.TOCEntry, p []byte) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Errorf("got %v after %d calls, want %v after 1", err, calls, errStop)
+	}
+}
+
+func TestMakeBufferTooLarge(t *testing.T) {
+	if _, err := makeBuffer(-1); err == nil {
+		t.Error("expected an error for a negative size")
+	}
+	if _, err := getBuffer(-1); err == nil {
+		t.Error("expected an error for a negative size")
+	}
+	if maxInt > math.MaxInt32 {
+		t.Skip("sizes beyond 2^31 fit in int on this platform")
+	}
+	if _, err := makeBuffer(math.MaxInt32 + 1); err == nil {
+		t.Error("expected an error for a size beyond int")
+	}
+	if _, err := getBuffer(math.MaxInt32 + 1); err == nil {
+		t.Error("expected an error for a size beyond int")
+	}
+}
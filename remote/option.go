@@ -0,0 +1,623 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// Option is a functional option for New.
+type Option func(*options) error
+
+type options struct {
+	scheme     string
+	rateLimit  int64
+	retry      retryPolicy
+	layerCache *LayerCache
+	trace      io.Writer
+
+	diskCacheDir      string
+	diskCacheMaxBytes int64
+
+	chunkCacheMaxBytes int64
+
+	labeledFiles map[string]string // path -> annotation or label key
+
+	hostOverrides map[string]string // host -> address to dial
+
+	readTimeout time.Duration
+	offline     bool
+
+	gzipIndexDir string
+
+	keychain authn.Keychain
+
+	manifestCache *ManifestCache
+
+	fileCache *FileCache
+
+	maxLayers int
+
+	caseInsensitive bool
+
+	profile *Profile
+
+	transport http.RoundTripper
+
+	strict bool
+
+	platform *v1.Platform
+
+	maxRedirects int
+
+	maxFullBlobSize int64
+
+	maxIdleConnsPerHost int
+
+	unixSocket string
+
+	forceFormat Format
+
+	tocSpill int64
+
+	oauth2 *clientcredentials.Config
+
+	layerFilter func(index int, desc v1.Descriptor) bool
+
+	pathPrefix string
+
+	blobStore BlobStore
+
+	maxRequests int
+
+	maxConcurrency int
+
+	rewriteRedirect func(*url.URL) *url.URL
+	modifyRequest   func(*http.Request) error
+
+	progress func(done, total int64)
+
+	externalTOCAnnotation string
+}
+
+func makeOptions(opts ...Option) (*options, error) {
+	o := &options{
+		retry:               retryPolicy{attempts: defaultRetryAttempts, backoff: defaultRetryBackoff},
+		chunkCacheMaxBytes:  defaultChunkCacheMaxBytes,
+		diskCacheMaxBytes:   defaultDiskCacheMaxBytes,
+		keychain:            authn.DefaultKeychain,
+		maxRedirects:        defaultMaxRedirects,
+		maxFullBlobSize:     defaultMaxFullBlobSize,
+		maxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+
+		externalTOCAnnotation: ExternalTOCDigestAnnotation,
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	if o.transport == nil && o.maxIdleConnsPerHost != defaultMaxIdleConnsPerHost {
+		o.transport = newTunedTransport(o.maxIdleConnsPerHost)
+	}
+	return o, nil
+}
+
+// WithScheme forces the scheme ("http" or "https") used to access the registry.
+// By default, the scheme is guessed from the registry hostname by go-containerregistry,
+// which accesses local registries such as localhost over http unless they answer over https.
+func WithScheme(scheme string) Option {
+	return func(o *options) error {
+		if scheme != "http" && scheme != "https" {
+			return fmt.Errorf("invalid scheme %q: must be http or https", scheme)
+		}
+		o.scheme = scheme
+		return nil
+	}
+}
+
+// WithChunkCacheMaxBytes sets the size cap of the memory cache of blob ranges fetched by the Remote,
+// e.g. by PreloadSmallFiles. The least recently used ranges are evicted beyond the cap, which is 256MiB by default.
+// A blob kept whole since its server ignores range requests is evicted as well, so the cap should be larger
+// than the limit set by WithMaxFullBlobSize.
+func WithChunkCacheMaxBytes(n int64) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid chunk cache size %d: must be positive", n)
+		}
+		o.chunkCacheMaxBytes = n
+		return nil
+	}
+}
+
+// WithRateLimit caps the aggregated throughput of range reads across all layers of the Remote.
+func WithRateLimit(bytesPerSec int64) Option {
+	return func(o *options) error {
+		if bytesPerSec <= 0 {
+			return fmt.Errorf("invalid rate limit %d: must be positive", bytesPerSec)
+		}
+		o.rateLimit = bytesPerSec
+		return nil
+	}
+}
+
+// WithRetry configures retries of requests to the registry on network errors and transient statuses.
+// attempts is the maximum number of attempts including the first one,
+// and backoff is the delay before the first retry, which is doubled after each retry.
+// The delay requested by the Retry-After header is respected.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) error {
+		if attempts < 1 {
+			return fmt.Errorf("invalid retry attempts %d: must be at least 1", attempts)
+		}
+		if backoff < 0 {
+			return fmt.Errorf("invalid retry backoff %s: must not be negative", backoff)
+		}
+		o.retry = retryPolicy{attempts: attempts, backoff: backoff}
+		return nil
+	}
+}
+
+// WithLayerCache shares the fetched TOCs of layers through the given cache.
+func WithLayerCache(c *LayerCache) Option {
+	return func(o *options) error {
+		if c == nil {
+			return fmt.Errorf("layer cache must not be nil")
+		}
+		o.layerCache = c
+		return nil
+	}
+}
+
+// WithTrace writes a record of every request to the registry and its response to w as NDJSON.
+// Credentials in headers and queries are redacted.
+func WithTrace(w io.Writer) Option {
+	return func(o *options) error {
+		if w == nil {
+			return fmt.Errorf("trace writer must not be nil")
+		}
+		o.trace = w
+		return nil
+	}
+}
+
+// WithDiskCache persists fetched blob ranges under dir so that later reads, even by another process,
+// are served from the disk without accessing the registry.
+// The cache is capped at 1GiB by default; use WithDiskCacheMaxBytes to change it.
+func WithDiskCache(dir string) Option {
+	return func(o *options) error {
+		if dir == "" {
+			return fmt.Errorf("empty disk cache directory")
+		}
+		o.diskCacheDir = dir
+		return nil
+	}
+}
+
+// WithDiskCacheMaxBytes sets the size cap of the disk cache.
+// The least recently used ranges are evicted beyond the cap.
+func WithDiskCacheMaxBytes(n int64) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid disk cache size %d: must be positive", n)
+		}
+		o.diskCacheMaxBytes = n
+		return nil
+	}
+}
+
+// WithLabeledFile makes Remote.ReadFile serve the file at the path from the manifest annotation
+// or the config label with the given key when the image has it, without reading any layer.
+// It is useful for small well-known files like os-release recorded at build time.
+func WithLabeledFile(path, key string) Option {
+	return func(o *options) error {
+		if key == "" {
+			return fmt.Errorf("empty label key for %q", path)
+		}
+		if o.labeledFiles == nil {
+			o.labeledFiles = map[string]string{}
+		}
+		o.labeledFiles[cleanPath(path)] = key
+		return nil
+	}
+}
+
+// WithHostOverride makes connections to the host dial addr instead, like an entry in /etc/hosts.
+// addr is an IP address or a host, optionally with a port.
+// TLS server name indication and certificate verification still use the original host.
+// It applies to both the registry and the hosts it redirects to.
+func WithHostOverride(host, addr string) Option {
+	return func(o *options) error {
+		if host == "" || addr == "" {
+			return fmt.Errorf("invalid host override %q -> %q: host and address must not be empty", host, addr)
+		}
+		if o.hostOverrides == nil {
+			o.hostOverrides = map[string]string{}
+		}
+		o.hostOverrides[host] = addr
+		return nil
+	}
+}
+
+// WithUnixSocket makes every connection dial the Unix domain socket at path,
+// for registries listening on a socket such as embedded ones in tests.
+// The host of the image reference is a placeholder then, e.g. "localhost:5000/repo:tag",
+// though it is still sent in the Host header and used for the credentials.
+func WithUnixSocket(path string) Option {
+	return func(o *options) error {
+		if path == "" {
+			return fmt.Errorf("empty unix socket path")
+		}
+		o.unixSocket = path
+		return nil
+	}
+}
+
+// WithReadTimeout bounds each range request, including reading its body, by d.
+// A request exceeding it is canceled and retried according to WithRetry,
+// while the context passed by the caller still bounds the whole operation.
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid read timeout %s: must be positive", d)
+		}
+		o.readTimeout = d
+		return nil
+	}
+}
+
+// WithOffline serves everything from the disk cache set by WithDiskCache without accessing the registry.
+// Reading anything which isn't cached fails with ErrOffline.
+// The image must have been opened online with the same disk cache before.
+func WithOffline() Option {
+	return func(o *options) error {
+		o.offline = true
+		return nil
+	}
+}
+
+// WithGzipIndex allows reading plain gzip layers, which are not estargz, through indexes stored in dir.
+// The index of a layer is built by downloading the whole blob on first access and reused afterwards,
+// even across runs, to read files at random without downloading the blob again.
+func WithGzipIndex(dir string) Option {
+	return func(o *options) error {
+		if dir == "" {
+			return fmt.Errorf("empty gzip index directory")
+		}
+		o.gzipIndexDir = dir
+		return nil
+	}
+}
+
+// WithKeychain resolves the credentials for the registry with the keychain instead of authn.DefaultKeychain.
+// Combine keychains with authn.NewMultiKeychain, e.g. to fall back to the ecr package for ECR registries.
+func WithKeychain(kc authn.Keychain) Option {
+	return func(o *options) error {
+		if kc == nil {
+			return fmt.Errorf("keychain must not be nil")
+		}
+		o.keychain = kc
+		return nil
+	}
+}
+
+// WithKeychainPaths resolves the credentials from the docker config files at the paths in order,
+// falling back to authn.DefaultKeychain. A path is either a config file or a directory containing config.json,
+// and is skipped if it doesn't exist. The first config with credentials for the registry wins.
+func WithKeychainPaths(paths []string) Option {
+	return func(o *options) error {
+		keychains := make([]authn.Keychain, 0, len(paths)+1)
+		for _, p := range paths {
+			if p == "" {
+				return fmt.Errorf("empty keychain path")
+			}
+			keychains = append(keychains, configKeychain{path: p})
+		}
+		o.keychain = authn.NewMultiKeychain(append(keychains, authn.DefaultKeychain)...)
+		return nil
+	}
+}
+
+// WithManifestCache shares the manifests and the configs of resolved images with other Remotes using the same cache.
+func WithManifestCache(c *ManifestCache) Option {
+	return func(o *options) error {
+		if c == nil {
+			return fmt.Errorf("manifest cache must not be nil")
+		}
+		o.manifestCache = c
+		return nil
+	}
+}
+
+// WithFileCache memoizes the contents of files read by ReadFile in the given cache.
+func WithFileCache(c *FileCache) Option {
+	return func(o *options) error {
+		if c == nil {
+			return fmt.Errorf("file cache must not be nil")
+		}
+		o.fileCache = c
+		return nil
+	}
+}
+
+// WithMaxLayers limits the number of layers of the image. Layers fails with TooManyLayersError beyond the limit.
+// Zero, the default, disables the limit.
+func WithMaxLayers(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max layers %d: must not be negative", n)
+		}
+		o.maxLayers = n
+		return nil
+	}
+}
+
+// WithCaseInsensitive makes Find and the functions based on it fall back to matching paths case-insensitively
+// when no path matches exactly, e.g. for images built on Windows.
+// A path matching several entries which differ only by case results in AmbiguousPathError.
+func WithCaseInsensitive() Option {
+	return func(o *options) error {
+		o.caseInsensitive = true
+		return nil
+	}
+}
+
+// WithProfile aggregates the requests of the Remote into the profile.
+// A profile can be shared by multiple Remotes.
+func WithProfile(p *Profile) Option {
+	return func(o *options) error {
+		if p == nil {
+			return fmt.Errorf("profile must not be nil")
+		}
+		o.profile = p
+		return nil
+	}
+}
+
+// WithTransport sends the requests through the transport instead of http.DefaultTransport.
+// Authentication and the other options are applied on top of it.
+func WithTransport(t http.RoundTripper) Option {
+	return func(o *options) error {
+		if t == nil {
+			return fmt.Errorf("transport must not be nil")
+		}
+		o.transport = t
+		return nil
+	}
+}
+
+// WithStrictVerification verifies every read of files and fails closed on any mismatch.
+// The TOC of a layer is verified against the toc.digest annotation before the first read from the layer,
+// and every chunk fetched is verified against its digest in the TOC.
+// Layers without the annotation are refused instead of trusted.
+func WithStrictVerification() Option {
+	return func(o *options) error {
+		o.strict = true
+		return nil
+	}
+}
+
+// WithPlatform selects the image of the platform when the reference points to an image index.
+// By default, linux/amd64 is selected as go-containerregistry does.
+func WithPlatform(p v1.Platform) Option {
+	return func(o *options) error {
+		o.platform = &p
+		return nil
+	}
+}
+
+// defaultMaxRedirects is the default number of redirects followed to the URL serving a blob.
+const defaultMaxRedirects = 5
+
+// WithMaxRedirects follows at most n redirects from the registry to the URL serving a blob.
+// With zero, a blob served through a redirect can't be read. Credentials are sent only to the registry host whatever the number of hops.
+func WithMaxRedirects(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max redirects %d: must not be negative", n)
+		}
+		o.maxRedirects = n
+		return nil
+	}
+}
+
+// WithMaxFullBlobSize sets the size limit of blobs downloaded whole when the server ignores range requests.
+// Such a blob is kept in memory and serves every later read of the layer. Reading larger blobs fails.
+// The default is 64 MiB, and zero disables the fallback.
+func WithMaxFullBlobSize(n int64) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max full blob size %d: must not be negative", n)
+		}
+		o.maxFullBlobSize = n
+		return nil
+	}
+}
+
+// WithMaxIdleConnsPerHost keeps at most n idle connections per host for range requests.
+// It is ignored when the transport is given by WithTransport.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return fmt.Errorf("invalid max idle connections per host %d: must be at least 1", n)
+		}
+		o.maxIdleConnsPerHost = n
+		return nil
+	}
+}
+
+// WithForceFormat reads every layer as the format regardless of its media type,
+// e.g. estargz layers mislabeled as uncompressed tar. Opening a layer which isn't estargz fails with the parse error.
+// Foreign layers are still skipped since their blobs aren't in the registry.
+func WithForceFormat(f Format) Option {
+	return func(o *options) error {
+		if f != FormatGzip && f != FormatZstd {
+			return fmt.Errorf("invalid format %q: must be %q or %q", f, FormatGzip, FormatZstd)
+		}
+		o.forceFormat = f
+		return nil
+	}
+}
+
+// WithTOCSpill downloads TOCs larger than threshold bytes to temp files instead of buffering them in memory.
+// The files are removed by Layer.Close.
+func WithTOCSpill(threshold int64) Option {
+	return func(o *options) error {
+		if threshold <= 0 {
+			return fmt.Errorf("invalid TOC spill threshold %d: must be positive", threshold)
+		}
+		o.tocSpill = threshold
+		return nil
+	}
+}
+
+// WithOAuth2 authorizes the requests to the registry with a token obtained by the OAuth2 client credentials flow
+// from tokenURL instead of the credentials in the keychain. The token is refreshed when it expires
+// or the registry rejects it with 401, and it is never sent to other hosts.
+func WithOAuth2(tokenURL, clientID, clientSecret string, scopes []string) Option {
+	return func(o *options) error {
+		if tokenURL == "" {
+			return fmt.Errorf("empty OAuth2 token URL")
+		}
+		if clientID == "" {
+			return fmt.Errorf("empty OAuth2 client ID")
+		}
+		o.oauth2 = &clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     tokenURL,
+			Scopes:       scopes,
+		}
+		return nil
+	}
+}
+
+// WithLayerFilter excludes the layers for which fn returns false from Layers and the merged view,
+// e.g. to inspect only the layers above the base image. fn is called with the position of the layer
+// in the manifest, from the bottom, and its descriptor. Excluded layers cost no requests.
+func WithLayerFilter(fn func(index int, desc v1.Descriptor) bool) Option {
+	return func(o *options) error {
+		if fn == nil {
+			return fmt.Errorf("layer filter must not be nil")
+		}
+		o.layerFilter = fn
+		return nil
+	}
+}
+
+// WithPathPrefix accesses the registry API under the path prefix, e.g. "/registry" for https://host/registry/v2/,
+// for registries served on a subpath behind a reverse proxy.
+func WithPathPrefix(prefix string) Option {
+	return func(o *options) error {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" {
+			return fmt.Errorf("empty path prefix")
+		}
+		if !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		o.pathPrefix = prefix
+		return nil
+	}
+}
+
+// WithBlobStore reads layers from the local store when the blobs are stored there,
+// falling back to the registry otherwise. The containerd subpackage adapts the content store of containerd.
+// Layers are resolved lazily as with LayersLazy so that locally stored ones cost no requests.
+func WithBlobStore(s BlobStore) Option {
+	return func(o *options) error {
+		if s == nil {
+			return fmt.Errorf("blob store must not be nil")
+		}
+		o.blobStore = s
+		return nil
+	}
+}
+
+// WithMaxRequests makes reads fail with ErrRequestBudgetExceeded once the layers returned by a Layers call
+// have issued n requests, including redirects and retries, to bound the cost of pathological TOCs
+// or fragmented files. Operations of the Remote such as ReadFile get their layers by their own calls,
+// so each of them is bounded on its own. Requests for the manifest and the config are not counted.
+func WithMaxRequests(n int) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid max requests %d: must be positive", n)
+		}
+		o.maxRequests = n
+		return nil
+	}
+}
+
+// WithMaxConcurrency limits the number of layers read at the same time by an operation,
+// such as parsing the TOCs to find a file, e.g. against rate-limited registries or on constrained networks.
+// By default, all the layers are read at once.
+func WithMaxConcurrency(n int) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid max concurrency %d: must be positive", n)
+		}
+		o.maxConcurrency = n
+		return nil
+	}
+}
+
+// WithRedirectRewriter rewrites the location of each redirect from the registry before following it,
+// e.g. to replace a far regional S3 endpoint with a closer one or a VPC endpoint.
+// fn receives a copy of the location and must return an absolute http or https URL.
+func WithRedirectRewriter(fn func(*url.URL) *url.URL) Option {
+	return func(o *options) error {
+		if fn == nil {
+			return fmt.Errorf("redirect rewriter must not be nil")
+		}
+		o.rewriteRedirect = fn
+		return nil
+	}
+}
+
+// WithRequestModifier calls fn with every request for blob ranges and every redirect hop to the blob,
+// after the URL of the request is final, e.g. to sign the request for storage requiring a per-request signature.
+// fn must modify the request in place, typically adding headers, and sees requests to the registry as well as
+// to the storage it redirects to, so it should leave requests to other hosts as is.
+// The oss and cos packages provide signers for Alibaba Cloud OSS and Tencent Cloud COS.
+func WithRequestModifier(fn func(*http.Request) error) Option {
+	return func(o *options) error {
+		if fn == nil {
+			return fmt.Errorf("request modifier must not be nil")
+		}
+		o.modifyRequest = fn
+		return nil
+	}
+}
+
+// WithProgress reports the progress of Layer.CopyFile, Layer.Download and Remote.WriteTar to fn
+// with the bytes done and the total bytes, e.g. to render a progress bar.
+// fn is called at most every 100ms per operation and always at the completion.
+// It may be called concurrently by concurrent operations.
+func WithProgress(fn func(done, total int64)) Option {
+	return func(o *options) error {
+		if fn == nil {
+			return fmt.Errorf("progress callback must not be nil")
+		}
+		o.progress = fn
+		return nil
+	}
+}
+
+// WithExternalTOCAnnotation reads the digest of the external TOC blob of a layer from the annotation of the key
+// instead of ExternalTOCDigestAnnotation.
+func WithExternalTOCAnnotation(key string) Option {
+	return func(o *options) error {
+		if key == "" {
+			return fmt.Errorf("empty external TOC annotation")
+		}
+		o.externalTOCAnnotation = key
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  remote.Option
+		want string
+	}{
+		{name: "scheme", opt: remote.WithScheme("ftp"), want: `invalid scheme "ftp": must be http or https`},
+		{name: "rate limit", opt: remote.WithRateLimit(0), want: "invalid rate limit 0: must be positive"},
+		{name: "retry attempts", opt: remote.WithRetry(0, 0), want: "invalid retry attempts 0: must be at least 1"},
+		{name: "layer cache", opt: remote.WithLayerCache(nil), want: "layer cache must not be nil"},
+		{name: "trace", opt: remote.WithTrace(nil), want: "trace writer must not be nil"},
+		{name: "disk cache", opt: remote.WithDiskCache(""), want: "empty disk cache directory"},
+		{name: "disk cache size", opt: remote.WithDiskCacheMaxBytes(-1), want: "invalid disk cache size -1: must be positive"},
+		{name: "chunk cache size", opt: remote.WithChunkCacheMaxBytes(0), want: "invalid chunk cache size 0: must be positive"},
+		{name: "labeled file", opt: remote.WithLabeledFile("etc/os-release", ""), want: `empty label key for "etc/os-release"`},
+		{name: "host override", opt: remote.WithHostOverride("", "127.0.0.1"), want: `invalid host override "" -> "127.0.0.1": host and address must not be empty`},
+		{name: "unix socket", opt: remote.WithUnixSocket(""), want: "empty unix socket path"},
+		{name: "read timeout", opt: remote.WithReadTimeout(0), want: "invalid read timeout 0s: must be positive"},
+		{name: "gzip index", opt: remote.WithGzipIndex(""), want: "empty gzip index directory"},
+		{name: "keychain", opt: remote.WithKeychain(nil), want: "keychain must not be nil"},
+		{name: "keychain paths", opt: remote.WithKeychainPaths([]string{""}), want: "empty keychain path"},
+		{name: "manifest cache", opt: remote.WithManifestCache(nil), want: "manifest cache must not be nil"},
+		{name: "file cache", opt: remote.WithFileCache(nil), want: "file cache must not be nil"},
+		{name: "max layers", opt: remote.WithMaxLayers(-1), want: "invalid max layers -1: must not be negative"},
+		{name: "profile", opt: remote.WithProfile(nil), want: "profile must not be nil"},
+		{name: "transport", opt: remote.WithTransport(nil), want: "transport must not be nil"},
+		{name: "max redirects", opt: remote.WithMaxRedirects(-1), want: "invalid max redirects -1: must not be negative"},
+		{name: "max full blob size", opt: remote.WithMaxFullBlobSize(-1), want: "invalid max full blob size -1: must not be negative"},
+		{name: "max idle connections", opt: remote.WithMaxIdleConnsPerHost(0), want: "invalid max idle connections per host 0: must be at least 1"},
+		{name: "format", opt: remote.WithForceFormat("bzip2"), want: `invalid format "bzip2": must be "gzip" or "zstd"`},
+		{name: "TOC spill", opt: remote.WithTOCSpill(0), want: "invalid TOC spill threshold 0: must be positive"},
+		{name: "OAuth2 token URL", opt: remote.WithOAuth2("", "id", "secret", nil), want: "empty OAuth2 token URL"},
+		{name: "OAuth2 client ID", opt: remote.WithOAuth2("https://auth.example.com/token", "", "secret", nil), want: "empty OAuth2 client ID"},
+		{name: "layer filter", opt: remote.WithLayerFilter(nil), want: "layer filter must not be nil"},
+		{name: "path prefix", opt: remote.WithPathPrefix("/"), want: "empty path prefix"},
+		{name: "blob store", opt: remote.WithBlobStore(nil), want: "blob store must not be nil"},
+		{name: "max requests", opt: remote.WithMaxRequests(0), want: "invalid max requests 0: must be positive"},
+		{name: "max concurrency", opt: remote.WithMaxConcurrency(0), want: "invalid max concurrency 0: must be positive"},
+		{name: "redirect rewriter", opt: remote.WithRedirectRewriter(nil), want: "redirect rewriter must not be nil"},
+		{name: "request modifier", opt: remote.WithRequestModifier(nil), want: "request modifier must not be nil"},
+		{name: "progress", opt: remote.WithProgress(nil), want: "progress callback must not be nil"},
+		{name: "external TOC annotation", opt: remote.WithExternalTOCAnnotation(""), want: "empty external TOC annotation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := remote.NewResolver(tt.opt)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("got %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxRequests(t *testing.T) {
+	tr := remotetest.NewTransport()
+	content := strings.Repeat("fragmented", 50)
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 10, remotetest.File{Name: "a", Content: content}))
+
+	r := remotetest.Open(t, tr, remote.WithMaxRequests(3))
+	if _, err := r.ReadFile(context.Background(), "a"); !errors.Is(err, remote.ErrRequestBudgetExceeded) {
+		t.Fatalf("expected %v, got %v", remote.ErrRequestBudgetExceeded, err)
+	}
+
+	r = remotetest.Open(t, tr, remote.WithMaxRequests(1000))
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != content {
+		t.Errorf("unexpected content %q", b)
+	}
+}
+
+func TestMaxRequestsPerOperation(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0,
+		remotetest.File{Name: "a", Content: strings.Repeat("a", 100)},
+		remotetest.File{Name: "b", Content: strings.Repeat("b", 100)},
+	))
+
+	// Measure the requests of each read on the same Remote
+	var requests int
+	counting := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return tr.RoundTrip(req)
+	})
+	r := remotetest.Open(t, counting)
+	requests = 0 // only the requests after opening the image are counted
+	var max int
+	for _, name := range []string{"a", "b"} {
+		before := requests
+		if _, err := r.ReadFile(context.Background(), name); err != nil {
+			t.Fatal(err)
+		}
+		if n := requests - before; n > max {
+			max = n
+		}
+	}
+	if requests <= max {
+		t.Fatalf("the reads issue %d requests in total, which doesn't exceed the budget of %d", requests, max)
+	}
+
+	// Each read is under the budget, though they exceed it together
+	r = remotetest.Open(t, tr, remote.WithMaxRequests(max))
+	for _, name := range []string{"a", "b"} {
+		b, err := r.ReadFile(context.Background(), name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(b) != strings.Repeat(name, 100) {
+			t.Errorf("unexpected content of %s %q", name, b)
+		}
+	}
+}
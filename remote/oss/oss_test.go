@@ -0,0 +1,108 @@
+package oss
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsOSS(t *testing.T) {
+	for host, want := range map[string]bool{
+		"bucket.oss-cn-hangzhou.aliyuncs.com":          true,
+		"bucket.oss-cn-hangzhou-internal.aliyuncs.com": true,
+		"oss-cn-hangzhou.aliyuncs.com:443":             true,
+		"BUCKET.OSS-CN-HANGZHOU.ALIYUNCS.COM":          true,
+		"ecs.cn-hangzhou.aliyuncs.com":                 false,
+		"oss-cn-hangzhou.example.com":                  false,
+		"registry.example.com":                         false,
+	} {
+		if got := IsOSS(host); got != want {
+			t.Errorf("IsOSS(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	now, err := time.Parse(http.TimeFormat, "Thu, 17 Nov 2005 18:49:58 GMT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The example of the OSS documentation
+	s := NewSigner("44CF9590006BF252F707", "OtxrzxIsfpFjA7SwPzILwy8Bw21TLhquhboDYROV")
+	s.now = func() time.Time { return now }
+
+	req, err := http.NewRequest(http.MethodPut, "http://oss-example.oss-cn-hangzhou.aliyuncs.com/nelson", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-MD5", "ODBGOERFMDMzQTczRUY3NUE3NzA5QzdFNUYzMDQxNEM=")
+	req.Header.Set("Content-Type", "text/html")
+	req.Header.Set("X-OSS-Meta-Author", "foo@example.com")
+	req.Header.Set("X-OSS-Magic", "abracadabra")
+	if err = s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := req.Header.Get("Date"), "Thu, 17 Nov 2005 18:49:58 GMT"; got != want {
+		t.Errorf("got date %q, want %q", got, want)
+	}
+	if got, want := req.Header.Get("Authorization"), "OSS 44CF9590006BF252F707:fV5fq7DPwNbrrig7nvUSZIVyruI="; got != want {
+		t.Errorf("got authorization %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "subresource", url: "http://bucket.oss-cn-hangzhou.aliyuncs.com/blob?versionId=v1&other=x", want: "/bucket/blob?versionId=v1"},
+		{name: "path style", url: "http://oss-cn-hangzhou.aliyuncs.com/bucket/blob", want: "/bucket/blob"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := canonicalizedResource(req); got != tt.want {
+			t.Errorf("%s: got resource %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSignSkipped(t *testing.T) {
+	s := NewSigner("id", "secret")
+	for _, u := range []string{
+		"https://registry.example.com/v2/",
+		"https://bucket.oss-cn-hangzhou.aliyuncs.com/blob?OSSAccessKeyId=id&Expires=1&Signature=presigned",
+		"https://bucket.oss-cn-hangzhou.aliyuncs.com/blob?x-oss-signature=presigned",
+	} {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Sign(req); err != nil {
+			t.Fatal(err)
+		}
+		if len(req.Header) != 0 {
+			t.Errorf("%s: got headers %v", u, req.Header)
+		}
+	}
+}
+
+func TestSignSecurityToken(t *testing.T) {
+	s := NewSigner("id", "secret")
+	s.SecurityToken = "token"
+	req, err := http.NewRequest(http.MethodGet, "https://bucket.oss-cn-hangzhou.aliyuncs.com/blob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("x-oss-security-token"); got != "token" {
+		t.Errorf("got token %q", got)
+	}
+	// The token is signed as an x-oss- header
+	if want := "GET\n\n\n" + req.Header.Get("Date") + "\nx-oss-security-token:token\n/bucket/blob"; stringToSign(req) != want {
+		t.Errorf("got %q, want %q", stringToSign(req), want)
+	}
+}
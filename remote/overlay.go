@@ -0,0 +1,298 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// whiteoutPrefix is the prefix of a file which hides the file without the prefix in lower layers.
+	whiteoutPrefix = ".wh."
+
+	// whiteoutOpaqueDir is a file which hides all the contents of its directory in lower layers.
+	whiteoutOpaqueDir = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// ErrNotFound is returned when the path doesn't exist in the image.
+var ErrNotFound = errors.New("not found")
+
+// Find returns the entry of the path in the merged view of the image and the layer containing it.
+// Layers are searched from the top, and whiteouts in upper layers hide the path in lower layers.
+// Use Locate for where the path comes from.
+func (r Remote) Find(ctx context.Context, p string) (*Layer, *estargz.TOCEntry, error) {
+	layers, i, e, err := r.find(ctx, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return layers[i], e, nil
+}
+
+// FindResult is where a path in the merged view of the image comes from.
+type FindResult struct {
+	// Path is the cleaned path as it is in the image, which differs from the requested one
+	// only in case when found by the case-insensitive lookup enabled by WithCaseInsensitive.
+	Path string
+
+	// Entry is the entry of the path. For a hard link, it is the entry of the link target.
+	Entry *estargz.TOCEntry
+
+	// Linked reports whether the path is a hard link resolved to Entry. Symbolic links are not followed.
+	Linked bool
+
+	// Layer is the layer providing the path, and LayerIndex and LayerDigest are its index in the image and digest.
+	Layer       *Layer
+	LayerIndex  int
+	LayerDigest v1.Hash
+
+	// Shadowed lists the indexes of the lower layers containing the path hidden by Layer, from the bottom.
+	Shadowed []int
+}
+
+// Locate is Find returning the provenance of the path, e.g. for explaining where a file comes from.
+func (r Remote) Locate(ctx context.Context, p string) (FindResult, error) {
+	layers, i, e, err := r.find(ctx, p)
+	if err != nil {
+		return FindResult{}, err
+	}
+
+	p = cleanPath(p)
+	esgz, _ := layers[i].Open()
+	res := FindResult{Path: p, Entry: e, Layer: layers[i], LayerIndex: layers[i].Index(), LayerDigest: layers[i].Digest()}
+	if _, ok := esgz.Lookup(p); ok {
+		res.Linked = e.Name != p
+	} else {
+		// Found case-insensitively
+		res.Path = e.Name
+	}
+
+	if whitedOut(esgz, res.Path) {
+		return res, nil
+	}
+	for j := i - 1; j >= 0; j-- {
+		esgz, _ := layers[j].Open()
+		if _, ok := esgz.Lookup(res.Path); ok {
+			res.Shadowed = append(res.Shadowed, layers[j].Index())
+		}
+		if whitedOut(esgz, res.Path) {
+			break
+		}
+	}
+	sort.Ints(res.Shadowed)
+	return res, nil
+}
+
+// find is Find returning all the layers and the index of the layer containing the path.
+func (r Remote) find(ctx context.Context, p string) ([]*Layer, int, *estargz.TOCEntry, error) {
+	layers, err := r.openLayers(ctx)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	i, e, err := r.findIn(layers, p)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return layers, i, e, nil
+}
+
+// findIn is find in the opened layers.
+func (r Remote) findIn(layers []*Layer, p string) (int, *estargz.TOCEntry, error) {
+	p = cleanPath(p)
+	for i := len(layers) - 1; i >= 0; i-- {
+		esgz, _ := layers[i].Open()
+		if e, ok := esgz.Lookup(p); ok {
+			return i, e, nil
+		}
+		if whitedOut(esgz, p) {
+			break
+		}
+	}
+
+	if r.opts.caseInsensitive {
+		if i, e, err := findFold(layers, p); err != nil {
+			return 0, nil, err
+		} else if e != nil {
+			return i, e, nil
+		}
+	}
+	return 0, nil, ErrNotFound
+}
+
+// AmbiguousPathError is returned by the case-insensitive lookup enabled by WithCaseInsensitive
+// when several paths differ from the path only by case.
+type AmbiguousPathError struct {
+	Path    string
+	Matches []string
+}
+
+func (e *AmbiguousPathError) Error() string {
+	return fmt.Sprintf("%s is ambiguous in case-insensitive match: %s", e.Path, strings.Join(e.Matches, ", "))
+}
+
+// findFold scans the merged view for the entry whose path matches p case-insensitively.
+// It returns a nil entry if nothing matches.
+func findFold(layers []*Layer, p string) (int, *estargz.TOCEntry, error) {
+	var (
+		index   int
+		found   *estargz.TOCEntry
+		matches []string
+	)
+	err := walkLayers(layers, func(i int, e *estargz.TOCEntry) error {
+		if strings.EqualFold(e.Name, p) {
+			index, found = i, e
+			matches = append(matches, e.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(matches) > 1 {
+		sort.Strings(matches)
+		return 0, nil, &AmbiguousPathError{Path: p, Matches: matches}
+	}
+	return index, found, nil
+}
+
+// Exists reports whether the path exists in the merged view of the image.
+// The content of the file isn't fetched.
+func (r Remote) Exists(ctx context.Context, p string) (bool, error) {
+	_, _, err := r.Find(ctx, p)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// StatMany returns the file info of each path in the merged view of the image, opening the layers only once.
+// Paths which don't exist, including whited-out ones, map to nil.
+func (r Remote) StatMany(ctx context.Context, paths []string) (map[string]os.FileInfo, error) {
+	layers, err := r.openLayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make(map[string]os.FileInfo, len(paths))
+	for _, p := range paths {
+		_, e, err := r.findIn(layers, p)
+		if errors.Is(err, ErrNotFound) {
+			infos[p] = nil
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		infos[p] = e.Stat()
+	}
+	return infos, nil
+}
+
+// Walk calls fn for every entry in the merged view of the image with the layer containing it.
+// Entries hidden by upper layers and whiteout files are skipped. Parent directories are visited first.
+func (r Remote) Walk(ctx context.Context, fn func(l *Layer, e *estargz.TOCEntry) error) error {
+	layers, err := r.openLayers(ctx)
+	if err != nil {
+		return err
+	}
+	return walkLayers(layers, func(i int, e *estargz.TOCEntry) error {
+		return fn(layers[i], e)
+	})
+}
+
+// walkLayers is Walk over the opened layers, passing the index of the layer containing each entry.
+func walkLayers(layers []*Layer, fn func(i int, e *estargz.TOCEntry) error) error {
+	seen := map[string]bool{}
+	for i := len(layers) - 1; i >= 0; i-- {
+		esgz, _ := layers[i].Open()
+		var werr error
+		walkEntries(esgz, func(e *estargz.TOCEntry) {
+			if werr != nil || seen[e.Name] || strings.HasPrefix(path.Base(e.Name), whiteoutPrefix) {
+				return
+			}
+			for _, upper := range layers[i+1:] {
+				upperTOC, _ := upper.Open()
+				if whitedOut(upperTOC, e.Name) {
+					return
+				}
+			}
+			seen[e.Name] = true
+			werr = fn(i, e)
+		})
+		if werr != nil {
+			return werr
+		}
+	}
+	return nil
+}
+
+// FindByDigest returns the paths of all files in the merged view whose content has the given digest.
+func (r Remote) FindByDigest(ctx context.Context, dgst string) ([]string, error) {
+	var paths []string
+	err := r.Walk(ctx, func(_ *Layer, e *estargz.TOCEntry) error {
+		if e.Type == "reg" && e.Digest == dgst {
+			paths = append(paths, e.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// openLayers returns the layers of the image after parsing their TOCs concurrently.
+func (r Remote) openLayers(ctx context.Context) ([]*Layer, error) {
+	layers, err := r.Layers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g, _ := errgroup.WithContext(ctx)
+	sem := newSemaphore(r.opts.maxConcurrency)
+	for _, layer := range layers {
+		l := layer
+		sem.acquire()
+		g.Go(func() error {
+			defer sem.release()
+			_, err := l.Open()
+			return err
+		})
+	}
+	if err = g.Wait(); err != nil {
+		return nil, err
+	}
+	return layers, nil
+}
+
+// whitedOut reports whether the layer hides the path in lower layers,
+// i.e. the layer has a whiteout of the path or one of its parents, or one of its parents is an opaque directory.
+func whitedOut(esgz *estargz.Reader, p string) bool {
+	for p != "" {
+		dir, base := path.Split(p)
+		dir = strings.TrimSuffix(dir, "/")
+		if _, ok := esgz.Lookup(path.Join(dir, whiteoutPrefix+base)); ok {
+			return true
+		}
+		if _, ok := esgz.Lookup(path.Join(dir, whiteoutOpaqueDir)); ok {
+			return true
+		}
+		p = dir
+	}
+	return false
+}
+
+// cleanPath normalizes the path in the same way as entry names in the TOC.
+func cleanPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
@@ -0,0 +1,287 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// overlayLayers are the layers of an image with files shadowed and whited out by upper layers.
+var overlayLayers = [][]remotetest.File{
+	{
+		{Name: "etc/"},
+		{Name: "etc/os-release", Content: "lower"},
+		{Name: "etc/removed", Content: "removed"},
+		{Name: "var/"},
+		{Name: "var/lib/"},
+		{Name: "var/lib/data", Content: "data"},
+	},
+	{
+		{Name: "etc/"},
+		{Name: "etc/.wh.removed"},
+		{Name: "var/"},
+		{Name: "var/.wh..wh..opq"},
+	},
+	{
+		{Name: "etc/"},
+		{Name: "etc/os-release", Content: "upper"},
+	},
+}
+
+func TestExists(t *testing.T) {
+	r := newRemote(t, overlayLayers)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "etc/os-release", want: true},
+		{path: "/etc/os-release", want: true},
+		{path: "etc", want: true},
+		{path: "etc/missing", want: false},
+		{path: "etc/removed", want: false},
+		{path: "var/lib/data", want: false},
+		{path: "var", want: true},
+	}
+	for _, tt := range tests {
+		got, err := r.Exists(context.Background(), tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFindByDigest(t *testing.T) {
+	r := newRemote(t, [][]remotetest.File{
+		{
+			{Name: "a", Content: "shared"},
+			{Name: "shadowed", Content: "shared"},
+			{Name: "other", Content: "different"},
+		},
+		{
+			{Name: "d/"},
+			{Name: "d/b", Content: "shared"},
+			{Name: "shadowed", Content: "replaced"},
+		},
+	})
+	dgst := digest.FromString("shared").String()
+	got, err := r.FindByDigest(context.Background(), dgst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "d/b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	layers := [][]remotetest.File{{
+		{Name: "etc/"},
+		{Name: "etc/Hosts", Content: "hosts"},
+		{Name: "etc/README", Content: "upper"},
+		{Name: "etc/readme", Content: "lower"},
+	}}
+	r := newRemote(t, layers, remote.WithCaseInsensitive())
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "exact", path: "etc/Hosts", want: "etc/Hosts"},
+		{name: "case fold", path: "/ETC/hosts", want: "etc/Hosts"},
+		{name: "exact among case variants", path: "etc/readme", want: "etc/readme"},
+	}
+	for _, tt := range tests {
+		_, e, err := r.Find(context.Background(), tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if e.Name != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, e.Name, tt.want)
+		}
+	}
+
+	_, _, err := r.Find(context.Background(), "etc/Readme")
+	var ambiguous *remote.AmbiguousPathError
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("got %v, want AmbiguousPathError", err)
+	}
+	if want := []string{"etc/README", "etc/readme"}; !reflect.DeepEqual(ambiguous.Matches, want) {
+		t.Errorf("got %q, want %q", ambiguous.Matches, want)
+	}
+
+	// Exact matching is the default
+	if _, _, err = newRemote(t, layers).Find(context.Background(), "etc/hosts"); !errors.Is(err, remote.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestStatMany(t *testing.T) {
+	var blobs [][]byte
+	for _, files := range overlayLayers {
+		blobs = append(blobs, remotetest.Layer(t, 0, files...))
+	}
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, blobs...)
+
+	paths := []string{"etc/os-release", "etc", "etc/missing", "etc/removed", "var/lib/data", "var"}
+	tr := &countingTransport{inner: inner}
+	infos, err := remotetest.Open(t, tr).StatMany(context.Background(), paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != len(paths) {
+		t.Errorf("expected %d results, got %d", len(paths), len(infos))
+	}
+	if fi := infos["etc/os-release"]; fi == nil || fi.Size() != int64(len("upper")) || fi.IsDir() {
+		t.Errorf("unexpected info of etc/os-release: %v", fi)
+	}
+	for _, p := range []string{"etc", "var"} {
+		if fi := infos[p]; fi == nil || !fi.IsDir() {
+			t.Errorf("%s: expected a directory, got %v", p, fi)
+		}
+	}
+	for _, p := range []string{"etc/missing", "etc/removed", "var/lib/data"} {
+		if fi, ok := infos[p]; !ok || fi != nil {
+			t.Errorf("%s: expected nil, got %v", p, fi)
+		}
+	}
+
+	// The layers are opened once however many paths are statted
+	single := &countingTransport{inner: inner}
+	if _, err = remotetest.Open(t, single).StatMany(context.Background(), paths[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if tr.count() != single.count() {
+		t.Errorf("statting %d paths sent %d range requests, while 1 path sent %d", len(paths), tr.count(), single.count())
+	}
+}
+
+func TestLayerFilter(t *testing.T) {
+	var blobs [][]byte
+	for _, files := range overlayLayers {
+		blobs = append(blobs, remotetest.Layer(t, 0, files...))
+	}
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, blobs...)
+	digests := map[string]int{}
+	for _, l := range layersOf(t, remotetest.Open(t, inner)) {
+		digests[l.Digest().String()] = l.Index()
+	}
+
+	tests := []struct {
+		name   string
+		filter func(index int, desc v1.Descriptor) bool
+		want   map[string]string // the content of each path, or "" if not found
+	}{
+		{
+			name:   "base only",
+			filter: func(index int, _ v1.Descriptor) bool { return index == 0 },
+			want:   map[string]string{"etc/os-release": "lower", "etc/removed": "removed", "var/lib/data": "data"},
+		},
+		{
+			name:   "below the top",
+			filter: func(index int, _ v1.Descriptor) bool { return index < 2 },
+			want:   map[string]string{"etc/os-release": "lower", "etc/removed": "", "var/lib/data": ""},
+		},
+		{
+			name:   "top only",
+			filter: func(index int, _ v1.Descriptor) bool { return index == 2 },
+			want:   map[string]string{"etc/os-release": "upper", "etc/removed": "", "var/lib/data": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requested := map[int]bool{}
+			tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if i, ok := digests[path.Base(req.URL.Path)]; ok {
+					mu.Lock()
+					requested[i] = true
+					mu.Unlock()
+				}
+				return inner.RoundTrip(req)
+			})
+			r := remotetest.Open(t, tr, remote.WithLayerFilter(tt.filter))
+			for p, want := range tt.want {
+				b, err := r.ReadFile(context.Background(), p)
+				if want == "" {
+					if !errors.Is(err, remote.ErrNotFound) {
+						t.Errorf("%s: expected ErrNotFound, got %q, %v", p, b, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s: %v", p, err)
+				}
+				if string(b) != want {
+					t.Errorf("%s: got %q, want %q", p, b, want)
+				}
+			}
+			for i := range requested {
+				if !tt.filter(i, v1.Descriptor{}) {
+					t.Errorf("excluded layer %d is requested", i)
+				}
+			}
+		})
+	}
+}
+
+func TestLocate(t *testing.T) {
+	layers := [][]remotetest.File{
+		{{Name: "etc/"}, {Name: "etc/os-release", Content: "0"}, {Name: "opt/"}, {Name: "opt/app", Content: "0"}},
+		{{Name: "etc/"}, {Name: "etc/.wh.os-release"}, {Name: "opt/"}, {Name: "opt/app", Content: "1"}},
+		{{Name: "etc/"}, {Name: "etc/os-release", Content: "2"}},
+		{{Name: "etc/"}, {Name: "etc/os-release", Content: "3"}, {Name: "opt/"}, {Name: "opt/app", Content: "3"}},
+	}
+	r := newRemote(t, layers, remote.WithCaseInsensitive())
+	digests := make([]v1.Hash, len(layers))
+	for i, l := range layersOf(t, r) {
+		digests[i] = l.Digest()
+	}
+
+	tests := []struct {
+		path     string
+		wantPath string
+		layer    int
+		shadowed []int
+	}{
+		// The whiteout in layer 1 hides layer 0 from layer 3
+		{path: "etc/os-release", wantPath: "etc/os-release", layer: 3, shadowed: []int{2}},
+		{path: "/opt/app", wantPath: "opt/app", layer: 3, shadowed: []int{0, 1}},
+		{path: "OPT/App", wantPath: "opt/app", layer: 3, shadowed: []int{0, 1}},
+		{path: "opt", wantPath: "opt", layer: 3, shadowed: []int{0, 1}},
+	}
+	for _, tt := range tests {
+		res, err := r.Locate(context.Background(), tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if res.Path != tt.wantPath || res.Entry.Name != tt.wantPath || res.Linked {
+			t.Errorf("%s: got path %q, entry %q, linked %v", tt.path, res.Path, res.Entry.Name, res.Linked)
+		}
+		if res.LayerIndex != tt.layer || res.Layer.Index() != tt.layer || res.LayerDigest != digests[tt.layer] {
+			t.Errorf("%s: got layer %d (%s), want %d", tt.path, res.LayerIndex, res.LayerDigest, tt.layer)
+		}
+		if !reflect.DeepEqual(res.Shadowed, tt.shadowed) {
+			t.Errorf("%s: got shadowed %v, want %v", tt.path, res.Shadowed, tt.shadowed)
+		}
+	}
+
+	if _, err := r.Locate(context.Background(), "etc/missing"); !errors.Is(err, remote.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// ReadPlan is the estimate of the compressed bytes transferred to read files from the merged view of the image.
+// Caches are not taken into account, so it is the cost of the first read.
+type ReadPlan struct {
+	// FooterBytes and TOCBytes are the footers and the TOCs of all layers, which are parsed to look up the files.
+	FooterBytes int64
+	TOCBytes    int64
+
+	// ChunkBytes is the compressed content of the files.
+	ChunkBytes int64
+}
+
+// Total returns the total bytes transferred.
+func (p ReadPlan) Total() int64 {
+	return p.FooterBytes + p.TOCBytes + p.ChunkBytes
+}
+
+// PlanRead estimates the bytes transferred to read the files at the paths.
+// Only the footers and the TOCs are fetched to open the layers, not the content of the files.
+func (r Remote) PlanRead(ctx context.Context, paths ...string) (ReadPlan, error) {
+	layers, err := r.openLayers(ctx)
+	if err != nil {
+		return ReadPlan{}, err
+	}
+
+	var plan ReadPlan
+	for _, l := range layers {
+		footer, toc, err := l.metadataSize()
+		if err != nil {
+			return ReadPlan{}, err
+		}
+		plan.FooterBytes += footer
+		plan.TOCBytes += toc
+	}
+
+	for _, p := range paths {
+		i, e, err := r.findIn(layers, p)
+		if err != nil {
+			return ReadPlan{}, err
+		}
+		if e.Type != "reg" {
+			return ReadPlan{}, &os.PathError{Op: "open", Path: p, Err: errors.New("not a regular file")}
+		}
+		if e.Size == 0 {
+			continue
+		}
+		if layers[i].gzipIndex != nil {
+			continue
+		}
+		esgz, err := layers[i].Open()
+		if err != nil {
+			return ReadPlan{}, err
+		}
+		for _, ce := range chunksOf(esgz, e) {
+			plan.ChunkBytes += ce.NextOffset() - ce.Offset
+		}
+	}
+	return plan, nil
+}
+
+// metadataSize returns the sizes of the footer and the TOC of the opened layer.
+// The footer read by Open is parsed again without fetching it.
+// An external TOC has no footer, and its size is known once it's fetched.
+// Layers read through the gzip index set by WithGzipIndex cost nothing after the index is built.
+func (l *Layer) metadataSize() (footer, toc int64, err error) {
+	if l.externalTOC != nil {
+		return 0, l.externalTOC.size, nil
+	}
+
+	if l.gzipIndex != nil {
+		// Read through the local index
+		return 0, 0, nil
+	}
+	if l.Format() != FormatGzip {
+		_, toc, err := l.parseFooter()
+		return l.decompressor().FooterSize(), toc, err
+	}
+
+	tocOffset, footerSize, err := estargz.OpenFooter(l.footerSection())
+	if err != nil {
+		return 0, 0, err
+	}
+	return footerSize, l.size - tocOffset - footerSize, nil
+}
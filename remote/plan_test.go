@@ -0,0 +1,46 @@
+package remote_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestPlanRead(t *testing.T) {
+	tr := &countingTransport{inner: remotetest.NewTransport()}
+	remotetest.PushLayers(t, tr,
+		remotetest.Layer(t, 0, remotetest.File{Name: "bin/sh", Content: strings.Repeat("sh", 1000)}),
+		remotetest.Layer(t, 0, remotetest.File{Name: "etc/os-release", Content: "ID=test\n"}),
+	)
+	r := remotetest.Open(t, tr)
+
+	plan, err := r.PlanRead(context.Background(), "bin/sh", "etc/os-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.FooterBytes != 2*estargz.FooterSize {
+		t.Errorf("unexpected footer bytes %d", plan.FooterBytes)
+	}
+	if plan.TOCBytes <= 0 || plan.ChunkBytes <= 0 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+	if plan.Total() != plan.FooterBytes+plan.TOCBytes+plan.ChunkBytes {
+		t.Errorf("unexpected total %d", plan.Total())
+	}
+
+	// Only the footer and the TOC of each layer are fetched, once
+	if n := tr.count(); n != 4 {
+		t.Errorf("expected 4 range requests, got %d", n)
+	}
+
+	if _, err := r.PlanRead(context.Background(), "missing"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	if _, err := r.PlanRead(context.Background(), "etc"); err == nil {
+		t.Error("expected an error for a directory")
+	}
+}
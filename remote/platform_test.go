@@ -0,0 +1,125 @@
+package remote_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	gremote "github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// pushIndex pushes an index of images for linux/amd64 and linux/arm64 to tr, returning its digest.
+// The file etc/arch of each image has its architecture, and so does the file only-<arch>.
+func pushIndex(t *testing.T, tr http.RoundTripper) v1.Hash {
+	t.Helper()
+	idx := v1.ImageIndex(empty.Index)
+	for _, arch := range []string{"amd64", "arm64"} {
+		img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0,
+			remotetest.File{Name: "etc/"},
+			remotetest.File{Name: "etc/arch", Content: arch},
+			remotetest.File{Name: "only-" + arch, Content: arch},
+		)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: arch}},
+		})
+	}
+	ref, err := name.ParseReference(remotetest.Reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = gremote.WriteIndex(ref, idx, gremote.WithTransport(tr)); err != nil {
+		t.Fatal(err)
+	}
+	d, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestPlatform(t *testing.T) {
+	tr := remotetest.NewTransport()
+	pushIndex(t, tr)
+
+	// The caches are shared by the platforms
+	cache := remote.NewManifestCache(time.Hour, 0)
+	dir := t.TempDir()
+	for _, offline := range []bool{false, true} {
+		for _, arch := range []string{"amd64", "arm64", "amd64"} {
+			opts := []remote.Option{remote.WithPlatform(v1.Platform{OS: "linux", Architecture: arch}), remote.WithManifestCache(cache), remote.WithDiskCache(dir)}
+			if offline {
+				opts = append(opts, remote.WithOffline())
+			}
+			r := remotetest.Open(t, tr, opts...)
+			b, err := r.ReadFile(context.Background(), "etc/arch")
+			if err != nil {
+				t.Fatalf("%s (offline %v): %v", arch, offline, err)
+			}
+			if string(b) != arch {
+				t.Errorf("%s (offline %v): got %q", arch, offline, b)
+			}
+			other := map[string]string{"amd64": "arm64", "arm64": "amd64"}[arch]
+			if ok, err := r.Exists(context.Background(), "only-"+other); err != nil || ok {
+				t.Errorf("%s (offline %v): the file of %s exists: %v", arch, offline, other, err)
+			}
+			if _, err = r.ReadFile(context.Background(), "only-"+arch); err != nil {
+				t.Errorf("%s (offline %v): %v", arch, offline, err)
+			}
+		}
+	}
+
+	if _, err := remote.New(remotetest.Reference, remote.WithTransport(tr), remote.WithPlatform(v1.Platform{OS: "linux", Architecture: "s390x"})); err == nil {
+		t.Error("expected an error for a missing platform")
+	}
+}
+
+func TestIndexDigest(t *testing.T) {
+	inner := remotetest.NewTransport()
+	d := pushIndex(t, inner)
+	ref, err := name.ParseReference(remotetest.Reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digestRef := ref.Context().Digest(d.String()).String()
+
+	// Some registries serve manifests with a generic Content-Type, which doesn't tell an index from an image
+	generic := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := inner.RoundTrip(req)
+		if err == nil && strings.Contains(req.URL.Path, "/manifests/") {
+			res.Header.Set("Content-Type", "application/octet-stream")
+		}
+		return res, err
+	})
+
+	for name, tr := range map[string]http.RoundTripper{"content type": inner, "generic content type": generic} {
+		for _, arch := range []string{"amd64", "arm64"} {
+			r, err := remote.New(digestRef, remote.WithTransport(tr), remote.WithPlatform(v1.Platform{OS: "linux", Architecture: arch}))
+			if err != nil {
+				t.Fatalf("%s, %s: %v", name, arch, err)
+			}
+			if layers := layersOf(t, r); len(layers) != 1 {
+				t.Errorf("%s, %s: expected 1 layer, got %d", name, arch, len(layers))
+			}
+			b, err := r.ReadFile(context.Background(), "etc/arch")
+			if err != nil {
+				t.Fatalf("%s, %s: %v", name, arch, err)
+			}
+			if string(b) != arch {
+				t.Errorf("%s, %s: got %q", name, arch, b)
+			}
+		}
+	}
+}
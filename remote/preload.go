@@ -0,0 +1,114 @@
+package remote
+
+import (
+	"context"
+	"sort"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// preloadMergeGap is the maximum gap between two chunks merged into one range request.
+	preloadMergeGap = 64 << 10
+
+	// preloadMaxRange is the maximum size of a merged range request.
+	preloadMaxRange = 16 << 20
+)
+
+// PreloadSmallFiles fetches the content of all files whose size is at most maxSize
+// with as few range requests as possible and stores it in the chunk cache.
+// Subsequent reads of those files are served from the cache.
+func (r Remote) PreloadSmallFiles(ctx context.Context, maxSize int64) error {
+	layers, err := r.Layers(ctx)
+	if err != nil {
+		return err
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	sem := newSemaphore(r.opts.maxConcurrency)
+	for _, layer := range layers {
+		l := layer
+		sem.acquire()
+		g.Go(func() error {
+			defer sem.release()
+			return l.preload(ctx, maxSize)
+		})
+	}
+	return g.Wait()
+}
+
+type byteRange struct {
+	begin, end int64 // [begin, end)
+}
+
+func (l *Layer) preload(ctx context.Context, maxSize int64) error {
+	esgz, err := l.Open()
+	if err != nil {
+		return err
+	}
+	if l.gzipIndex != nil {
+		// Already local
+		return nil
+	}
+
+	var ranges []byteRange
+	walkEntries(esgz, func(e *estargz.TOCEntry) {
+		if e.Type != "reg" || e.Size == 0 || e.Size > maxSize {
+			return
+		}
+		ranges = append(ranges, byteRange{begin: e.Offset, end: e.NextOffset()})
+	})
+
+	for _, rng := range mergeRanges(ranges) {
+		b, err := makeBuffer(rng.end - rng.begin)
+		if err != nil {
+			return err
+		}
+		if err = l.readRange(ctx, b, rng.begin); err != nil {
+			return err
+		}
+		l.cache.add(l.digest, rng.begin, b)
+	}
+	return nil
+}
+
+// mergeRanges sorts the ranges and merges ones close to each other.
+func mergeRanges(ranges []byteRange) []byteRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].begin < ranges[j].begin
+	})
+
+	var merged []byteRange
+	for _, rng := range ranges {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if rng.begin-last.end <= preloadMergeGap && rng.end-last.begin <= preloadMaxRange {
+				if rng.end > last.end {
+					last.end = rng.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, rng)
+	}
+	return merged
+}
+
+// walkEntries calls fn for every entry in the TOC except chunks, parents first.
+func walkEntries(r *estargz.Reader, fn func(e *estargz.TOCEntry)) {
+	root, ok := r.Lookup("")
+	if !ok {
+		return
+	}
+
+	var walk func(e *estargz.TOCEntry)
+	walk = func(e *estargz.TOCEntry) {
+		fn(e)
+		e.ForeachChild(func(_ string, child *estargz.TOCEntry) bool {
+			walk(child)
+			return true
+		})
+	}
+	walk(root)
+}
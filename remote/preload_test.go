@@ -0,0 +1,104 @@
+package remote_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+const smallFiles = 100
+
+// pushSmallFiles pushes an image of a layer with many small files and a large one.
+func pushSmallFiles(t testing.TB, tr *countingTransport) {
+	t.Helper()
+	files := []remotetest.File{{Name: "etc/"}}
+	for i := 0; i < smallFiles; i++ {
+		files = append(files, remotetest.File{Name: fmt.Sprintf("etc/conf%d", i), Content: fmt.Sprintf("key%d=%s\n", i, strings.Repeat("v", i))})
+	}
+	files = append(files, remotetest.File{Name: "large", Content: strings.Repeat("large", 1000)})
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, files...))
+}
+
+// readSmallFiles reads every small file through the layer.
+func readSmallFiles(t testing.TB, l *remote.Layer) {
+	t.Helper()
+	esgz, err := l.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < smallFiles; i++ {
+		sr, err := esgz.OpenFile(fmt.Sprintf("etc/conf%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(sr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("key%d=%s\n", i, strings.Repeat("v", i)); string(b) != want {
+			t.Fatalf("unexpected content %q", b)
+		}
+	}
+}
+
+func TestPreloadSmallFiles(t *testing.T) {
+	tr := &countingTransport{inner: remotetest.NewTransport()}
+	pushSmallFiles(t, tr)
+	r := remotetest.Open(t, tr)
+
+	if err := r.PreloadSmallFiles(context.Background(), 1024); err != nil {
+		t.Fatal(err)
+	}
+	l := layersOf(t, r)[0]
+	esgz, err := l.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := tr.count()
+	readSmallFiles(t, l)
+	if got := tr.count() - n; got != 0 {
+		t.Errorf("reading preloaded files sent %d requests", got)
+	}
+
+	// The large file isn't preloaded
+	sr, err := esgz.OpenFile("large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadAll(sr); err != nil {
+		t.Fatal(err)
+	}
+	if got := tr.count() - n; got == 0 {
+		t.Error("the large file is preloaded")
+	}
+}
+
+func BenchmarkReadSmallFiles(b *testing.B) {
+	for _, preload := range []bool{false, true} {
+		b.Run(fmt.Sprintf("preload=%v", preload), func(b *testing.B) {
+			tr := &countingTransport{inner: remotetest.NewTransport()}
+			pushSmallFiles(b, tr)
+			b.ResetTimer()
+
+			var requests int
+			for i := 0; i < b.N; i++ {
+				r := remotetest.Open(b, tr)
+				n := tr.count()
+				if preload {
+					if err := r.PreloadSmallFiles(context.Background(), 1024); err != nil {
+						b.Fatal(err)
+					}
+				}
+				readSmallFiles(b, layersOf(b, r)[0])
+				requests += tr.count() - n
+			}
+			b.ReportMetric(float64(requests)/float64(b.N), "requests/op")
+		})
+	}
+}
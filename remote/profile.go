@@ -0,0 +1,164 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the latency histogram buckets of Profile.
+// The last bucket counts requests slower than all of them.
+var LatencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Profile aggregates the requests to the registry per operation for performance investigation,
+// such as tuning the caches and the concurrency. Set it with WithProfile.
+// It is heavier than tracing only the requests since every response body is counted.
+type Profile struct {
+	mu  sync.Mutex
+	ops map[string]*OperationProfile
+}
+
+// OperationProfile is the aggregate of an operation, e.g. "manifest" or "range".
+type OperationProfile struct {
+	Requests int
+	Errors   int
+	Bytes    int64 // the bytes of the response bodies read
+
+	// Latency is the histogram of the time to the response headers, bucketed by LatencyBuckets.
+	Latency []int
+}
+
+// NewProfile returns an empty Profile.
+func NewProfile() *Profile {
+	return &Profile{ops: map[string]*OperationProfile{}}
+}
+
+// Operations returns a snapshot of the aggregates keyed by operation.
+func (p *Profile) Operations() map[string]OperationProfile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ops := make(map[string]OperationProfile, len(p.ops))
+	for name, op := range p.ops {
+		snapshot := *op
+		snapshot.Latency = append([]int(nil), op.Latency...)
+		ops[name] = snapshot
+	}
+	return ops
+}
+
+// WriteSummary writes the aggregates as a table.
+func (p *Profile) WriteSummary(w io.Writer) error {
+	ops := p.Operations()
+	names := make([]string, 0, len(ops))
+	for name := range ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := []string{"OPERATION", "REQUESTS", "ERRORS", "BYTES"}
+	for _, b := range LatencyBuckets {
+		header = append(header, "<"+b.String())
+	}
+	header = append(header, ">="+LatencyBuckets[len(LatencyBuckets)-1].String())
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, name := range names {
+		op := ops[name]
+		row := []string{name, fmt.Sprint(op.Requests), fmt.Sprint(op.Errors), fmt.Sprint(op.Bytes)}
+		for _, n := range op.Latency {
+			row = append(row, fmt.Sprint(n))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (p *Profile) operation(name string) *OperationProfile {
+	op, ok := p.ops[name]
+	if !ok {
+		op = &OperationProfile{Latency: make([]int, len(LatencyBuckets)+1)}
+		p.ops[name] = op
+	}
+	return op
+}
+
+func (p *Profile) record(name string, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	op := p.operation(name)
+	op.Requests++
+	if err != nil {
+		op.Errors++
+	}
+	i := sort.Search(len(LatencyBuckets), func(i int) bool { return latency < LatencyBuckets[i] })
+	op.Latency[i]++
+}
+
+func (p *Profile) addBytes(name string, n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.operation(name).Bytes += n
+}
+
+// operationOf classifies the request to the registry or the redirected blob storage.
+func operationOf(req *http.Request) string {
+	switch {
+	case req.Header.Get("Range") != "":
+		return "range"
+	case strings.Contains(req.URL.Path, "/manifests/"):
+		return "manifest"
+	case strings.Contains(req.URL.Path, "/blobs/"):
+		return "blob"
+	case req.URL.Path == "/v2/":
+		return "ping"
+	}
+	return "other"
+}
+
+// profileTransport records every request to the profile.
+type profileTransport struct {
+	inner   http.RoundTripper
+	profile *Profile
+}
+
+func (t *profileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op := operationOf(req)
+	start := time.Now()
+	res, err := t.inner.RoundTrip(req)
+	t.profile.record(op, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = &countingBody{ReadCloser: res.Body, profile: t.profile, op: op}
+	return res, nil
+}
+
+// countingBody adds the bytes read from the body to the profile.
+type countingBody struct {
+	io.ReadCloser
+	profile *Profile
+	op      string
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.profile.addBytes(b.op, int64(n))
+	}
+	return n, err
+}
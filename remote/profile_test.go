@@ -0,0 +1,69 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestProfile(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "profiled"}))
+	var ranges, manifests int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		switch {
+		case req.Header.Get("Range") != "":
+			atomic.AddInt32(&ranges, 1)
+		case strings.Contains(req.URL.Path, "/manifests/"):
+			atomic.AddInt32(&manifests, 1)
+		}
+		return inner.RoundTrip(req)
+	})
+
+	p := remote.NewProfile()
+	r := remotetest.Open(t, tr, remote.WithProfile(p))
+	if r.Profile() != p {
+		t.Fatal("Profile() doesn't return the profile")
+	}
+	if _, err := r.ReadFile(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	ops := p.Operations()
+	for name, want := range map[string]int32{"range": ranges, "manifest": manifests} {
+		if want == 0 {
+			t.Fatalf("no %s request", name)
+		}
+		op := ops[name]
+		if op.Requests != int(want) {
+			t.Errorf("%s: got %d requests, want %d", name, op.Requests, want)
+		}
+		if op.Errors != 0 {
+			t.Errorf("%s: got %d errors", name, op.Errors)
+		}
+		if op.Bytes == 0 {
+			t.Errorf("%s: no bytes counted", name)
+		}
+		var n int
+		for _, c := range op.Latency {
+			n += c
+		}
+		if n != op.Requests {
+			t.Errorf("%s: got %d requests in the histogram, want %d", name, n, op.Requests)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteSummary(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "OPERATION") || !strings.Contains(buf.String(), "\nrange ") {
+		t.Errorf("unexpected summary:\n%s", buf.String())
+	}
+}
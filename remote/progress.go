@@ -0,0 +1,44 @@
+package remote
+
+import "time"
+
+// progressInterval is the minimum interval between calls of the callback set by WithProgress.
+const progressInterval = 100 * time.Millisecond
+
+// progress reports the bytes done of an operation to the callback set by WithProgress.
+// The callback is called at most every progressInterval so that a slow one doesn't hold up reading,
+// except that the completion is always reported. A nil progress reports nothing.
+type progress struct {
+	fn    func(done, total int64)
+	total int64
+	done  int64
+	last  time.Time
+}
+
+// newProgress returns the progress of an operation of total bytes, or nil if fn is nil.
+func newProgress(fn func(done, total int64), total int64) *progress {
+	if fn == nil {
+		return nil
+	}
+	return &progress{fn: fn, total: total}
+}
+
+// set reports that done bytes have been processed.
+func (p *progress) set(done int64) {
+	if p == nil || done <= p.done {
+		return
+	}
+	p.done = done
+	if now := time.Now(); done >= p.total || now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.fn(done, p.total)
+	}
+}
+
+// Write reports the bytes written to the progress, e.g. through io.MultiWriter.
+func (p *progress) Write(b []byte) (int, error) {
+	if p != nil {
+		p.set(p.done + int64(len(b)))
+	}
+	return len(b), nil
+}
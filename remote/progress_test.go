@@ -0,0 +1,105 @@
+package remote_test
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// progressRecorder records the calls of the callback set by WithProgress.
+type progressRecorder struct {
+	done, total []int64
+}
+
+func (r *progressRecorder) update(done, total int64) {
+	r.done = append(r.done, done)
+	r.total = append(r.total, total)
+}
+
+// check verifies that the progress increased monotonically up to total.
+func (r *progressRecorder) check(t *testing.T, total int64) {
+	t.Helper()
+	if len(r.done) == 0 {
+		t.Fatal("no progress reported")
+	}
+	for i := range r.done {
+		if r.total[i] != total {
+			t.Errorf("call %d: got total %d, want %d", i, r.total[i], total)
+		}
+		if i > 0 && r.done[i] <= r.done[i-1] {
+			t.Errorf("call %d: progress went from %d to %d", i, r.done[i-1], r.done[i])
+		}
+	}
+	if last := r.done[len(r.done)-1]; last != total {
+		t.Errorf("got final progress %d, want %d", last, total)
+	}
+}
+
+func TestWithProgress(t *testing.T) {
+	const chunkSize = 64
+	content := strings.Repeat("progress", 1000)
+	blob := remotetest.Layer(t, chunkSize, remotetest.File{Name: "file", Content: content}, remotetest.File{Name: "small", Content: "small"})
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, blob)
+
+	t.Run("copy", func(t *testing.T) {
+		var rec progressRecorder
+		l := layersOf(t, remotetest.Open(t, tr, remote.WithProgress(rec.update)))[0]
+		if _, err := l.CopyFile(ioutil.Discard, "file"); err != nil {
+			t.Fatal(err)
+		}
+		rec.check(t, int64(len(content)))
+		// The callback is rate limited rather than called for each chunk
+		if chunks := len(content) / chunkSize; len(rec.done) >= chunks {
+			t.Errorf("got %d calls for %d chunks", len(rec.done), chunks)
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		tr := remotetest.NewTransport()
+		remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "empty"}))
+		var rec progressRecorder
+		l := layersOf(t, remotetest.Open(t, tr, remote.WithProgress(rec.update)))[0]
+		if _, err := l.CopyFile(ioutil.Discard, "empty"); err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.done) != 1 || rec.done[0] != 0 || rec.total[0] != 0 {
+			t.Errorf("got progress %v of %v, want a single (0, 0)", rec.done, rec.total)
+		}
+	})
+	t.Run("sparse", func(t *testing.T) {
+		// The file ends with a hole, which counts toward the total
+		sparse := strings.Repeat("0123456789abcdef", 4)
+		tr := remotetest.NewTransport()
+		remotetest.PushLayers(t, tr, sparseLayer(t, sparse, 16, 16, 48))
+		var rec progressRecorder
+		l := layersOf(t, remotetest.Open(t, tr, remote.WithProgress(rec.update)))[0]
+		if _, err := l.CopyFile(ioutil.Discard, "file"); err != nil {
+			t.Fatal(err)
+		}
+		rec.check(t, int64(len(sparse)))
+	})
+	t.Run("download", func(t *testing.T) {
+		var rec progressRecorder
+		l := layersOf(t, remotetest.Open(t, tr, remote.WithProgress(rec.update)))[0]
+		if _, err := l.Download(context.Background(), ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+		rec.check(t, int64(len(blob)))
+	})
+	t.Run("tar", func(t *testing.T) {
+		var rec progressRecorder
+		r := remotetest.Open(t, tr, remote.WithProgress(rec.update))
+		if err := r.WriteTar(context.Background(), ioutil.Discard, "/"); err != nil {
+			t.Fatal(err)
+		}
+		rec.check(t, int64(len(content)+len("small")))
+	})
+
+	if _, err := remote.New(remotetest.Reference, remote.WithTransport(tr), remote.WithProgress(nil)); err == nil {
+		t.Error("expected an error for a nil callback")
+	}
+}
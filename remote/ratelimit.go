@@ -0,0 +1,71 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimitBurst is the maximum number of bytes read at once from a throttled body.
+const rateLimitBurst = 32 << 10
+
+// rateLimiter limits the throughput of response bodies.
+// It is shared by all layers of a Remote so that the aggregated throughput stays under the limit.
+type rateLimiter struct {
+	bytesPerSec int64
+
+	mu   sync.Mutex
+	next time.Time // the time when the next bytes may be read
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{bytesPerSec: bytesPerSec}
+}
+
+// wait blocks until n bytes may be consumed.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bytesPerSec))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	rc      io.ReadCloser
+	limiter *rateLimiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > rateLimitBurst {
+		p = p[:rateLimitBurst]
+	}
+	n, err := r.rc.Read(p)
+	if n > 0 {
+		if werr := r.limiter.wait(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,32 @@
+package remote_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestRateLimit(t *testing.T) {
+	// Random content is incompressible, so the blob is as large as the file
+	content := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(content)
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "random", Content: string(content)}))
+
+	const (
+		bytesPerSec = 256 << 10
+		n           = 128 << 10
+	)
+	l := layersOf(t, remotetest.Open(t, tr, remote.WithRateLimit(bytesPerSec)))[0]
+	start := time.Now()
+	if _, err := l.ReadAt(make([]byte, n), 0); err != nil {
+		t.Fatal(err)
+	}
+	// The first burst is read without waiting
+	if elapsed, min := time.Since(start), time.Duration(n-32<<10)*time.Second/bytesPerSec; elapsed < min {
+		t.Errorf("read %d bytes in %s, want at least %s at %d bytes/s", n, elapsed, min, bytesPerSec)
+	}
+}
@@ -0,0 +1,80 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+)
+
+// ReadFile reads the file at the path in the merged view of the image in one call.
+// It returns ErrNotFound if the path doesn't exist in the image.
+func ReadFile(ctx context.Context, image, p string, opts ...Option) ([]byte, error) {
+	r, err := New(image, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return r.ReadFile(ctx, p)
+}
+
+// ReadFile returns the content of the file at the path in the merged view of the image.
+// Files registered with WithLabeledFile are served from the manifest annotations or the config labels when present.
+// With WithFileCache, a file read before is served from the cache without accessing the registry.
+func (r Remote) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	if b, ok, err := r.readLabeledFile(cleanPath(p)); err != nil {
+		return nil, err
+	} else if ok {
+		return b, nil
+	}
+
+	var key fileCacheKey
+	if r.opts.fileCache != nil {
+		dgst, err := r.image.Digest()
+		if err != nil {
+			return nil, err
+		}
+		key = fileCacheKey{image: dgst, path: cleanPath(p)}
+		if b, ok := r.opts.fileCache.get(key); ok {
+			return b, nil
+		}
+	}
+
+	l, e, err := r.Find(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err = l.CopyFile(&buf, e.Name); err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()
+	if r.opts.fileCache != nil {
+		// Cache a copy since the caller owns b and may modify it
+		r.opts.fileCache.add(key, append([]byte(nil), b...))
+	}
+	return b, nil
+}
+
+// readLabeledFile returns the content of the file recorded in a manifest annotation or a config label.
+func (r Remote) readLabeledFile(p string) ([]byte, bool, error) {
+	key, ok := r.opts.labeledFiles[p]
+	if !ok {
+		return nil, false, nil
+	}
+
+	manifest, err := r.image.Manifest()
+	if err != nil {
+		return nil, false, err
+	}
+	if v, ok := manifest.Annotations[key]; ok {
+		return []byte(v), true, nil
+	}
+
+	config, err := r.image.ConfigFile()
+	if err != nil {
+		return nil, false, err
+	}
+	if v, ok := config.Config.Labels[key]; ok {
+		return []byte(v), true, nil
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,101 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestReadFile(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr,
+		remotetest.Layer(t, 0, remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/a", Content: "lower"}, remotetest.File{Name: "etc/b", Content: "b"}),
+		remotetest.Layer(t, 0, remotetest.File{Name: "etc/"}, remotetest.File{Name: "etc/a", Content: "upper"}, remotetest.File{Name: "etc/.wh.b"}),
+	)
+
+	b, err := remote.ReadFile(context.Background(), remotetest.Reference, "/etc/a", remote.WithTransport(tr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "upper" {
+		t.Errorf("got %q, want %q", b, "upper")
+	}
+
+	_, err = remote.ReadFile(context.Background(), remotetest.Reference, "etc/b", remote.WithTransport(tr))
+	if !errors.Is(err, remote.ErrNotFound) {
+		t.Errorf("expected %v for a whited-out file, got %v", remote.ErrNotFound, err)
+	}
+}
+
+func TestReadFileCached(t *testing.T) {
+	tr := &countingTransport{inner: remotetest.NewTransport()}
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "content"}))
+	r := remotetest.Open(t, tr, remote.WithFileCache(remote.NewFileCache(1<<20)))
+
+	for i := 0; i < 3; i++ {
+		b, err := r.ReadFile(context.Background(), "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "content" {
+			t.Fatalf("read %d: got %q, want %q", i, b, "content")
+		}
+		// Modifying the returned bytes must not affect the next read
+		copy(b, "CHANGED")
+	}
+
+	reads := tr.count()
+	if _, err := r.ReadFile(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := tr.count() - reads; n != 0 {
+		t.Errorf("expected the file to be served from the cache, got %d requests", n)
+	}
+}
+
+func TestReadLabeledFile(t *testing.T) {
+	img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0,
+		remotetest.File{Name: "etc/"},
+		remotetest.File{Name: "etc/os-release", Content: "from the layer"},
+		remotetest.File{Name: "etc/hostname", Content: "from the layer"},
+	)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img, err = mutate.Config(img, v1.Config{Labels: map[string]string{"os-release": "from the label"}}); err != nil {
+		t.Fatal(err)
+	}
+	tr := &countingTransport{inner: remotetest.NewTransport()}
+	if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+
+	r := remotetest.Open(t, tr,
+		remote.WithLabeledFile("/etc/os-release", "os-release"),
+		remote.WithLabeledFile("etc/hostname", "hostname"),
+	)
+	b, err := r.ReadFile(context.Background(), "etc/os-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "from the label" {
+		t.Errorf("got %q, want %q", b, "from the label")
+	}
+	if n := tr.count(); n != 0 {
+		t.Errorf("expected no range request, got %d", n)
+	}
+
+	// Files without the label are read from the layers
+	if b, err = r.ReadFile(context.Background(), "etc/hostname"); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "from the layer" {
+		t.Errorf("got %q, want %q", b, "from the layer")
+	}
+}
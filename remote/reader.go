@@ -0,0 +1,20 @@
+package remote
+
+import (
+	"io"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// LayerReader is the part of Layer reading files.
+// Code taking a LayerReader instead of *Layer can be tested with fake layers.
+type LayerReader interface {
+	Digest() v1.Hash
+	Size() int64
+	Open() (*estargz.Reader, error)
+	CopyFile(w io.Writer, name string) (int64, error)
+	ReadFileRange(name string, offset, length int64) ([]byte, error)
+}
+
+var _ LayerReader = (*Layer)(nil)
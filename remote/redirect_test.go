@@ -0,0 +1,150 @@
+package remote_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// basicKeychain resolves the basic credentials for every registry.
+type basicKeychain struct {
+	user, pass string
+}
+
+func (k basicKeychain) Resolve(authn.Resource) (authn.Authenticator, error) {
+	return &authn.Basic{Username: k.user, Password: k.pass}, nil
+}
+
+func TestRedirectAuth(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		leaked  []string // the requests to the CDN with Authorization
+		cdnHits int
+		reg     http.Handler
+	)
+	// The CDN serves the blobs of the registry at the same paths
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		cdnHits++
+		if r.Header.Get("Authorization") != "" {
+			leaked = append(leaked, r.Method+" "+r.URL.Path)
+		}
+		mu.Unlock()
+
+		reg.ServeHTTP(w, r)
+	}))
+	t.Cleanup(cdn.Close)
+
+	// Blob requests hop within the registry, which requires the credentials, before being redirected to the CDN
+	srv := serveImage(t, func(h http.Handler) http.Handler {
+		reg = h
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !strings.Contains(r.URL.Path, "/blobs/") || r.Header.Get("Range") == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if p := strings.TrimPrefix(r.URL.Path, "/hop"); p != r.URL.Path {
+				http.Redirect(w, r, cdn.URL+p, http.StatusTemporaryRedirect)
+				return
+			}
+			http.Redirect(w, r, "/hop"+r.URL.Path, http.StatusTemporaryRedirect)
+		})
+	}, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "from the CDN"}))
+	ref := srv.Listener.Addr().String() + "/test/image:latest"
+	kc := remote.WithKeychain(basicKeychain{user: "user", pass: "pass"})
+
+	r, err := remote.New(ref, kc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "from the CDN" {
+		t.Errorf("got %q, want %q", b, "from the CDN")
+	}
+	mu.Lock()
+	if cdnHits == 0 {
+		t.Error("the blob wasn't read from the CDN")
+	}
+	if len(leaked) > 0 {
+		t.Errorf("the credentials leaked to the CDN: %v", leaked)
+	}
+	mu.Unlock()
+
+	// The two hops exceed the limit
+	if r, err = remote.New(ref, kc, remote.WithMaxRedirects(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Layers(context.Background()); err == nil {
+		t.Error("expected too many redirects")
+	}
+}
+
+func TestRedirectRewriter(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "from the near endpoint"}))
+
+	var mu sync.Mutex
+	hits := map[string]int{}
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		hits[req.URL.Host]++
+		mu.Unlock()
+		switch {
+		case req.URL.Host == "s3.far.test":
+			return statusResponse(req, http.StatusInternalServerError), nil
+		case req.URL.Host != "s3.near.test" && isBlobRange(req):
+			// The config is fetched by go-containerregistry, which follows redirects itself
+			return redirectResponse(req, "https://s3.far.test/bucket"+req.URL.Path+"?X-Amz-Signature=sig"), nil
+		}
+		req = req.Clone(req.Context())
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, "/bucket")
+		return inner.RoundTrip(req)
+	})
+
+	r := remotetest.Open(t, tr, remote.WithRedirectRewriter(func(u *url.URL) *url.URL {
+		if u.Host == "s3.far.test" {
+			u.Host = "s3.near.test"
+		}
+		return u
+	}))
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "from the near endpoint" {
+		t.Errorf("unexpected content %q", b)
+	}
+	mu.Lock()
+	if hits["s3.far.test"] != 0 || hits["s3.near.test"] == 0 {
+		t.Errorf("expected requests to the near endpoint only, got %v", hits)
+	}
+	mu.Unlock()
+
+	for name, rewrite := range map[string]func(*url.URL) *url.URL{
+		"nil":      func(*url.URL) *url.URL { return nil },
+		"relative": func(*url.URL) *url.URL { return &url.URL{Path: "/bucket"} },
+		"scheme":   func(u *url.URL) *url.URL { u.Scheme = "ftp"; return u },
+	} {
+		_, err := remotetest.Open(t, tr, remote.WithRedirectRewriter(rewrite), remote.WithRetry(1, 0)).ReadFile(context.Background(), "a")
+		if err == nil || !strings.Contains(err.Error(), "was rewritten to") {
+			t.Errorf("%s: expected an invalid rewrite error, got %v", name, err)
+		}
+	}
+}
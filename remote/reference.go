@@ -0,0 +1,52 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Reference returns the parsed reference of the image. The registry is lowercased.
+func (r Remote) Reference() name.Reference {
+	return r.ref
+}
+
+// RegistryStr returns the registry of the image, e.g. "index.docker.io".
+func (r Remote) RegistryStr() string {
+	return r.ref.Context().RegistryStr()
+}
+
+// RepositoryStr returns the repository of the image without the registry, e.g. "library/ubuntu".
+func (r Remote) RepositoryStr() string {
+	return r.ref.Context().RepositoryStr()
+}
+
+// parseReference parses the image reference after lowercasing the registry, whose host name is case-insensitive.
+// Repository names must be lowercase as defined by the distribution spec and go-containerregistry.
+// Registries such as Quay and Harbor accept uppercase ones, but the token scope computed from a lowercased name
+// doesn't match them, so such references are rejected with an error telling so.
+// The tag and the digest are kept as is.
+func parseReference(s string, opts ...name.Option) (name.Reference, error) {
+	repo, suffix := s, ""
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo, suffix = repo[:i], repo[i:]
+	}
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo, suffix = repo[:i], repo[i:]+suffix
+	}
+	var registry string
+	if i := strings.Index(repo, "/"); i >= 0 && isRegistry(repo[:i]) {
+		registry, repo = strings.ToLower(repo[:i+1]), repo[i+1:]
+	}
+	if repo != strings.ToLower(repo) {
+		return nil, fmt.Errorf("invalid reference %q: repository %q must be lowercase", s, repo)
+	}
+	return name.ParseReference(registry+repo+suffix, opts...)
+}
+
+// isRegistry reports whether the first component of a reference is a registry rather than a part of
+// a Docker Hub repository, following the rule of the docker CLI.
+func isRegistry(s string) bool {
+	return strings.ContainsAny(s, ".:") || strings.EqualFold(s, "localhost")
+}
@@ -0,0 +1,244 @@
+package remote_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestReferenceCase(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"}))
+
+	// Host names are case-insensitive
+	r, err := remote.New("Registry.TEST/remotetest/image:latest", remote.WithTransport(tr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.RegistryStr(); got != "registry.test" {
+		t.Errorf("unexpected registry %q", got)
+	}
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "a" {
+		t.Errorf("unexpected content %q", b)
+	}
+
+	for _, ref := range []string{
+		"registry.test/RemoteTest/image:latest",
+		"Library/ubuntu",
+		"localhost:5000/team/Image@sha256:" + strings.Repeat("0", 64),
+	} {
+		_, err := remote.New(ref, remote.WithTransport(tr))
+		if err == nil || !strings.Contains(err.Error(), "must be lowercase") {
+			t.Errorf("%s: expected a lowercase error, got %v", ref, err)
+		}
+	}
+}
+
+// harbor serves a registry behind a Harbor-style token service:
+// the realm is a path of the registry host with a query, and the scope is repeated in the challenge of resources.
+type harbor struct {
+	*httptest.Server
+	reg http.Handler
+
+	mu     sync.Mutex
+	scopes []string // requested to the token service
+}
+
+func newHarbor(t *testing.T) *harbor {
+	h := &harbor{reg: remotetest.NewHandler()}
+	h.Server = httptest.NewServer(h)
+	t.Cleanup(h.Close)
+	return h
+}
+
+func (h *harbor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/service/token" {
+		q := r.URL.Query()
+		if q.Get("service") != "harbor-registry" || q.Get("account") != "robot" {
+			http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		h.mu.Lock()
+		h.scopes = append(h.scopes, q["scope"]...)
+		h.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"token": "token", "access_token": "token"})
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		challenge := fmt.Sprintf(`Bearer realm="%s/service/token?account=robot",service="harbor-registry"`, h.URL)
+		if repo := strings.TrimPrefix(r.URL.Path, "/v2/"); repo != "" && repo != r.URL.Path {
+			if i := strings.LastIndex(repo, "/manifests/"); i >= 0 {
+				repo = repo[:i]
+			} else if i := strings.LastIndex(repo, "/blobs/"); i >= 0 {
+				repo = repo[:i]
+			}
+			challenge += fmt.Sprintf(`,scope="repository:%s:pull"`, repo)
+		}
+		w.Header().Set("WWW-Authenticate", challenge)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.reg.ServeHTTP(w, r)
+}
+
+func (h *harbor) requestedScopes() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.scopes...)
+}
+
+func TestHarborMultiSegmentRepository(t *testing.T) {
+	h := newHarbor(t)
+	ref := strings.TrimPrefix(h.URL, "http://") + "/project/team/service:v1"
+
+	img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "etc/hostname", Content: "harbor"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = remotetest.Push(http.DefaultTransport, ref, img); err != nil {
+		t.Fatal(err)
+	}
+	h.mu.Lock()
+	h.scopes = nil
+	h.mu.Unlock()
+
+	r, err := remote.New(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.ReadFile(context.Background(), "etc/hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "harbor" {
+		t.Errorf("unexpected content %q", b)
+	}
+	for _, scope := range h.requestedScopes() {
+		if scope != "repository:project/team/service:pull" {
+			t.Errorf("unexpected scope %q", scope)
+		}
+	}
+	if len(h.requestedScopes()) == 0 {
+		t.Error("no token is requested")
+	}
+}
+
+func TestUnreachableRealm(t *testing.T) {
+	realm := httptest.NewServer(http.NotFoundHandler())
+	realm.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, realm.URL))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, err := remote.New(strings.TrimPrefix(srv.URL, "http://")+"/project/team/service:v1", remote.WithRetry(1, 0))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "failed to authenticate to") || !strings.Contains(err.Error(), "repository:project/team/service:pull") {
+		t.Errorf("unclear error: %v", err)
+	}
+}
+
+func TestReferenceAccessors(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"}))
+
+	r := remotetest.Open(t, tr)
+	ref, err := name.ParseReference(remotetest.Reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Reference().String(); got != ref.String() {
+		t.Errorf("unexpected reference %q, want %q", got, ref.String())
+	}
+	if got := r.RegistryStr(); got != ref.Context().RegistryStr() {
+		t.Errorf("unexpected registry %q, want %q", got, ref.Context().RegistryStr())
+	}
+	if got := r.RepositoryStr(); got != ref.Context().RepositoryStr() {
+		t.Errorf("unexpected repository %q, want %q", got, ref.Context().RepositoryStr())
+	}
+	if got := r.RepositoryStr(); got != "remotetest/image" {
+		t.Errorf("unexpected repository %q", got)
+	}
+}
+
+func TestMultiSegmentRepository(t *testing.T) {
+	blob := remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "deep"})
+	img, err := remotetest.NewImage([][]byte{blob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, repo := range []string{
+		"team/project/service",
+		"a/b/c/d/e/f",
+		"team/project/blobs", // ends with a component of the API path
+	} {
+		t.Run(repo, func(t *testing.T) {
+			ref := "registry.test/" + repo + ":latest"
+			var mu sync.Mutex
+			var paths []string
+			inner := remotetest.NewTransport()
+			tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if req.Header.Get("Range") != "" {
+					mu.Lock()
+					paths = append(paths, req.URL.Path)
+					mu.Unlock()
+				}
+				return inner.RoundTrip(req)
+			})
+			if err := remotetest.Push(inner, ref, img); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := remote.New(ref, remote.WithTransport(tr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.RepositoryStr(); got != repo {
+				t.Errorf("unexpected repository %q", got)
+			}
+			b, err := r.ReadFile(context.Background(), "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "deep" {
+				t.Errorf("unexpected content %q", b)
+			}
+			want := "/v2/" + repo + "/blobs/" + dgst.String()
+			if len(paths) == 0 {
+				t.Fatal("no range request is sent")
+			}
+			for _, p := range paths {
+				if p != want {
+					t.Errorf("unexpected blob path %q, want %q", p, want)
+				}
+			}
+		})
+	}
+}
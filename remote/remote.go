@@ -8,93 +8,327 @@ import (
 	"mime"
 	"net/http"
 	"net/url"
-	"path"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 type Remote struct {
-	ref   name.Reference
-	rt    http.RoundTripper
-	image v1.Image
+	ref       name.Reference
+	rt        http.RoundTripper
+	base      http.RoundTripper // the transport without the registry credentials, for other hosts
+	image     v1.Image
+	opts      *options
+	cache     *chunkCache
+	flight    *readFlight
+	diskCache *diskCache
+	limiter   *rateLimiter
 }
 
-func New(s string) (Remote, error) {
-	ref, err := name.ParseReference(s)
+// New resolves the image and returns the Remote reading it.
+// Images opened by New share the credentials resolved from the default keychain unless the options set another one.
+// Use Resolver to share them with other options, e.g. another keychain.
+func New(s string, opts ...Option) (Remote, error) {
+	rem, err := defaultResolver.Open(context.Background(), s, opts...)
 	if err != nil {
 		return Remote{}, err
 	}
+	return *rem, nil
+}
 
-	// Fetch credentials based on your docker config file, which is $HOME/.docker/config.json or $DOCKER_CONFIG.
-	auth, err := authn.DefaultKeychain.Resolve(ref.Context())
+// open is New with the context used to resolve the image.
+func open(ctx context.Context, s string, opts ...Option) (Remote, error) {
+	o, err := makeOptions(opts...)
 	if err != nil {
 		return Remote{}, err
 	}
 
-	// Construct an http.Client that is authorized to pull from gcr.io/google-containers/pause.
-	scopes := []string{ref.Scope(transport.PullScope)}
-	t, err := transport.New(ref.Context().Registry, auth, http.DefaultTransport, scopes)
-	if err != nil {
-		return Remote{}, err
+	var nameOpts []name.Option
+	if o.scheme == "http" {
+		nameOpts = append(nameOpts, name.Insecure)
 	}
 
-	img, err := remote.Image(ref, remote.WithTransport(t))
+	ref, err := parseReference(s, nameOpts...)
 	if err != nil {
 		return Remote{}, err
 	}
 
+	var dc *diskCache
+	if o.diskCacheDir != "" {
+		if dc, err = newDiskCache(o.diskCacheDir, o.diskCacheMaxBytes); err != nil {
+			return Remote{}, err
+		}
+	}
+
+	var (
+		t      http.RoundTripper
+		img    v1.Image
+		cached bool
+	)
+	if o.manifestCache != nil && !o.offline {
+		img, cached = o.manifestCache.get(ref, o.platform)
+	}
+
+	switch {
+	case cached:
+		// Reuse the image resolved by another Remote, authenticating with our own options
+		if t, err = authenticate(ctx, ref, o); err != nil {
+			return Remote{}, err
+		}
+	case o.offline:
+		if dc == nil {
+			return Remote{}, fmt.Errorf("offline mode requires a disk cache")
+		}
+		t = offlineTransport{}
+		if img, err = dc.loadImage(ref, o.platform); err != nil {
+			return Remote{}, err
+		}
+	default:
+		if t, img, err = connect(ctx, ref, o); err != nil {
+			return Remote{}, err
+		}
+		if dc != nil {
+			dc.saveImage(ref, o.platform, img)
+		}
+		if o.manifestCache != nil {
+			o.manifestCache.add(ref, o.platform, img)
+		}
+	}
+
+	var limiter *rateLimiter
+	if o.rateLimit > 0 {
+		limiter = newRateLimiter(o.rateLimit)
+	}
+
+	var base http.RoundTripper = offlineTransport{}
+	if !o.offline {
+		base = o.baseTransport()
+	}
+
 	return Remote{
-		ref:   ref,
-		rt:    t,
-		image: img,
+		ref:       ref,
+		rt:        t,
+		base:      base,
+		image:     img,
+		opts:      o,
+		cache:     newChunkCache(o.chunkCacheMaxBytes),
+		flight:    newReadFlight(),
+		diskCache: dc,
+		limiter:   limiter,
 	}, nil
 }
 
-func (r Remote) Layers(ctx context.Context) ([]*Layer, error) {
-	layers, err := r.image.Layers()
+// connect authenticates to the registry and fetches the image manifest and config.
+// Transient failures are retried with the retry policy as well as range requests.
+func connect(ctx context.Context, ref name.Reference, o *options) (http.RoundTripper, v1.Image, error) {
+	t, err := authenticate(ctx, ref, o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var img v1.Image
+	err = o.retry.do(ctx, func() error {
+		remoteOpts := []remote.Option{remote.WithTransport(t), remote.WithContext(ctx)}
+		if o.platform != nil {
+			remoteOpts = append(remoteOpts, remote.WithPlatform(*o.platform))
+		}
+		if img, err = fetchImage(ref, remoteOpts...); err != nil {
+			return retryableRegistryError(ctx, err)
+		}
+		// The config is fetched now so that it doesn't fail transiently later
+		if _, err = img.RawConfigFile(); err != nil {
+			return retryableRegistryError(ctx, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, img, nil
+}
+
+// authenticate returns a transport authorized to the registry for pulling the repository of the reference.
+func authenticate(ctx context.Context, ref name.Reference, o *options) (http.RoundTripper, error) {
+	// Fetch credentials based on your docker config file, which is $HOME/.docker/config.json or $DOCKER_CONFIG,
+	// unless another keychain is given.
+	auth, err := o.keychain.Resolve(ref.Context())
 	if err != nil {
 		return nil, err
 	}
 
-	repoURL := url.URL{
-		Scheme: r.ref.Context().Scheme(),
-		Host:   r.ref.Context().RegistryStr(),
-		Path:   fmt.Sprintf("/v2/%s/", r.ref.Context().RepositoryStr()),
+	base := o.baseTransport()
+	if o.scheme == "https" && ref.Context().Scheme() == "http" {
+		base = &httpsTransport{inner: base, host: ref.Context().RegistryStr()}
+	}
+	if o.pathPrefix != "" {
+		base = &prefixTransport{inner: base, host: ref.Context().RegistryStr(), prefix: o.pathPrefix}
+	}
+	if o.oauth2 != nil {
+		// The registry is authorized by the OAuth2 token instead of the docker token flow
+		auth = authn.Anonymous
+		base = newOAuth2Transport(base, o.oauth2, ref.Context().RegistryStr())
 	}
 
-	var eLayers []*Layer
-	for _, layer := range layers {
-		size, err := layer.Size()
+	var t http.RoundTripper
+	err = o.retry.do(ctx, func() error {
+		// Construct an http.Client that is authorized to pull from gcr.io/google-containers/pause.
+		scopes := []string{ref.Scope(transport.PullScope)}
+		ping := &pingTransport{inner: base}
+		t, err = transport.New(ref.Context().Registry, auth, ping, scopes)
 		if err != nil {
-			return nil, err
+			return retryableRegistryError(ctx, fmt.Errorf("failed to authenticate to %s for %s: %w", ref.Context().RegistryStr(), scopes[0], ping.wrap(err)))
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
 
-		digest, err := layer.Digest()
-		if err != nil {
-			return nil, err
+// Digest returns the digest of the resolved image manifest.
+// It pins the image even if it was referenced by tag.
+func (r Remote) Digest() (v1.Hash, error) {
+	return r.image.Digest()
+}
+
+// Profile returns the profile set by WithProfile, or nil.
+func (r Remote) Profile() *Profile {
+	return r.opts.profile
+}
+
+// blobURL returns the URL of the blob in the repository of the image.
+// The repository may have any number of path components, e.g. "team/project/service",
+// which are kept as is instead of being cleaned as a file path.
+func (r Remote) blobURL(dgst v1.Hash) string {
+	u := url.URL{
+		Scheme: r.scheme(),
+		Host:   r.ref.Context().RegistryStr(),
+		Path:   r.opts.pathPrefix + "/v2/" + r.ref.Context().RepositoryStr() + "/blobs/" + dgst.String(),
+	}
+	return u.String()
+}
+
+// scheme returns the scheme used to access the registry.
+func (r Remote) scheme() string {
+	if r.opts.scheme != "" {
+		return r.opts.scheme
+	}
+	return r.ref.Context().Scheme()
+}
+
+// Layers returns the layers of the image which can be read lazily, from the bottom.
+// Layers of other media types, such as uncompressed tars and attestations, are skipped.
+func (r Remote) Layers(ctx context.Context) ([]*Layer, error) {
+	return r.layers(ctx, false)
+}
+
+// LayersLazy is Layers resolving the redirect of each layer on its first request instead of up front.
+// Layers never read cost no requests, which helps tools reading only a few files.
+func (r Remote) LayersLazy(ctx context.Context) ([]*Layer, error) {
+	return r.layers(ctx, true)
+}
+
+func (r Remote) layers(ctx context.Context, lazy bool) ([]*Layer, error) {
+	manifest, err := r.image.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	if r.opts.maxLayers > 0 && len(manifest.Layers) > r.opts.maxLayers {
+		return nil, &TooManyLayersError{Layers: len(manifest.Layers), Max: r.opts.maxLayers}
+	}
+
+	// Reading locally stored layers shouldn't cost the redirect requests.
+	if r.opts.blobStore != nil {
+		lazy = true
+	}
+
+	// Each call has its own budget, so that every operation reading through the layers is bounded on its own.
+	rt, base := r.rt, r.base
+	var budget *requestBudget
+	if r.opts.maxRequests > 0 {
+		budget = &requestBudget{max: int64(r.opts.maxRequests)}
+		rt = &budgetTransport{inner: rt, budget: budget}
+		base = &budgetTransport{inner: base, budget: budget}
+	}
+
+	var eLayers []*Layer
+	for i, desc := range manifest.Layers {
+		// Layers which can't be read lazily, e.g. attestations, are not worth the redirect request.
+		format := formatOf(desc.MediaType)
+		if r.opts.forceFormat != FormatUnknown && desc.MediaType != types.DockerForeignLayer {
+			format = r.opts.forceFormat
+		}
+		if format == FormatUnknown {
+			continue
+		}
+		if r.opts.layerFilter != nil && !r.opts.layerFilter(i, desc) {
+			continue
 		}
 
 		// Get blob URL
-		blobURL := repoURL
-		blobURL.Path = path.Join(blobURL.Path, "blobs", digest.String())
+		blobURL := r.blobURL(desc.Digest)
 
-		redirectedURL, err := redirect(ctx, blobURL.String(), r.rt, 30*time.Second)
-		if err != nil {
+		// The redirect can't be resolved offline, while cached ranges are keyed by the digest anyway.
+		redirectedURL, validator := blobURL, ""
+		if !r.opts.offline && !lazy {
+			redirectedURL, validator, err = redirect(ctx, blobURL, rt, base, r.opts.maxRedirects, r.opts.rewriteRedirect, r.opts.modifyRequest, 30*time.Second, r.opts.retry)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var extTOC *externalTOC
+		if tocDigest, ok, err := parseExternalTOC(desc.Annotations, r.opts.externalTOCAnnotation); err != nil {
 			return nil, err
+		} else if ok {
+			extTOC = &externalTOC{digest: tocDigest, url: r.blobURL(tocDigest)}
 		}
 
 		eLayers = append(eLayers, &Layer{
-			digest:  digest,
-			url:     redirectedURL,
-			blobURL: blobURL.String(),
-			size:    size,
-			rt:      r.rt,
+			ctx:             ctx,
+			index:           i,
+			digest:          desc.Digest,
+			mediaType:       desc.MediaType,
+			format:          format,
+			annotations:     desc.Annotations,
+			url:             redirectedURL,
+			validator:       validator,
+			blobURL:         blobURL,
+			externalTOC:     extTOC,
+			size:            desc.Size,
+			rt:              rt,
+			base:            base,
+			cache:           r.cache,
+			flight:          r.flight,
+			diskCache:       r.diskCache,
+			limiter:         r.limiter,
+			budget:          budget,
+			retry:           r.opts.retry,
+			layerCache:      r.opts.layerCache,
+			readTimeout:     r.opts.readTimeout,
+			offline:         r.opts.offline,
+			maxRedirects:    r.opts.maxRedirects,
+			rewriteRedirect: r.opts.rewriteRedirect,
+			modifyRequest:   r.opts.modifyRequest,
+			progress:        r.opts.progress,
+			maxFullBlobSize: r.opts.maxFullBlobSize,
+			lazy:            lazy && !r.opts.offline,
+			blobStore:       r.opts.blobStore,
+
+			gzipIndexDir: r.opts.gzipIndexDir,
+			strict:       r.opts.strict,
+			tocSpill:     r.opts.tocSpill,
 		})
 	}
 
@@ -102,11 +336,73 @@ func (r Remote) Layers(ctx context.Context) ([]*Layer, error) {
 }
 
 type Layer struct {
-	digest  v1.Hash
-	url     string
-	blobURL string
-	size    int64
-	rt      http.RoundTripper
+	// ctx is the context passed to Remote.Layers.
+	// It is used for range requests issued by ReadAt since io.ReaderAt doesn't take a context.
+	ctx context.Context
+
+	index       int
+	digest      v1.Hash
+	mediaType   types.MediaType
+	format      Format
+	annotations map[string]string
+	urlMu       sync.Mutex // guards url and validator, which change when the redirect is resolved again
+	lazy        bool       // the redirect is resolved on the first request
+	resolveOnce sync.Once
+	resolveErr  error
+	url         string
+	blobURL     string
+	externalTOC *externalTOC // nil when the TOC is embedded in the layer
+	validator   string       // ETag or Last-Modified of the blob, if known
+	size        int64
+	rt          http.RoundTripper
+	base        http.RoundTripper
+	cache       *chunkCache
+	flight      *readFlight // shared by the layers of the Remote
+	diskCache   *diskCache
+	limiter     *rateLimiter
+	budget      *requestBudget // shared by the layers of a Layers call, nil without WithMaxRequests
+	retry       retryPolicy
+	layerCache  *LayerCache
+	readTimeout time.Duration
+	offline     bool
+
+	maxRedirects    int
+	rewriteRedirect func(*url.URL) *url.URL
+	modifyRequest   func(*http.Request) error
+
+	progress func(done, total int64)
+
+	maxFullBlobSize int64
+
+	gzipIndexDir string
+	gzipIndex    *os.File // the index the layer is read through, if any
+
+	tocSpill int64
+	spill    *os.File // the TOC spilled by WithTOCSpill, if any
+
+	blobStore BlobStore
+	localOnce sync.Once
+	local     BlobReaderAt // nil unless the blob is in the blob store
+	localErr  error
+
+	strict     bool
+	verifyOnce sync.Once
+	verifier   estargz.TOCEntryVerifier
+	verifyErr  error
+
+	tail atomic.Value // []byte at the end of the blob read by estargz.Open, which holds the footer
+
+	once   sync.Once
+	opened int32 // set once Open is called, accessed atomically
+	reader *estargz.Reader
+	err    error
+}
+
+// Index returns the position of the layer in the manifest, from the bottom.
+// It may differ from the position in the slice returned by Layers,
+// which skips layers whose media types can't be read lazily.
+func (l *Layer) Index() int {
+	return l.index
 }
 
 func (l *Layer) Digest() v1.Hash {
@@ -117,88 +413,498 @@ func (l *Layer) Size() int64 {
 	return l.size
 }
 
+func (l *Layer) MediaType() types.MediaType {
+	return l.mediaType
+}
+
+// Annotations returns the annotations of the layer descriptor in the manifest.
+func (l *Layer) Annotations() map[string]string {
+	return l.annotations
+}
+
+// Format returns the compression format detected from the media type, or the one forced by WithForceFormat.
+func (l *Layer) Format() Format {
+	return l.format
+}
+
+// Open parses the footer and the TOC of the layer.
+// The parsed reader is cached so the TOC is fetched only once per layer.
+func (l *Layer) Open() (*estargz.Reader, error) {
+	atomic.StoreInt32(&l.opened, 1)
+	l.once.Do(func() {
+		if l.Format() == FormatUnknown {
+			l.err = fmt.Errorf("layer %s has unsupported media type %q", l.digest, l.mediaType)
+			return
+		}
+		if l.layerCache != nil {
+			l.reader, l.err = l.layerCache.open(l)
+			return
+		}
+		l.reader, l.err = l.openEStargz(l)
+		l.err = l.budget.wrap(l.err)
+	})
+	return l.reader, l.err
+}
+
+// openEStargz parses the TOC of the layer whose blob is read through ra.
+func (l *Layer) openEStargz(ra io.ReaderAt) (*estargz.Reader, error) {
+	if l.externalTOC != nil {
+		return l.openWithExternalTOC(ra)
+	}
+	rec := &tailRecorder{ra: ra, size: l.size, suffix: l.layerCache != nil}
+	ra = rec
+	sr := io.NewSectionReader(ra, 0, l.size)
+	if l.gzipIndexDir != "" && l.Format() == FormatGzip {
+		if _, _, err := estargz.OpenFooter(sr); err != nil {
+			// Not an estargz layer
+			return l.openGzipIndex()
+		}
+	}
+	if l.tocSpill > 0 {
+		spilled, err := l.spillTOC(ra)
+		if err != nil {
+			return nil, err
+		}
+		sr = io.NewSectionReader(spilled, 0, l.size)
+	}
+	r, err := estargz.Open(sr, estargz.WithDecompressors(l.decompressors()...))
+	if err != nil {
+		return nil, err
+	}
+	l.tail.Store(rec.bytes())
+	return r, nil
+}
+
+// OpenEntry returns the reader of the file content described by the given TOC entry.
+// It is useful when the entry is already known, e.g. from a previous lookup.
+func (l *Layer) OpenEntry(e *estargz.TOCEntry) (*io.SectionReader, error) {
+	if e == nil {
+		return nil, fmt.Errorf("nil TOC entry")
+	}
+	if e.Type != "reg" {
+		return nil, fmt.Errorf("%s is not a regular file", e.Name)
+	}
+	if l.strict {
+		// Arbitrary reads can't be verified chunk by chunk
+		return nil, fmt.Errorf("%s: OpenEntry is not available with strict verification", e.Name)
+	}
+
+	r, err := l.Open()
+	if err != nil {
+		return nil, err
+	}
+	return r.OpenFile(e.Name)
+}
+
 // ReadAt reads remote chunks from specified offset for the buffer size.
+// Reading zero bytes doesn't issue any request.
 func (l *Layer) ReadAt(p []byte, offset int64) (int, error) {
-	if len(p) == 0 || offset > l.size {
+	if len(p) == 0 {
 		return 0, nil
 	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	if offset >= l.size {
+		return 0, io.EOF
+	}
 
-	// Read required data
-	rc, err := l.fetch(context.Background(), offset, offset+int64(len(p))-1)
+	// Don't request bytes beyond the end of the blob
+	if remain := l.size - offset; int64(len(p)) > remain {
+		n, err := l.ReadAt(p[:remain], offset)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+
+	if l.cache.get(l.digest, p, offset) {
+		return len(p), nil
+	}
+	if l.diskCache != nil && l.diskCache.get(l.digest, p, offset) {
+		return len(p), nil
+	}
+
+	local, err := l.localBlob()
 	if err != nil {
 		return 0, err
 	}
-	defer rc.Close()
+	if local != nil {
+		return local.ReadAt(p, offset)
+	}
+
+	if l.offline {
+		return 0, fmt.Errorf("range %d-%d of %s: %w", offset, offset+int64(len(p))-1, l.digest, ErrOffline)
+	}
+
+	// Read required data
+	if err := l.readShared(p, offset); err != nil {
+		return 0, err
+	}
+	if l.diskCache != nil {
+		l.diskCache.add(l.digest, offset, p)
+	}
+	return len(p), nil
+}
+
+// readRange fills p with the blob content starting at offset.
+// Unlike fetch, each attempt including reading the body is bounded by the read timeout.
+func (l *Layer) readRange(ctx context.Context, p []byte, offset int64) error {
+	end := offset + int64(len(p)) - 1
+	if offset < 0 || end < offset {
+		return fmt.Errorf("invalid range %d-%d", offset, end)
+	}
+	if b := l.fullBlob(); b != nil {
+		rc, err := sliceBlob(b, offset, end)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadFull(rc, p)
+		return err
+	}
+
+	return l.do(ctx, l.readTimeout, func(ctx context.Context) error {
+		rc, err := l.fetchOnce(ctx, offset, end)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		if _, err = io.ReadFull(rc, p); err != nil {
+			return retryable(ctx, err, 0)
+		}
+		return readEnd(rc)
+	})
+}
 
-	return io.ReadFull(rc, p)
+// readEnd reads past the bytes read from the body so that an error reported after the last byte,
+// such as the digest mismatch of a verified full blob, isn't dropped.
+func readEnd(r io.Reader) error {
+	var b [1]byte
+	if _, err := r.Read(b[:]); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
 }
 
+// fetch requests the bytes in [begin, end] of the blob.
 func (l *Layer) fetch(ctx context.Context, begin, end int64) (io.ReadCloser, error) {
+	if begin < 0 || end < begin {
+		return nil, fmt.Errorf("invalid range %d-%d", begin, end)
+	}
+	if b := l.fullBlob(); b != nil {
+		return sliceBlob(b, begin, end)
+	}
+	if local, err := l.localBlob(); err != nil {
+		return nil, err
+	} else if local != nil {
+		return ioutil.NopCloser(io.NewSectionReader(local, begin, end-begin+1)), nil
+	}
+
+	// The body is read after fetch returns, so the read timeout can't be applied here.
+	var rc io.ReadCloser
+	err := l.do(ctx, 0, func(ctx context.Context) (err error) {
+		rc, err = l.fetchOnce(ctx, begin, end)
+		return err
+	})
+	return rc, err
+}
+
+// do calls fn with retries. Each attempt is canceled after timeout unless timeout is zero.
+func (l *Layer) do(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if err := l.resolve(ctx); err != nil {
+		return err
+	}
+
+	attempt := func() error {
+		if timeout <= 0 {
+			return fn(ctx)
+		}
+		actx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		err := fn(actx)
+		if err != nil && actx.Err() != nil && ctx.Err() == nil {
+			// Only this attempt has timed out.
+			return retryable(ctx, err, 0)
+		}
+		return err
+	}
+	err := l.retry.do(ctx, attempt)
+
+	// The redirected host, typically a CDN edge, may be unreachable for a while.
+	// Resolve the redirect again since the registry may point to another edge.
+	if err != nil && dialError(err) && l.resolvedURL() != l.blobURL {
+		if rerr := l.reresolve(ctx); rerr != nil {
+			return err
+		}
+		err = l.retry.do(ctx, attempt)
+	}
+	return err
+}
+
+// resolvedURL returns the URL serving the blob.
+func (l *Layer) resolvedURL() string {
+	l.urlMu.Lock()
+	defer l.urlMu.Unlock()
+	return l.url
+}
+
+// rangeValidator returns the validator of the blob served at the resolved URL.
+func (l *Layer) rangeValidator() string {
+	l.urlMu.Lock()
+	defer l.urlMu.Unlock()
+	return l.validator
+}
+
+// resolve resolves the redirect of the blob URL once if the layer was returned by LayersLazy.
+func (l *Layer) resolve(ctx context.Context) error {
+	if !l.lazy {
+		return nil
+	}
+	l.resolveOnce.Do(func() {
+		l.resolveErr = l.reresolve(ctx)
+	})
+	return l.resolveErr
+}
+
+// reresolve resolves the redirect of the blob URL again.
+func (l *Layer) reresolve(ctx context.Context) error {
+	u, validator, err := redirect(ctx, l.blobURL, l.rt, l.base, l.maxRedirects, l.rewriteRedirect, l.modifyRequest, 30*time.Second, l.retry)
+	if err != nil {
+		return err
+	}
+
+	l.urlMu.Lock()
+	defer l.urlMu.Unlock()
+	l.url, l.validator = u, validator
+	return nil
+}
+
+func (l *Layer) fetchOnce(ctx context.Context, begin, end int64) (io.ReadCloser, error) {
 	// Request to the registry
-	req, err := http.NewRequestWithContext(ctx, "GET", l.url, nil)
+	validator := l.rangeValidator()
+	req, err := http.NewRequestWithContext(ctx, "GET", l.resolvedURL(), nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", begin, end))
 	req.Header.Add("Accept-Encoding", "identity")
+	if validator != "" {
+		// The blob is content-addressed, but CDN caches may serve a changed object.
+		// With If-Range, such an object results in 200 instead of a wrong partial content.
+		req.Header.Add("If-Range", validator)
+	}
 	req.Close = false
+	if err = modifyRequest(req, l.modifyRequest); err != nil {
+		return nil, err
+	}
 
-	client := &http.Client{Transport: l.rt}
+	client := &http.Client{Transport: l.transportFor(l.resolvedURL())}
 	res, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, retryable(ctx, err, 0)
+	}
+
+	if l.limiter != nil {
+		res.Body = &throttledReader{ctx: ctx, rc: res.Body, limiter: l.limiter}
+	}
+
+	if res.StatusCode/100 == 2 {
+		if err = l.checkContentDigest(res.Header); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
 	}
 
 	if res.StatusCode == http.StatusOK {
-		return res.Body, nil
+		if validator != "" {
+			res.Body.Close()
+			return nil, fmt.Errorf("blob %s has changed since %s", l.digest, validator)
+		}
+		if begin == 0 && end == l.size-1 {
+			// The whole blob is requested, so it can be verified if it's read to the end
+			return newVerifyingReader(newExactReader(res.Body, l.size), l.digest), nil
+		}
+		// The server ignored the range
+		defer res.Body.Close()
+		b, err := l.keepFullBlob(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		return sliceBlob(b, begin, end)
 	} else if res.StatusCode == http.StatusPartialContent {
 		mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
 		if err != nil {
+			res.Body.Close()
 			return nil, fmt.Errorf("invalid media type %q: %w", mediaType, err)
 		}
 		if strings.HasPrefix(mediaType, "multipart/") {
+			res.Body.Close()
 			return nil, fmt.Errorf("multipart not supported")
 		}
 
-		return res.Body, nil
+		return newExactReader(res.Body, end-begin+1), nil
 	}
+	res.Body.Close()
+
+	err = fmt.Errorf("unexpected status code: %v", res.Status)
+	if retryableStatus(res.StatusCode) {
+		return nil, retryable(ctx, err, retryAfter(res.Header))
+	}
+	return nil, err
+}
 
-	return nil, fmt.Errorf("unexpected status code: %v", res.Status)
+// redirect resolves the URL serving the blob, retrying on transient failures.
+func redirect(ctx context.Context, blobURL string, tr, base http.RoundTripper, maxRedirects int, rewrite func(*url.URL) *url.URL, modify func(*http.Request) error, timeout time.Duration, policy retryPolicy) (u, validator string, err error) {
+	err = policy.do(ctx, func() (err error) {
+		u, validator, err = redirectOnce(ctx, blobURL, tr, base, maxRedirects, rewrite, modify, timeout)
+		return err
+	})
+	return u, validator, err
 }
 
-func redirect(ctx context.Context, blobURL string, tr http.RoundTripper, timeout time.Duration) (url string, err error) {
+// maxDrainBytes is the maximum size of a response body read only to reuse the connection.
+const maxDrainBytes = 4 << 10
+
+// redirectOnce follows at most maxRedirects hops from the blob URL to the URL serving the blob.
+// Hops to other hosts than the registry, typically CDNs with pre-signed URLs, are requested through base
+// so that the registry credentials never leak to them. Each location is rewritten by rewrite unless it's nil,
+// and each request is modified by modify unless it's nil.
+func redirectOnce(ctx context.Context, blobURL string, tr, base http.RoundTripper, maxRedirects int, rewrite func(*url.URL) *url.URL, modify func(*http.Request) error, timeout time.Duration) (string, string, error) {
 	if timeout > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
+
+	u := blobURL
+	for hops := 0; ; hops++ {
+		hopTransport := tr
+		if !sameOrigin(blobURL, u) {
+			hopTransport = base
+		}
+		next, validator, err := redirectHop(ctx, u, hopTransport, rewrite, modify)
+		if err != nil {
+			return "", "", err
+		}
+		if next == "" {
+			return u, validator, nil
+		}
+		if hops >= maxRedirects {
+			return "", "", fmt.Errorf("stopped after %d redirects from %s", maxRedirects, blobURL)
+		}
+		u = next
+	}
+}
+
+// rewriteLocation applies the rewriter of WithRedirectRewriter to a copy of the redirect location.
+func rewriteLocation(loc *url.URL, rewrite func(*url.URL) *url.URL) (*url.URL, error) {
+	orig := loc.String()
+	cp := *loc
+	next := rewrite(&cp)
+	if next == nil {
+		return nil, fmt.Errorf("redirect location %s was rewritten to nil", orig)
+	}
+	if (next.Scheme != "http" && next.Scheme != "https") || next.Host == "" {
+		return nil, fmt.Errorf("redirect location %s was rewritten to invalid URL %q", orig, next)
+	}
+	return next, nil
+}
+
+// redirectHop requests the URL and returns the location it redirects to,
+// or an empty location and the validator of the blob if it serves the blob.
+func redirectHop(ctx context.Context, u string, tr http.RoundTripper, rewrite func(*url.URL) *url.URL, modify func(*http.Request) error) (location, validator string, err error) {
 	// We use GET request for redirect.
 	// gcr.io returns 200 on HEAD without Location header (2020).
 	// ghcr.io returns 200 on HEAD without Location header (2020).
-	req, err := http.NewRequestWithContext(ctx, "GET", blobURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request to the registry: %w", err)
+		return "", "", fmt.Errorf("failed to make request to the registry: %w", err)
 	}
 	req.Close = false
 	req.Header.Set("Range", "bytes=0-1")
+	if err = modifyRequest(req, modify); err != nil {
+		return "", "", err
+	}
 	res, err := tr.RoundTrip(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to request: %w", err)
+		return "", "", retryable(ctx, fmt.Errorf("failed to request: %w", err), 0)
 	}
 	defer func() {
-		io.Copy(ioutil.Discard, res.Body)
+		// Registries serving blobs directly may ignore the range and send the whole blob.
+		// Drain only a little for reusing the connection and give up the rest.
+		io.CopyN(ioutil.Discard, res.Body, maxDrainBytes)
 		res.Body.Close()
 	}()
 
 	if res.StatusCode/100 == 2 {
-		url = blobURL
-	} else if redir := res.Header.Get("Location"); redir != "" && res.StatusCode/100 == 3 {
-		// TODO: Support nested redirection
-		url = redir
-	} else {
-		return "", fmt.Errorf("failed to access to the registry with code %v", res.StatusCode)
+		// No more redirect. Range requests to the blob URL of the registry carry the authorization on every request,
+		// and the authorized transport refreshes the token when the registry asks for it with 401.
+		if res.StatusCode != http.StatusPartialContent {
+			// The server ignores ranges, so a 200 to a conditional range request wouldn't mean the blob has changed
+			return "", "", nil
+		}
+		return "", rangeValidator(res.Header), nil
+	} else if loc := res.Header.Get("Location"); loc != "" && res.StatusCode/100 == 3 {
+		// The location may be relative to the URL
+		next, err := req.URL.Parse(loc)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid redirect location %q: %w", loc, err)
+		}
+		if rewrite != nil {
+			if next, err = rewriteLocation(next, rewrite); err != nil {
+				return "", "", err
+			}
+		}
+		return next.String(), "", nil
 	}
 
-	return
+	err = fmt.Errorf("failed to access to the registry with code %v", res.StatusCode)
+	if retryableStatus(res.StatusCode) {
+		err = retryable(ctx, err, retryAfter(res.Header))
+	}
+	return "", "", err
+}
+
+// modifyRequest applies the modifier set by WithRequestModifier to the request unless it's nil.
+func modifyRequest(req *http.Request, modify func(*http.Request) error) error {
+	if modify == nil {
+		return nil
+	}
+	if err := modify(req); err != nil {
+		return fmt.Errorf("failed to modify the request to %s: %w", req.URL.Redacted(), err)
+	}
+	return nil
+}
+
+// sameOrigin reports whether the URLs have the same scheme and host.
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Scheme == ub.Scheme && ua.Host == ub.Host
+}
+
+// transportFor returns the transport to request the URL serving the blob.
+// Only the registry gets the credentials.
+func (l *Layer) transportFor(u string) http.RoundTripper {
+	if sameOrigin(l.blobURL, u) {
+		return l.rt
+	}
+	return l.base
+}
+
+// rangeValidator returns a validator usable in the If-Range header.
+// Weak ETags can't be used for If-Range, so Last-Modified is used instead in that case.
+func rangeValidator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get("Last-Modified")
 }
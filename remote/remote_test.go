@@ -0,0 +1,243 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestOpenEntry(t *testing.T) {
+	tr := &countingTransport{inner: remotetest.NewTransport()}
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0,
+		remotetest.File{Name: "etc/"},
+		remotetest.File{Name: "etc/a", Content: "content of a"},
+		remotetest.File{Name: "etc/b", Content: "content of b"},
+	))
+	r := remotetest.Open(t, tr)
+
+	layers, err := r.Layers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := layers[0]
+	esgz, err := layer.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Remember the entry found by the lookup, as an index would
+	entry, ok := esgz.Lookup("etc/b")
+	if !ok {
+		t.Fatal("etc/b not found")
+	}
+
+	reads := tr.count()
+	sr, err := layer.OpenEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "content of b" {
+		t.Errorf("got %q, want %q", b, "content of b")
+	}
+	if n := tr.count() - reads; n != 1 {
+		t.Errorf("expected only the content to be fetched, got %d requests", n)
+	}
+
+	if _, err = layer.OpenEntry(nil); err == nil {
+		t.Error("expected an error for a nil entry")
+	}
+	dir, _ := esgz.Lookup("etc")
+	if _, err = layer.OpenEntry(dir); err == nil {
+		t.Error("expected an error for a directory")
+	}
+}
+
+// withETag sets a strong ETag to the blob responses of the transport.
+func withETag(inner http.RoundTripper, etag string) http.RoundTripper {
+	return remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := inner.RoundTrip(req)
+		if err == nil && strings.Contains(req.URL.Path, "/blobs/") {
+			res.Header.Set("ETag", etag)
+		}
+		return res, err
+	})
+}
+
+func TestIfRangeChangedBlob(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "changed"}))
+
+	r := remotetest.Open(t, remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if isBlobRange(req) && !isProbe(req) && req.Header.Get("If-Range") != "" {
+			if req.Header.Get("If-Range") != `"v1"` {
+				t.Errorf("unexpected If-Range %s", req.Header.Get("If-Range"))
+			}
+			// The blob behind the URL has changed since the probe
+			req = req.Clone(req.Context())
+			req.Header.Del("Range")
+		}
+		return withETag(tr, `"v1"`).RoundTrip(req)
+	}))
+	layers, err := r.Layers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = layers[0].Open()
+	if err == nil || !strings.Contains(err.Error(), "has changed since") {
+		t.Fatalf("expected the change to be detected, got %v", err)
+	}
+}
+
+// TestIfRangeIgnoredProbe reads a blob whose probe was answered as a whole, e.g. by a server ignoring ranges.
+// Such a server answers 200 to every conditional range request, which must not be taken as a change.
+func TestIfRangeIgnoredProbe(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "unchanged"}))
+
+	var conditional int
+	r := remotetest.Open(t, remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("If-Range") != "" {
+			conditional++
+		}
+		if isProbe(req) {
+			req = req.Clone(req.Context())
+			req.Header.Del("Range")
+		}
+		return withETag(tr, `"v1"`).RoundTrip(req)
+	}))
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "unchanged" {
+		t.Errorf("unexpected content %q", b)
+	}
+	if conditional > 0 {
+		t.Errorf("%d requests are conditional", conditional)
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	tr := &countingTransport{inner: remotetest.NewTransport()}
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0,
+		remotetest.File{Name: "empty"},
+		remotetest.File{Name: "a", Content: "a"},
+	))
+	r := remotetest.Open(t, tr)
+	l := layersOf(t, r)[0]
+	if _, err := l.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := r.ReadFile(context.Background(), "empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "" {
+		t.Errorf("b %q, want no content", b)
+	}
+
+	reads := tr.count()
+	var buf bytes.Buffer
+	if n, err := l.CopyFile(&buf, "empty"); err != nil || n != 0 {
+		t.Errorf("got %d bytes, %v", n, err)
+	}
+	if n := tr.count() - reads; n != 0 {
+		t.Errorf("expected no request for an empty file, got %d", n)
+	}
+}
+
+func TestReadAtBounds(t *testing.T) {
+	tr := &countingTransport{inner: remotetest.NewTransport()}
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"}))
+	l := layersOf(t, remotetest.Open(t, tr))[0]
+
+	if n, err := l.ReadAt(nil, 0); n != 0 || err != nil {
+		t.Errorf("zero-length read: got %d, %v", n, err)
+	}
+	if _, err := l.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Error("expected an error for a negative offset")
+	}
+	if n, err := l.ReadAt(make([]byte, 1), l.Size()); n != 0 || err != io.EOF {
+		t.Errorf("read at the end: got %d, %v", n, err)
+	}
+	if n := tr.count(); n != 0 {
+		t.Errorf("expected no request, got %d", n)
+	}
+
+	// A read across the end is truncated to the blob
+	p := make([]byte, 10)
+	if n, err := l.ReadAt(p, l.Size()-4); n != 4 || err != io.EOF {
+		t.Errorf("read across the end: got %d, %v", n, err)
+	}
+}
+
+func TestLayersLazy(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner,
+		remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"}),
+		remotetest.Layer(t, 0, remotetest.File{Name: "b", Content: "b"}),
+		remotetest.Layer(t, 0, remotetest.File{Name: "c", Content: "c"}),
+	)
+	var mu sync.Mutex
+	probes := map[string]int{}
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if isProbe(req) {
+			mu.Lock()
+			probes[path.Base(req.URL.Path)]++
+			mu.Unlock()
+		}
+		return inner.RoundTrip(req)
+	})
+	probed := func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		m := probes
+		probes = map[string]int{}
+		return m
+	}
+	r := remotetest.Open(t, tr)
+
+	layers, err := r.LayersLazy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 3 {
+		t.Fatalf("got %d layers, want 3", len(layers))
+	}
+	if m := probed(); len(m) != 0 {
+		t.Errorf("expected no probes before reading, got %v", m)
+	}
+
+	// Only the layer read is resolved, once
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if _, err = layers[1].CopyFile(&buf, "b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]int{layers[1].Digest().String(): 1}
+	if m := probed(); !reflect.DeepEqual(m, want) {
+		t.Errorf("got probes %v, want %v", m, want)
+	}
+
+	// Layers resolves every layer up front
+	if _, err = r.Layers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if m := probed(); len(m) != 3 {
+		t.Errorf("got probes %v, want all the layers", m)
+	}
+}
@@ -0,0 +1,54 @@
+package remotetest_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// printFile is downstream code taking a LayerReader, which is tested with a layer of remotetest.
+func printFile(l remote.LayerReader, name string) error {
+	_, err := l.CopyFile(os.Stdout, name)
+	return err
+}
+
+func ExampleNew() {
+	r, err := remotetest.New([][]remotetest.File{
+		{{Name: "etc/"}, {Name: "etc/os-release", Content: "ID=alpine\n"}},
+		{{Name: "etc/"}, {Name: "etc/os-release", Content: "ID=debian\n"}},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	l, e, err := r.Find(context.Background(), "/etc/os-release")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%s in layer %d: ", e.Name, l.Index())
+	if err = printFile(l, e.Name); err != nil {
+		panic(err)
+	}
+	// Output: etc/os-release in layer 1: ID=debian
+}
+
+func ExampleNewFromBlobs() {
+	blob, _, err := remotetest.BuildLayer([]remotetest.File{{Name: "hello", Content: "hello, world\n"}})
+	if err != nil {
+		panic(err)
+	}
+	r, err := remotetest.NewFromBlobs([][]byte{blob})
+	if err != nil {
+		panic(err)
+	}
+
+	b, err := r.ReadFile(context.Background(), "hello")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(string(b))
+	// Output: hello, world
+}
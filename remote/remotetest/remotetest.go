@@ -0,0 +1,221 @@
+// Package remotetest provides fixtures for testing code using the remote package:
+// estargz layers built in memory and an in-memory registry serving them.
+// Requests are handled in the process by the registry without listening on any port.
+package remotetest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	gremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/internal/footer"
+)
+
+// Reference is the reference of the image pushed by PushLayers and opened by Open and New.
+const Reference = "registry.test/remotetest/image:latest"
+
+// File is a file in a layer built by BuildLayer. Names ending with "/" are directories.
+type File struct {
+	Name    string
+	Content string
+}
+
+// BuildLayer synthesizes an estargz layer of the files in order.
+// It returns the blob and the digest of the TOC JSON.
+func BuildLayer(files []File) ([]byte, string, error) {
+	return BuildLayerChunked(files, 0)
+}
+
+// BuildLayerChunked is BuildLayer splitting file contents into chunks of chunkSize bytes,
+// e.g. to test reads across chunks with small files. Zero means the default of estargz.
+func BuildLayerChunked(files []File, chunkSize int) ([]byte, string, error) {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, f := range files {
+		h := &tar.Header{Name: f.Name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(f.Content))}
+		if strings.HasSuffix(f.Name, "/") {
+			h = &tar.Header{Name: f.Name, Typeflag: tar.TypeDir, Mode: 0o755}
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return nil, "", err
+		}
+		if _, err := io.WriteString(tw, f.Content); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+
+	var blob bytes.Buffer
+	w := estargz.NewWriterWithCompressor(&blob, footer.NewCompressor(gzip.BestCompression))
+	w.ChunkSize = chunkSize
+	if err := w.AppendTar(&tarBuf); err != nil {
+		return nil, "", err
+	}
+	tocDigest, err := w.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	return blob.Bytes(), tocDigest.String(), nil
+}
+
+// New returns a Remote of an image whose layers are the given files, from the bottom.
+// The options are passed to remote.New after the transport to the in-memory registry.
+func New(layers [][]File, opts ...remote.Option) (remote.Remote, error) {
+	var blobs [][]byte
+	for _, files := range layers {
+		blob, _, err := BuildLayer(files)
+		if err != nil {
+			return remote.Remote{}, err
+		}
+		blobs = append(blobs, blob)
+	}
+	return NewFromBlobs(blobs, opts...)
+}
+
+// NewFromBlobs returns a Remote of an image whose layers are the given estargz blobs, from the bottom.
+func NewFromBlobs(blobs [][]byte, opts ...remote.Option) (remote.Remote, error) {
+	t := NewTransport()
+	img, err := NewImage(blobs)
+	if err != nil {
+		return remote.Remote{}, err
+	}
+	if err = Push(t, Reference, img); err != nil {
+		return remote.Remote{}, err
+	}
+	return remote.New(Reference, append([]remote.Option{remote.WithTransport(t)}, opts...)...)
+}
+
+// NewImage returns an image whose layers are the given blobs with the OCI layer media type, from the bottom.
+func NewImage(blobs [][]byte) (v1.Image, error) {
+	img := empty.Image
+	for _, blob := range blobs {
+		b := blob
+		layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(b)), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The TOC digest annotation is not needed to read the layer
+		if img, err = mutate.Append(img, mutate.Addendum{Layer: layer, MediaType: types.OCILayer}); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// RawLayer is a layer of the blob as is with the media type. Unlike the layers of NewImage,
+// it is pushed without being decompressed, so that tests can push corrupted blobs or blobs in other formats.
+// The diff ID is the digest of the blob.
+type RawLayer struct {
+	Blob []byte
+	Type types.MediaType
+}
+
+// Digest returns the digest of the blob.
+func (l RawLayer) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(l.Blob))
+	return h, err
+}
+
+// DiffID returns the digest of the blob.
+func (l RawLayer) DiffID() (v1.Hash, error) {
+	return l.Digest()
+}
+
+// Compressed returns the blob.
+func (l RawLayer) Compressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(l.Blob)), nil
+}
+
+// Uncompressed returns the blob.
+func (l RawLayer) Uncompressed() (io.ReadCloser, error) {
+	return l.Compressed()
+}
+
+// Size returns the size of the blob.
+func (l RawLayer) Size() (int64, error) {
+	return int64(len(l.Blob)), nil
+}
+
+// MediaType returns the media type of the layer.
+func (l RawLayer) MediaType() (types.MediaType, error) {
+	return l.Type, nil
+}
+
+// Push writes the image to the in-memory registry behind the transport.
+func Push(t http.RoundTripper, ref string, img v1.Image) error {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return err
+	}
+	return gremote.Write(r, img, gremote.WithTransport(t))
+}
+
+// NewTransport returns a transport handled by a new in-memory registry.
+func NewTransport() http.RoundTripper {
+	return &transport{reg: NewHandler()}
+}
+
+type transport struct {
+	reg http.Handler
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Handlers expect a non-nil body as in servers
+	sreq := req.Clone(req.Context())
+	if sreq.Body == nil {
+		sreq.Body = http.NoBody
+	}
+
+	rec := httptest.NewRecorder()
+	t.reg.ServeHTTP(rec, sreq)
+
+	res := rec.Result()
+	res.Request = req
+	return res, nil
+}
+
+// NewHandler returns the handler of a new in-memory registry, e.g. to serve it with httptest.
+// Unlike the registry of go-containerregistry alone, it serves range requests of blobs.
+func NewHandler() http.Handler {
+	reg := registry.New(registry.Logger(log.New(ioutil.Discard, "", 0)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !strings.Contains(r.URL.Path, "/blobs/") || r.Header.Get("Range") == "" {
+			reg.ServeHTTP(w, r)
+			return
+		}
+
+		rec := httptest.NewRecorder()
+		reg.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			for k, v := range rec.Header() {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.Code)
+			w.Write(rec.Body.Bytes())
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(rec.Body.Bytes()))
+	})
+}
@@ -0,0 +1,50 @@
+package remotetest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+// Layer builds an estargz layer of the files split into chunks of chunkSize bytes, or the default size if zero.
+// It fails the test on errors.
+func Layer(t testing.TB, chunkSize int, files ...File) []byte {
+	t.Helper()
+	blob, _, err := BuildLayerChunked(files, chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
+
+// PushLayers pushes an image of the blobs, from the bottom, as Reference to the registry behind the transport.
+// It fails the test on errors.
+func PushLayers(t testing.TB, tr http.RoundTripper, blobs ...[]byte) {
+	t.Helper()
+	img, err := NewImage(blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Push(tr, Reference, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Open opens Reference through the transport with the options. It fails the test on errors.
+func Open(t testing.TB, tr http.RoundTripper, opts ...remote.Option) remote.Remote {
+	t.Helper()
+	r, err := remote.New(Reference, append([]remote.Option{remote.WithTransport(tr)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// RoundTripFunc adapts a function to http.RoundTripper so that tests can intercept requests.
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,82 @@
+package remote
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// authCacheTTL is how long a Resolver reuses the credentials resolved from the keychain.
+// It is shorter than the refresh margin of expiring tokens, e.g. those of the ecr package.
+const authCacheTTL = time.Minute
+
+// Resolver opens Remotes sharing the options and the credentials resolved from the keychain,
+// so that a service opening many images doesn't read the docker config or call the cloud SDKs for each of them.
+// It is safe for concurrent use.
+type Resolver struct {
+	opts []Option
+}
+
+// NewResolver returns a Resolver opening Remotes with the options.
+func NewResolver(opts ...Option) (*Resolver, error) {
+	o, err := makeOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy opts so that the caller's slice isn't modified
+	return &Resolver{opts: append(opts[:len(opts):len(opts)], WithKeychain(newCachingKeychain(o.keychain)))}, nil
+}
+
+// defaultResolver is the Resolver of New, so that images opened by New share the credentials of the default keychain.
+var defaultResolver = &Resolver{opts: []Option{WithKeychain(newCachingKeychain(authn.DefaultKeychain))}}
+
+// Open resolves the image and returns the Remote reading it. The options are applied after those of the Resolver.
+// Credentials are shared unless the options set another keychain.
+func (r *Resolver) Open(ctx context.Context, ref string, opts ...Option) (*Remote, error) {
+	rem, err := open(ctx, ref, append(r.opts[:len(r.opts):len(r.opts)], opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &rem, nil
+}
+
+// cachingKeychain caches the authenticators resolved by the inner keychain per registry.
+type cachingKeychain struct {
+	inner authn.Keychain
+
+	mu      sync.Mutex
+	entries map[string]authEntry
+}
+
+func newCachingKeychain(inner authn.Keychain) *cachingKeychain {
+	return &cachingKeychain{inner: inner, entries: map[string]authEntry{}}
+}
+
+type authEntry struct {
+	auth    authn.Authenticator
+	expires time.Time
+}
+
+func (k *cachingKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	key := target.RegistryStr()
+
+	k.mu.Lock()
+	e, ok := k.entries[key]
+	k.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.auth, nil
+	}
+
+	auth, err := k.inner.Resolve(target)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.entries[key] = authEntry{auth: auth, expires: time.Now().Add(authCacheTTL)}
+	k.mu.Unlock()
+	return auth, nil
+}
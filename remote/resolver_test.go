@@ -0,0 +1,102 @@
+package remote_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// countingKeychain counts the resolutions of the inner keychain.
+type countingKeychain struct {
+	inner authn.Keychain
+	n     int32
+}
+
+func (k *countingKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	atomic.AddInt32(&k.n, 1)
+	return k.inner.Resolve(target)
+}
+
+func TestResolverSharesCredentials(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"}))
+
+	kc := &countingKeychain{inner: authn.NewMultiKeychain()}
+	res, err := remote.NewResolver(remote.WithTransport(tr), remote.WithKeychain(kc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := res.Open(context.Background(), remotetest.Reference); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&kc.n); n != 1 {
+		t.Errorf("expected the keychain to be resolved once, got %d", n)
+	}
+}
+
+// writeDockerConfig writes the docker config with the credentials of the host.
+func writeDockerConfig(t *testing.T, dir, host, user, pass string) {
+	t.Helper()
+	auth := base64.StdEncoding.EncodeToString([]byte(user + ":" + pass))
+	config := fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, host, auth)
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewSharesDefaultKeychain(t *testing.T) {
+	reg := registry.New(registry.Logger(log.New(ioutil.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	ref := host + "/project/image:latest"
+
+	img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withAuth := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.SetBasicAuth("user", "pass")
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	if err = remotetest.Push(withAuth, ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	setenv(t, "DOCKER_CONFIG", dir)
+	writeDockerConfig(t, dir, host, "user", "pass")
+	if _, err := remote.New(ref); err != nil {
+		t.Fatal(err)
+	}
+
+	// The credentials resolved by the first New are reused
+	writeDockerConfig(t, dir, host, "user", "wrong")
+	if _, err := remote.New(ref); err != nil {
+		t.Fatalf("the credentials aren't shared: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = 500 * time.Millisecond
+)
+
+// retryPolicy configures how requests to the registry are retried on transient failures.
+type retryPolicy struct {
+	attempts int           // the maximum number of attempts including the first one
+	backoff  time.Duration // the delay before the first retry, doubled after each retry
+}
+
+// retryableError is an error which may be resolved by retrying the request.
+type retryableError struct {
+	err   error
+	after time.Duration // the delay requested by the server with Retry-After
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// retryable marks the error as retryable unless the context is done.
+func retryable(ctx context.Context, err error, after time.Duration) error {
+	if ctx.Err() != nil || errors.Is(err, ErrOffline) || errors.Is(err, ErrRequestBudgetExceeded) {
+		return err
+	}
+	return &retryableError{err: err, after: after}
+}
+
+// do calls fn until it succeeds, returns a non-retryable error, or the attempts are exhausted.
+func (p retryPolicy) do(ctx context.Context, fn func() error) error {
+	backoff := p.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		var re *retryableError
+		if err == nil || attempt >= p.attempts || !errors.As(err, &re) {
+			return err
+		}
+
+		delay := backoff
+		if re.after > delay {
+			delay = re.after
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// retryableStatus reports whether the status code indicates a transient failure.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header, which is either seconds or an HTTP date.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// dialError reports whether the error happened before connecting to the host,
+// e.g. the host couldn't be resolved or refused the connection.
+func dialError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// retryableRegistryError marks the error returned by go-containerregistry as retryable
+// if it is a network error or has a transient status.
+func retryableRegistryError(ctx context.Context, err error) error {
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		if retryableStatus(terr.StatusCode) {
+			return retryable(ctx, err, 0)
+		}
+		return err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return retryable(ctx, err, 0)
+	}
+	return err
+}
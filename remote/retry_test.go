@@ -0,0 +1,165 @@
+package remote_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestRetryRedirect(t *testing.T) {
+	inner := withCDN(remotetest.NewTransport())
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "retried"}))
+
+	// The first probe of the blob fails with 503, and the retry is redirected to the CDN
+	var probes, cdnRequests int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == cdnHost {
+			atomic.AddInt32(&cdnRequests, 1)
+		}
+		if isProbe(req) && req.URL.Host != cdnHost && atomic.AddInt32(&probes, 1) == 1 {
+			return statusResponse(req, http.StatusServiceUnavailable), nil
+		}
+		return inner.RoundTrip(req)
+	})
+	r := remotetest.Open(t, tr, remote.WithRetry(2, 0))
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "retried" {
+		t.Errorf("got %q, want %q", b, "retried")
+	}
+	if n := atomic.LoadInt32(&probes); n != 2 {
+		t.Errorf("got %d probes, want 2", n)
+	}
+	if atomic.LoadInt32(&cdnRequests) == 0 {
+		t.Error("the blob wasn't read from the CDN")
+	}
+
+	// Without retries, the failure is returned
+	atomic.StoreInt32(&probes, 0)
+	r = remotetest.Open(t, tr, remote.WithRetry(1, 0))
+	if _, err = r.Layers(context.Background()); err == nil {
+		t.Error("expected the 503 to be returned")
+	}
+}
+
+func TestReresolveUnreachableCDN(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "from another edge"}))
+
+	// The registry redirects to an edge which goes down after the redirect is resolved, and to a working one after that
+	var probes, refused int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		switch {
+		case req.URL.Host == "edge1.test" && !isProbe(req):
+			atomic.AddInt32(&refused, 1)
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		case req.URL.Host == "edge1.test" || req.URL.Host == "edge2.test":
+			return inner.RoundTrip(req)
+		case isProbe(req):
+			edge := "edge1.test"
+			if atomic.AddInt32(&probes, 1) > 1 {
+				edge = "edge2.test"
+			}
+			return redirectResponse(req, "https://"+edge+req.URL.Path), nil
+		}
+		return inner.RoundTrip(req)
+	})
+	r := remotetest.Open(t, tr, remote.WithRetry(1, 0))
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "from another edge" {
+		t.Errorf("got %q, want %q", b, "from another edge")
+	}
+	if atomic.LoadInt32(&refused) == 0 || atomic.LoadInt32(&probes) != 2 {
+		t.Errorf("expected the redirect to be resolved again after the refusal, got %d probes", probes)
+	}
+}
+
+func TestReadTimeoutRetried(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "eventually"}))
+
+	// The first range request hangs until it is canceled
+	var reads int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if isBlobRange(req) && !isProbe(req) && atomic.AddInt32(&reads, 1) == 1 {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		return inner.RoundTrip(req)
+	})
+	r := remotetest.Open(t, tr, remote.WithReadTimeout(50*time.Millisecond), remote.WithRetry(2, 0))
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "eventually" {
+		t.Errorf("got %q, want %q", b, "eventually")
+	}
+	if n := atomic.LoadInt32(&reads); n < 2 {
+		t.Errorf("expected the timed-out request to be retried, got %d requests", n)
+	}
+}
+
+func TestRetryManifestAndConfig(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"}))
+
+	tests := []struct {
+		name string
+		fail func(req *http.Request) bool
+	}{
+		{
+			name: "manifest",
+			fail: func(req *http.Request) bool { return strings.Contains(req.URL.Path, "/manifests/") },
+		},
+		{
+			// The config is the only blob read without a range in New
+			name: "config",
+			fail: func(req *http.Request) bool {
+				return strings.Contains(req.URL.Path, "/blobs/") && req.Header.Get("Range") == ""
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The first request fails with 503
+			var failed int32
+			tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if tt.fail(req) && atomic.AddInt32(&failed, 1) == 1 {
+					return statusResponse(req, http.StatusServiceUnavailable), nil
+				}
+				return inner.RoundTrip(req)
+			})
+
+			r, err := remote.New(remotetest.Reference, remote.WithTransport(tr), remote.WithRetry(2, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = r.Config(); err != nil {
+				t.Fatal(err)
+			}
+			if n := atomic.LoadInt32(&failed); n < 2 {
+				t.Errorf("expected a retry, got %d requests", n)
+			}
+
+			// Without retries, the failure is returned
+			atomic.StoreInt32(&failed, 0)
+			if _, err = remote.New(remotetest.Reference, remote.WithTransport(tr), remote.WithRetry(1, 0)); err == nil {
+				t.Error("expected the 503 to be returned")
+			}
+		})
+	}
+}
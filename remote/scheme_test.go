@@ -0,0 +1,94 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// TestWithSchemeHTTP reads an image from a registry served only over http,
+// while go-containerregistry accesses registry.test over https.
+func TestWithSchemeHTTP(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "hello", Content: "world"}))
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Scheme != "http" {
+			return nil, errors.New("connection refused")
+		}
+		return inner.RoundTrip(req)
+	})
+
+	r := remotetest.Open(t, tr, remote.WithScheme("http"))
+	b, err := r.ReadFile(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "world" {
+		t.Errorf("unexpected content %q", b)
+	}
+
+	if _, err := remote.New(remotetest.Reference, remote.WithScheme("ftp")); err == nil {
+		t.Error("expected an error for an invalid scheme")
+	}
+}
+
+// TestWithSchemeHTTPS reads an image from a local registry served over TLS.
+// go-containerregistry falls back to http for local registries when the ping over https fails,
+// which must not happen when https is forced.
+func TestWithSchemeHTTPS(t *testing.T) {
+	var plain int
+	srv := httptest.NewTLSServer(remotetest.NewHandler())
+	defer srv.Close()
+	var pinged bool
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Scheme != "https" {
+			plain++
+		}
+		if req.URL.Path == "/v2/" && !pinged {
+			pinged = true
+			return nil, errors.New("transient error")
+		}
+		return srv.Client().Transport.RoundTrip(req)
+	})
+
+	ref := strings.TrimPrefix(srv.URL, "https://") + "/project/image:latest"
+	img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "hello", Content: "world"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = remotetest.Push(&httpsForced{srv.Client().Transport}, ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := remote.New(ref, remote.WithScheme("https"), remote.WithTransport(tr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.ReadFile(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "world" {
+		t.Errorf("unexpected content %q", b)
+	}
+	if plain > 0 {
+		t.Errorf("%d requests are sent over http", plain)
+	}
+}
+
+// httpsForced sends every request over https, to push the image to the TLS registry.
+type httpsForced struct {
+	inner http.RoundTripper
+}
+
+func (t *httpsForced) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = "https"
+	return t.inner.RoundTrip(req)
+}
@@ -0,0 +1,139 @@
+package remote
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// sessionRefreshMargin is how long before the expiry a pre-signed URL is resolved again by a Session.
+	// URLs expiring sooner are resolved again halfway to the expiry.
+	sessionRefreshMargin = 30 * time.Second
+
+	// sessionRetryInterval is the interval of retrying a failed refresh.
+	sessionRetryInterval = 5 * time.Second
+)
+
+// Session holds the layers of a Remote whose pre-signed URLs are kept valid while it's open.
+// URLs advertising their expiry, e.g. by X-Amz-Expires, are resolved again in the background before they expire.
+type Session struct {
+	layers []*Layer
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Session resolves the URLs of all the layers and returns the session keeping them valid until Close is called
+// or ctx is canceled.
+func (r Remote) Session(ctx context.Context) (*Session, error) {
+	layers, err := r.Layers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Session{layers: layers, cancel: cancel}
+	for _, l := range layers {
+		s.wg.Add(1)
+		go s.refresh(ctx, l)
+	}
+	return s, nil
+}
+
+// Layers returns the layers of the session, which are the same as those returned by Remote.Layers.
+func (s *Session) Layers() []*Layer {
+	return s.layers
+}
+
+// Close stops refreshing the URLs and releases the layers.
+func (s *Session) Close() error {
+	s.cancel()
+	s.wg.Wait()
+
+	var err error
+	for _, l := range s.layers {
+		if cerr := l.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// refresh resolves the URL of the layer again before it expires until ctx is canceled.
+func (s *Session) refresh(ctx context.Context, l *Layer) {
+	defer s.wg.Done()
+
+	for {
+		expiry, ok := urlExpiry(l.resolvedURL())
+		if !ok {
+			return
+		}
+		if !sleep(ctx, refreshDelay(time.Until(expiry))) {
+			return
+		}
+		if err := l.reresolve(ctx); err != nil && !sleep(ctx, sessionRetryInterval) {
+			return
+		}
+	}
+}
+
+// refreshDelay returns how long to wait before refreshing a URL expiring after remaining.
+func refreshDelay(remaining time.Duration) time.Duration {
+	switch {
+	case remaining > 2*sessionRefreshMargin:
+		return remaining - sessionRefreshMargin
+	case remaining > 0:
+		return remaining / 2
+	}
+	return 0
+}
+
+// sleep waits for d and reports whether ctx is still alive.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// urlExpiry returns the expiry advertised in the query of a pre-signed URL:
+// X-Amz-Date and X-Amz-Expires of AWS Signature Version 4, X-Goog-Date and X-Goog-Expires of GCS,
+// or the Unix time in Expires of AWS Signature Version 2 and CloudFront.
+func urlExpiry(s string) (time.Time, bool) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	q := u.Query()
+
+	for _, prefix := range []string{"X-Amz-", "X-Goog-"} {
+		date, expires := q.Get(prefix+"Date"), q.Get(prefix+"Expires")
+		if date == "" || expires == "" {
+			continue
+		}
+		t, err := time.Parse("20060102T150405Z", date)
+		if err != nil {
+			return time.Time{}, false
+		}
+		secs, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t.Add(time.Duration(secs) * time.Second), true
+	}
+
+	if expires := q.Get("Expires"); expires != "" {
+		secs, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(secs, 0), true
+	}
+	return time.Time{}, false
+}
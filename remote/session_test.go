@@ -0,0 +1,71 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestSession(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "pre-signed"}))
+
+	// The CDN URLs expire in 2 seconds and are refused after that
+	var resolved int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host != cdnHost {
+			if isBlobRange(req) {
+				atomic.AddInt32(&resolved, 1)
+				return redirectResponse(req, fmt.Sprintf("https://%s%s?Expires=%d", cdnHost, req.URL.Path, time.Now().Add(2*time.Second).Unix())), nil
+			}
+			return inner.RoundTrip(req)
+		}
+		expires, err := strconv.ParseInt(req.URL.Query().Get("Expires"), 10, 64)
+		if err != nil || time.Now().Unix() >= expires {
+			return statusResponse(req, http.StatusForbidden), nil
+		}
+		return inner.RoundTrip(req)
+	})
+
+	s, err := remotetest.Open(t, tr).Session(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&resolved); n != 1 {
+		t.Fatalf("expected the URL to be resolved once, got %d", n)
+	}
+
+	// The URL is resolved again halfway to the expiry, before it is used
+	time.Sleep(2500 * time.Millisecond)
+	if n := atomic.LoadInt32(&resolved); n < 2 {
+		t.Errorf("expected the URL to be refreshed proactively, resolved %d times", n)
+	}
+	before := atomic.LoadInt32(&resolved)
+	var buf bytes.Buffer
+	if _, err = s.Layers()[0].CopyFile(&buf, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "pre-signed" {
+		t.Errorf("unexpected content %q", buf.String())
+	}
+	// Reading didn't need to resolve the expired URL again
+	if n := atomic.LoadInt32(&resolved); n != before {
+		t.Errorf("expected the refreshed URL to be valid, resolved %d more times on read", n-before)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	closed := atomic.LoadInt32(&resolved)
+	time.Sleep(1500 * time.Millisecond)
+	if n := atomic.LoadInt32(&resolved); n != closed {
+		t.Errorf("expected no refresh after Close, got %d", n-closed)
+	}
+}
@@ -0,0 +1,143 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+// pushAnnotated pushes an image of the blob annotated with the TOC digest unless it is empty.
+func pushAnnotated(t *testing.T, tr http.RoundTripper, blob []byte, tocDigest string) {
+	t.Helper()
+	add := mutate.Addendum{Layer: layerOf(t, blob), MediaType: types.OCILayer}
+	if tocDigest != "" {
+		add.Annotations = map[string]string{estargz.TOCJSONDigestAnnotation: tocDigest}
+	}
+	img, err := mutate.Append(empty.Image, add)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = remotetest.Push(tr, remotetest.Reference, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// randomFile returns a file of incompressible content, so that files of the same size are laid out alike in blobs.
+func randomFile(seed int64) remotetest.File {
+	content := make([]byte, 3000)
+	rand.New(rand.NewSource(seed)).Read(content)
+	return remotetest.File{Name: "a", Content: string(content)}
+}
+
+// flippingTransport flips the byte of the blobs at the offset in the responses of range requests.
+func flippingTransport(inner http.RoundTripper, offset int64) http.RoundTripper {
+	return remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := inner.RoundTrip(req)
+		if err != nil || !isBlobRange(req) || res.StatusCode != http.StatusPartialContent {
+			return res, err
+		}
+		var begin, end, size int64
+		if _, err := fmt.Sscanf(res.Header.Get("Content-Range"), "bytes %d-%d/%d", &begin, &end, &size); err != nil {
+			return res, nil
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if begin <= offset && offset <= end {
+			b[offset-begin] ^= 0xff
+		}
+		res.Body = ioutil.NopCloser(bytes.NewReader(b))
+		return res, nil
+	})
+}
+
+func TestStrictVerification(t *testing.T) {
+	file := randomFile(1)
+	blob, tocDigest, err := remotetest.BuildLayerChunked([]remotetest.File{file}, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("verified", func(t *testing.T) {
+		tr := remotetest.NewTransport()
+		pushAnnotated(t, tr, blob, tocDigest)
+		r := remotetest.Open(t, tr, remote.WithStrictVerification())
+		b, err := r.ReadFile(context.Background(), "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != file.Content {
+			t.Error("unexpected content")
+		}
+		if b, err = layersOf(t, r)[0].ReadFileRange("a", 1500, 10); err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != file.Content[1500:1510] {
+			t.Error("unexpected content of the range")
+		}
+	})
+
+	t.Run("missing annotation", func(t *testing.T) {
+		tr := remotetest.NewTransport()
+		pushAnnotated(t, tr, blob, "")
+		if _, err := remotetest.Open(t, tr, remote.WithStrictVerification()).ReadFile(context.Background(), "a"); err == nil {
+			t.Fatal("expected the layer without the annotation to be refused")
+		}
+	})
+
+	t.Run("TOC digest mismatch", func(t *testing.T) {
+		tr := remotetest.NewTransport()
+		_, otherDigest, err := remotetest.BuildLayer([]remotetest.File{randomFile(2)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pushAnnotated(t, tr, blob, otherDigest)
+		if _, err := remotetest.Open(t, tr, remote.WithStrictVerification()).ReadFile(context.Background(), "a"); err == nil {
+			t.Fatal("expected the TOC not matching the annotation to be refused")
+		}
+	})
+
+	t.Run("tampered chunk", func(t *testing.T) {
+		inner := remotetest.NewTransport()
+		pushAnnotated(t, inner, blob, tocDigest)
+		esgz, err := layersOf(t, remotetest.Open(t, inner))[0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ce, ok := esgz.ChunkEntryForOffset("a", 1000)
+		if !ok {
+			t.Fatal("no chunk at 1000")
+		}
+		// Incompressible content is stored as is after the gzip header and the header of the stored block
+		tr := flippingTransport(inner, ce.Offset+10+5+100)
+
+		// Without verification, the tampered content is returned
+		b, err := remotetest.Open(t, tr).ReadFile(context.Background(), "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) == file.Content {
+			t.Fatal("the content isn't tampered")
+		}
+
+		_, err = remotetest.Open(t, tr, remote.WithStrictVerification()).ReadFile(context.Background(), "a")
+		if err == nil || !strings.Contains(err.Error(), "invalid chunk") {
+			t.Fatalf("got %v, want the tampered chunk to be refused", err)
+		}
+	})
+}
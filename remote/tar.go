@@ -0,0 +1,129 @@
+package remote
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// WriteTar writes a tar archive of the subtree at dir in the merged view of the image to w.
+// Entries keep their paths in the image and the metadata recorded in the TOC, such as modes and owners.
+// The content of each file is fetched while the archive is written, so w can be a pipe to another tool.
+// The progress of the content of all the files is reported to the callback set by WithProgress.
+func (r Remote) WriteTar(ctx context.Context, w io.Writer, dir string) error {
+	type item struct {
+		l *Layer
+		e *estargz.TOCEntry
+	}
+
+	dir = cleanPath(dir)
+	var items []item
+	err := r.Walk(ctx, func(l *Layer, e *estargz.TOCEntry) error {
+		if e.Name == "" {
+			// The root directory
+			return nil
+		}
+		if dir == "" || e.Name == dir || strings.HasPrefix(e.Name, dir+"/") {
+			items = append(items, item{l: l, e: e})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 && dir != "" {
+		return ErrNotFound
+	}
+
+	// Parent directories come before their children
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].e.Name < items[j].e.Name
+	})
+
+	var total, done int64
+	for _, it := range items {
+		if it.e.Type == "reg" {
+			total += it.e.Size
+		}
+	}
+	pr := newProgress(r.opts.progress, total)
+
+	tw := tar.NewWriter(w)
+	for _, it := range items {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		h, err := tarHeader(it.e)
+		if err != nil {
+			return err
+		}
+		if err = tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if h.Typeflag == tar.TypeReg && h.Size > 0 {
+			n, err := it.l.copyFile(tw, it.e.Name, nil, func(written int64) {
+				pr.set(done + written)
+			})
+			if err != nil {
+				return err
+			}
+			done += n
+		}
+	}
+	return tw.Close()
+}
+
+// tarHeader restores the tar header of the TOC entry.
+func tarHeader(e *estargz.TOCEntry) (*tar.Header, error) {
+	h := &tar.Header{
+		Name:     e.Name,
+		Linkname: e.LinkName,
+		Mode:     e.Mode,
+		Uid:      e.UID,
+		Gid:      e.GID,
+		Uname:    e.Uname,
+		Gname:    e.Gname,
+		ModTime:  e.ModTime(),
+		Devmajor: int64(e.DevMajor),
+		Devminor: int64(e.DevMinor),
+	}
+
+	switch e.Type {
+	case "dir":
+		h.Typeflag = tar.TypeDir
+		h.Name += "/"
+		if h.Mode == 0 {
+			// Implicit directories have no entries in the TOC
+			h.Mode = 0o755
+		}
+	case "reg":
+		h.Typeflag = tar.TypeReg
+		h.Size = e.Size
+	case "symlink":
+		h.Typeflag = tar.TypeSymlink
+	case "hardlink":
+		h.Typeflag = tar.TypeLink
+	case "char":
+		h.Typeflag = tar.TypeChar
+	case "block":
+		h.Typeflag = tar.TypeBlock
+	case "fifo":
+		h.Typeflag = tar.TypeFifo
+	default:
+		return nil, fmt.Errorf("%s: unsupported entry type %q", e.Name, e.Type)
+	}
+
+	if len(e.Xattrs) > 0 {
+		h.PAXRecords = map[string]string{}
+		for k, v := range e.Xattrs {
+			h.PAXRecords["SCHILY.xattr."+k] = string(v)
+		}
+	}
+	return h, nil
+}
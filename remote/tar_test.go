@@ -0,0 +1,74 @@
+package remote_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+)
+
+func TestWriteTar(t *testing.T) {
+	r := newRemote(t, overlayLayers)
+
+	type entry struct {
+		name     string
+		typeflag byte
+		mode     int64
+		content  string
+	}
+	tests := []struct {
+		dir  string
+		want []entry
+	}{
+		{
+			dir: "/etc",
+			want: []entry{
+				{name: "etc/", typeflag: tar.TypeDir, mode: 0o755},
+				{name: "etc/os-release", typeflag: tar.TypeReg, mode: 0o644, content: "upper"},
+			},
+		},
+		{
+			dir: "/",
+			want: []entry{
+				{name: "etc/", typeflag: tar.TypeDir, mode: 0o755},
+				{name: "etc/os-release", typeflag: tar.TypeReg, mode: 0o644, content: "upper"},
+				{name: "var/", typeflag: tar.TypeDir, mode: 0o755},
+			},
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := r.WriteTar(context.Background(), &buf, tt.dir); err != nil {
+			t.Fatalf("%s: %v", tt.dir, err)
+		}
+
+		var got []entry
+		tr := tar.NewReader(&buf)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", tt.dir, err)
+			}
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.dir, err)
+			}
+			got = append(got, entry{name: h.Name, typeflag: h.Typeflag, mode: h.Mode, content: string(b)})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.dir, got, tt.want)
+		}
+	}
+
+	if err := r.WriteTar(context.Background(), ioutil.Discard, "missing"); !errors.Is(err, remote.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,65 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrBinary is returned when the content isn't text.
+var ErrBinary = errors.New("binary content")
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// ReadFileString reads the file at the path in the merged view and decodes it as text with DecodeText.
+func (r Remote) ReadFileString(ctx context.Context, p string) (string, error) {
+	b, err := r.ReadFile(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	s, err := DecodeText(b)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", p, err)
+	}
+	return s, nil
+}
+
+// DecodeText decodes the content into a string.
+// The encoding is UTF-16 if the content starts with a UTF-16 BOM and UTF-8 otherwise. The BOM is removed.
+// It returns ErrBinary if the content is not valid in the encoding or contains NUL characters.
+func DecodeText(b []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return decodeUTF16(b[len(bomUTF16LE):], binary.LittleEndian)
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return decodeUTF16(b[len(bomUTF16BE):], binary.BigEndian)
+	}
+
+	b = bytes.TrimPrefix(b, bomUTF8)
+	if !utf8.Valid(b) || bytes.IndexByte(b, 0) >= 0 {
+		return "", ErrBinary
+	}
+	return string(b), nil
+}
+
+func decodeUTF16(b []byte, order binary.ByteOrder) (string, error) {
+	if len(b)%2 != 0 {
+		return "", ErrBinary
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[2*i:])
+		if u[i] == 0 {
+			return "", ErrBinary
+		}
+	}
+	return string(utf16.Decode(u)), nil
+}
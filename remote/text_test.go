@@ -0,0 +1,51 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestReadFileString(t *testing.T) {
+	r := newRemote(t, [][]remotetest.File{{
+		{Name: "utf8", Content: "héllo"},
+		{Name: "utf8-bom", Content: "\xef\xbb\xbfhéllo"},
+		{Name: "utf16le", Content: "\xff\xfeh\x00\xe9\x00l\x00l\x00o\x00"},
+		{Name: "utf16be", Content: "\xfe\xff\x00h\x00\xe9\x00l\x00l\x00o"},
+		{Name: "utf16-odd", Content: "\xff\xfeh\x00\xe9"},
+		{Name: "nul", Content: "bin\x00ary"},
+		{Name: "invalid", Content: "\xff\xff\xff"},
+	}})
+	tests := []struct {
+		path    string
+		want    string
+		wantErr error
+	}{
+		{path: "utf8", want: "héllo"},
+		{path: "utf8-bom", want: "héllo"},
+		{path: "utf16le", want: "héllo"},
+		{path: "utf16be", want: "héllo"},
+		{path: "utf16-odd", wantErr: remote.ErrBinary},
+		{path: "nul", wantErr: remote.ErrBinary},
+		{path: "invalid", wantErr: remote.ErrBinary},
+		{path: "missing", wantErr: remote.ErrNotFound},
+	}
+	for _, tt := range tests {
+		got, err := r.ReadFileString(context.Background(), tt.path)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: got %v, want %v", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package remote
+
+import (
+	"context"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// TOC returns every entry in the TOC of the layer.
+// Chunk entries of a file split into multiple chunks follow the entry of the file.
+func (l *Layer) TOC(ctx context.Context) ([]*estargz.TOCEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	esgz, err := l.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*estargz.TOCEntry
+	walkEntries(esgz, func(e *estargz.TOCEntry) {
+		entries = append(entries, e)
+		if e.Type == "reg" {
+			entries = append(entries, chunksOf(esgz, e)[1:]...)
+		}
+	})
+	return entries, nil
+}
+
+// chunksOf returns all chunk entries of the regular file. The first one is the file entry itself.
+func chunksOf(r *estargz.Reader, e *estargz.TOCEntry) []*estargz.TOCEntry {
+	chunks := []*estargz.TOCEntry{e}
+	for off := e.ChunkOffset + e.ChunkSize; e.ChunkSize > 0 && off < e.Size; {
+		ce, ok := r.ChunkEntryForOffset(e.Name, off)
+		if !ok || ce.ChunkSize == 0 {
+			break
+		}
+		chunks = append(chunks, ce)
+		off = ce.ChunkOffset + ce.ChunkSize
+	}
+	return chunks
+}
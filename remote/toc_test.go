@@ -0,0 +1,67 @@
+package remote_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestTOC(t *testing.T) {
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 4,
+		remotetest.File{Name: "etc/"},
+		remotetest.File{Name: "etc/hostname", Content: "host"},
+		remotetest.File{Name: "usr/"},
+		remotetest.File{Name: "usr/bin/"},
+		remotetest.File{Name: "usr/bin/app", Content: "0123456789"},
+	))
+	l := layersOf(t, remotetest.Open(t, tr))[0]
+
+	entries, err := l.TOC(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	chunks := map[string][]int64{}
+	for _, e := range entries {
+		switch e.Type {
+		case "chunk":
+			chunks[e.Name] = append(chunks[e.Name], e.ChunkOffset)
+		default:
+			files = append(files, e.Name+"("+e.Type+")")
+			if e.Type == "reg" {
+				chunks[e.Name] = append(chunks[e.Name], e.ChunkOffset)
+			}
+		}
+	}
+	sort.Strings(files) // the root directory comes first with an empty name
+	want := []string{"(dir)", "etc(dir)", "etc/hostname(reg)", "usr(dir)", "usr/bin(dir)", "usr/bin/app(reg)"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got %s, want %s", strings.Join(files, " "), strings.Join(want, " "))
+	}
+
+	// Chunk entries follow the file entry in order
+	if got, want := chunks["usr/bin/app"], []int64{0, 4, 8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got chunk offsets %v, want %v", got, want)
+	}
+}
+
+func TestTOCCanceled(t *testing.T) {
+	tr := &countingTransport{inner: remotetest.NewTransport()}
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "a"}))
+	l := layersOf(t, remotetest.Open(t, tr))[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.TOC(ctx); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if n := tr.count(); n != 0 {
+		t.Errorf("expected no request, got %d", n)
+	}
+}
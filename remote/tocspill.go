@@ -0,0 +1,97 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// spillTOC downloads the TOC of the layer to a temp file if it is larger than the threshold set by WithTOCSpill,
+// and returns the reader of the blob serving the TOC from the file.
+// estargz still decodes the TOC in memory, but the raw TOC is streamed to the file instead of being buffered.
+func (l *Layer) spillTOC(ra io.ReaderAt) (io.ReaderAt, error) {
+	footer, toc, err := l.metadataSize()
+	if err != nil || toc <= l.tocSpill {
+		// estargz reports an invalid footer
+		return ra, nil
+	}
+	off := l.size - footer - toc
+
+	f, err := ioutil.TempFile("", "stargz-toc-*")
+	if err != nil {
+		return nil, err
+	}
+	if err = l.downloadRange(f, off); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("failed to spill the TOC of %s: %w", l.digest, err)
+	}
+	l.spill = f
+	return &spilledReaderAt{ra: ra, f: f, off: off}, nil
+}
+
+// downloadRange writes the blob from offset to the end to w.
+func (l *Layer) downloadRange(w io.Writer, offset int64) error {
+	rc, err := l.fetch(l.ctx, offset, l.size-1)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	n, err := io.Copy(w, rc)
+	if err != nil {
+		return err
+	}
+	if n != l.size-offset {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// spilledReaderAt reads the blob from off to the end from f and the rest from ra.
+type spilledReaderAt struct {
+	ra  io.ReaderAt
+	f   *os.File
+	off int64
+}
+
+func (r *spilledReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	if offset >= r.off {
+		return r.f.ReadAt(p, offset-r.off)
+	}
+	if offset+int64(len(p)) <= r.off {
+		return r.ra.ReadAt(p, offset)
+	}
+
+	n, err := r.ra.ReadAt(p[:r.off-offset], offset)
+	if err != nil {
+		return n, err
+	}
+	m, err := r.f.ReadAt(p[n:], 0)
+	return n + m, err
+}
+
+// Close releases the local files held by the layer, i.e. the gzip index set by WithGzipIndex,
+// the TOC spilled by WithTOCSpill and the reader of the blob store set by WithBlobStore.
+// The layer can't be read after Close.
+func (l *Layer) Close() error {
+	var err error
+	if l.gzipIndex != nil {
+		err = l.gzipIndex.Close()
+	}
+	if l.spill != nil {
+		if cerr := l.spill.Close(); err == nil {
+			err = cerr
+		}
+		if rerr := os.Remove(l.spill.Name()); err == nil {
+			err = rerr
+		}
+	}
+	if l.local != nil {
+		if cerr := l.local.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
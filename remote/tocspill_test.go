@@ -0,0 +1,67 @@
+package remote_test
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestTOCSpill(t *testing.T) {
+	// Many entries make a TOC of hundreds of kilobytes
+	var files []remotetest.File
+	for i := 0; i < 2000; i++ {
+		files = append(files, remotetest.File{Name: fmt.Sprintf("file-%04d", i), Content: fmt.Sprint(i)})
+	}
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 0, files...))
+
+	tests := []struct {
+		name      string
+		threshold int64
+		wantSpill bool
+	}{
+		{name: "above the threshold", threshold: 1024, wantSpill: true},
+		{name: "below the threshold", threshold: 1 << 30, wantSpill: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			setenv(t, "TMPDIR", tmp)
+
+			l := layersOf(t, remotetest.Open(t, tr, remote.WithTOCSpill(tt.threshold)))[0]
+			if _, err := l.Open(); err != nil {
+				t.Fatal(err)
+			}
+			spilled, err := filepath.Glob(filepath.Join(tmp, "stargz-toc-*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(spilled) == 1; got != tt.wantSpill {
+				t.Errorf("expected spilled %v, got %d files", tt.wantSpill, len(spilled))
+			}
+
+			var buf bytes.Buffer
+			if _, err = l.CopyFile(&buf, "file-1234"); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != "1234" {
+				t.Errorf("unexpected content %q", buf.String())
+			}
+
+			if err = l.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if spilled, _ = filepath.Glob(filepath.Join(tmp, "stargz-toc-*")); len(spilled) != 0 {
+				t.Errorf("expected the spilled TOC to be removed, got %v", spilled)
+			}
+		})
+	}
+
+	if _, err := remote.New(remotetest.Reference, remote.WithTransport(tr), remote.WithTOCSpill(0)); err == nil {
+		t.Error("expected an error for a zero threshold")
+	}
+}
@@ -0,0 +1,185 @@
+package remote
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// errNoFastPath is returned when a file can't be looked up by scanning the TOC.
+var errNoFastPath = errors.New("fast path not available")
+
+// streamedChunk is a chunk of a file found by scanning the TOC.
+type streamedChunk struct {
+	entry *estargz.TOCEntry
+	next  int64 // the offset where the gzip stream of the next chunk or file begins
+}
+
+// canStreamTOC reports whether a single file can be looked up by scanning the TOC
+// instead of parsing the whole TOC with Open.
+// Once the layer is opened, the parsed TOC is used instead.
+// Strict verification needs the whole TOC to verify it, and only gzip-compressed TOCs can be scanned.
+// The scanned TOC is kept in memory, so TOCs to be spilled by WithTOCSpill are not scanned.
+func (l *Layer) canStreamTOC() bool {
+	return atomic.LoadInt32(&l.opened) == 0 && l.Format() == FormatGzip && l.externalTOC == nil && l.layerCache == nil &&
+		!l.offline && !l.strict && l.tocSpill == 0
+}
+
+// streamLookup scans the TOC JSON and returns the chunks of the regular file without building the whole index.
+// It returns errNoFastPath when the TOC has to be parsed fully, e.g. the file is a hardlink.
+func (l *Layer) streamLookup(name string) ([]streamedChunk, error) {
+	name = cleanPath(name)
+
+	tocOffset, footerSize, err := estargz.OpenFooter(io.NewSectionReader(l, 0, l.size))
+	if err != nil {
+		if l.gzipIndexDir != "" {
+			// Possibly a plain gzip layer to be read through its index
+			return nil, errNoFastPath
+		}
+		return nil, err
+	}
+
+	// Read the TOC with the same range as estargz.Open so that it can be reused from the cache
+	toc := make([]byte, l.size-tocOffset-footerSize)
+	if _, err = l.ReadAt(toc, tocOffset); err != nil {
+		return nil, fmt.Errorf("error reading %d byte TOC targz: %w", len(toc), err)
+	}
+	l.cache.add(l.digest, tocOffset, toc)
+
+	zr, err := gzip.NewReader(bytes.NewReader(toc))
+	if err != nil {
+		return nil, fmt.Errorf("malformed TOC gzip header: %w", err)
+	}
+	zr.Multistream(false)
+	tr := tar.NewReader(zr)
+	h, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tar header in TOC gzip stream: %w", err)
+	}
+	if h.Name != estargz.TOCTarName {
+		return nil, fmt.Errorf("TOC tar entry had name %q; expected %q", h.Name, estargz.TOCTarName)
+	}
+
+	dec := json.NewDecoder(tr)
+	if err = seekEntries(dec); err != nil {
+		return nil, err
+	}
+
+	var chunks []streamedChunk
+	for dec.More() {
+		var e estargz.TOCEntry
+		if err = dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("error decoding TOC JSON: %w", err)
+		}
+
+		if len(chunks) > 0 {
+			if e.Type == "chunk" {
+				chunks[len(chunks)-1].next = e.Offset
+				e.Name = chunks[0].entry.Name
+				if e.ChunkSize == 0 {
+					e.ChunkSize = chunks[0].entry.Size - e.ChunkOffset
+				}
+				chunks = append(chunks, streamedChunk{entry: &e, next: l.size})
+				continue
+			}
+			if e.Offset != 0 {
+				// The next file begins
+				chunks[len(chunks)-1].next = e.Offset
+				return chunks, nil
+			}
+			continue
+		}
+
+		if strings.TrimPrefix(path.Clean("/"+e.Name), "/") != name {
+			continue
+		}
+		if e.Type != "reg" {
+			// Leave hardlinks and other types to the full parse
+			return nil, errNoFastPath
+		}
+		e.Name = name
+		if e.ChunkSize == 0 {
+			e.ChunkSize = e.Size
+		}
+		chunks = append(chunks, streamedChunk{entry: &e, next: l.size})
+	}
+
+	if len(chunks) == 0 {
+		return nil, errNoFastPath
+	}
+	// The file is the last one in the TOC
+	return chunks, nil
+}
+
+// seekEntries advances the decoder to the first element of the "entries" array.
+func seekEntries(dec *json.Decoder) error {
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("unexpected TOC JSON token %v", t)
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if t == "entries" {
+			if t, err = dec.Token(); err != nil {
+				return err
+			} else if t != json.Delim('[') {
+				return fmt.Errorf("unexpected TOC JSON token %v", t)
+			}
+			return nil
+		}
+
+		// Skip the value of another field like "version"
+		var v json.RawMessage
+		if err = dec.Decode(&v); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("entries not found in TOC JSON")
+}
+
+// readStreamedChunk decompresses the chunk from its own gzip stream into a pooled buffer, which the caller returns.
+// The blob is read in the same way as estargz so that cached ranges are shared.
+func (l *Layer) readStreamedChunk(e *estargz.TOCEntry, next int64) (*[]byte, error) {
+	remain := next - e.Offset
+	bufSize := maxGzipRead
+	if remain < maxGzipRead {
+		bufSize = int(remain)
+	}
+
+	br := bufio.NewReaderSize(io.NewSectionReader(l, e.Offset, remain), bufSize)
+	if _, err := br.Peek(bufSize); err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	// Every chunk has its own gzip stream beginning at its offset.
+	// Stop at the end of the stream instead of reading into the next one so that a broken TOC fails here.
+	gz.Multistream(false)
+
+	bp, err := getBuffer(e.ChunkSize)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.ReadFull(gz, *bp); err != nil {
+		putBuffer(bp)
+		return nil, err
+	}
+	return bp, nil
+}
@@ -0,0 +1,71 @@
+package remote_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestCopyFileBeforeOpen(t *testing.T) {
+	files := []remotetest.File{
+		{Name: "first", Content: "the first file"},
+		{Name: "d/"},
+		{Name: "d/chunked", Content: "a file spanning several chunks"},
+		{Name: "empty"},
+		{Name: "last", Content: "the last file in the layer"},
+	}
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(t, tr, remotetest.Layer(t, 4, files...))
+	r := remotetest.Open(t, tr)
+	for _, f := range files {
+		if f.Name == "d/" {
+			continue
+		}
+		// Fresh layers aren't opened, so that the file is looked up by scanning the TOC
+		l := layersOf(t, r)[0]
+		var buf bytes.Buffer
+		if _, err := l.CopyFile(&buf, f.Name); err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		if buf.String() != f.Content {
+			t.Errorf("%s: got %q, want %q", f.Name, buf.String(), f.Content)
+		}
+	}
+
+	if _, err := layersOf(t, r)[0].CopyFile(ioutil.Discard, "missing"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+// BenchmarkLookupLargeTOC compares reading a single file of a layer with a large TOC
+// by scanning the TOC and by parsing the whole TOC with Open first.
+func BenchmarkLookupLargeTOC(b *testing.B) {
+	const n = 20000
+	files := make([]remotetest.File, n)
+	for i := range files {
+		files[i] = remotetest.File{Name: fmt.Sprintf("file%05d", i), Content: fmt.Sprintf("content %d", i)}
+	}
+	tr := remotetest.NewTransport()
+	remotetest.PushLayers(b, tr, remotetest.Layer(b, 0, files...))
+	r := remotetest.Open(b, tr)
+	target := files[n/2].Name
+
+	for _, parse := range []bool{false, true} {
+		b.Run(fmt.Sprintf("parse=%v", parse), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				l := layersOf(b, r)[0]
+				if parse {
+					if _, err := l.Open(); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if _, err := l.CopyFile(ioutil.Discard, target); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package remote
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// redactedHeaders are request headers which carry credentials.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// traceRecord is a record of a request written as a line of NDJSON.
+type traceRecord struct {
+	Time     time.Time           `json:"time"`
+	Method   string              `json:"method"`
+	URL      string              `json:"url"`
+	Range    string              `json:"range,omitempty"`
+	Header   map[string][]string `json:"header,omitempty"`
+	Status   int                 `json:"status,omitempty"`
+	Bytes    int64               `json:"bytes,omitempty"`
+	Duration time.Duration       `json:"duration"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// traceTransport writes a record of every request and its response to w.
+type traceTransport struct {
+	inner http.RoundTripper
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newTraceTransport(inner http.RoundTripper, w io.Writer) *traceTransport {
+	return &traceTransport{inner: inner, enc: json.NewEncoder(w)}
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.inner.RoundTrip(req)
+
+	rec := traceRecord{
+		Time:     start,
+		Method:   req.Method,
+		URL:      redactURL(req.URL),
+		Range:    req.Header.Get("Range"),
+		Header:   redactHeader(req.Header),
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.Status = res.StatusCode
+		rec.Bytes = res.ContentLength
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Tracing is best-effort and must not fail the request.
+	_ = t.enc.Encode(rec)
+
+	return res, err
+}
+
+func redactHeader(h http.Header) map[string][]string {
+	if len(h) == 0 {
+		return nil
+	}
+	redacted := h.Clone()
+	for _, key := range redactedHeaders {
+		if redacted.Get(key) != "" {
+			redacted.Set(key, "REDACTED")
+		}
+	}
+	return redacted
+}
+
+// redactURL hides the user info and the query values of the URL
+// since pre-signed URLs carry credentials in their queries.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	if redacted.User != nil {
+		redacted.User = url.User("REDACTED")
+	}
+	if q := redacted.Query(); len(q) > 0 {
+		for key := range q {
+			q.Set(key, "REDACTED")
+		}
+		redacted.RawQuery = q.Encode()
+	}
+	return redacted.String()
+}
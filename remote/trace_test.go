@@ -0,0 +1,70 @@
+package remote_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestTrace(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "traced"}))
+
+	var requests int32
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		return inner.RoundTrip(req)
+	})
+	var buf bytes.Buffer
+	r := remotetest.Open(t, tr, remote.WithTrace(&buf), remote.WithRequestModifier(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer secret")
+		return nil
+	}))
+	if _, err := r.ReadFile(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	var records, ranges, redacted int
+	s := bufio.NewScanner(&buf)
+	for s.Scan() {
+		var rec struct {
+			Method string `json:"method"`
+			URL    string `json:"url"`
+			Range  string `json:"range"`
+			Status int    `json:"status"`
+		}
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid record %q: %v", s.Text(), err)
+		}
+		if rec.Method == "" || rec.URL == "" || rec.Status == 0 {
+			t.Errorf("incomplete record %q", s.Text())
+		}
+		if strings.Contains(s.Text(), "secret") {
+			t.Errorf("credentials aren't redacted in %q", s.Text())
+		}
+		if rec.Range != "" {
+			ranges++
+		}
+		if strings.Contains(s.Text(), "REDACTED") {
+			redacted++
+		}
+		records++
+	}
+	if n := int(atomic.LoadInt32(&requests)); records != n {
+		t.Errorf("got %d records for %d requests", records, n)
+	}
+	if ranges == 0 {
+		t.Error("no range request is recorded")
+	}
+	if redacted == 0 {
+		t.Error("no request with credentials is recorded")
+	}
+}
@@ -0,0 +1,192 @@
+package remote
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// defaultMaxIdleConnsPerHost is the default number of idle connections kept per host.
+// Chunks are read by concurrent range requests to the same registry or CDN host,
+// and the default of net/http, 2, makes the other requests open a new connection every time.
+const defaultMaxIdleConnsPerHost = 32
+
+// defaultTransport is the transport shared by Remotes without transport options so that they share connections.
+var defaultTransport = newTunedTransport(defaultMaxIdleConnsPerHost)
+
+// newTunedTransport returns http.DefaultTransport tuned for many concurrent range requests.
+func newTunedTransport(maxIdleConnsPerHost int) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          0, // no limit in total
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// baseTransport returns the transport underlying the authenticated transport.
+func (o *options) baseTransport() http.RoundTripper {
+	var t http.RoundTripper = defaultTransport
+	if o.transport != nil {
+		t = o.transport
+	}
+	if tr, ok := t.(*http.Transport); ok && (len(o.hostOverrides) > 0 || o.unixSocket != "") {
+		tr = tr.Clone()
+		tr.DialContext = o.dialContext
+		t = tr
+	}
+	if o.trace != nil {
+		t = newTraceTransport(t, o.trace)
+	}
+	if o.profile != nil {
+		t = &profileTransport{inner: t, profile: o.profile}
+	}
+	return &acceptTransport{inner: t}
+}
+
+// manifestMediaTypes are the media types of manifests accepted from the registry, in the order of preference.
+// Docker schema 1 manifests, which go-containerregistry also accepts, are excluded
+// since they can't describe estargz layers with annotations,
+// and some registries serving multiple types per tag would otherwise pick them.
+var manifestMediaTypes = []types.MediaType{
+	types.OCIImageIndex,
+	types.OCIManifestSchema1,
+	types.DockerManifestList,
+	types.DockerManifestSchema2,
+}
+
+// acceptTransport negotiates the manifest media type with the full set of the types.
+type acceptTransport struct {
+	inner http.RoundTripper
+}
+
+func (t *acceptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.Contains(req.URL.Path, "/manifests/") {
+		return t.inner.RoundTrip(req)
+	}
+
+	accept := make([]string, len(manifestMediaTypes))
+	for i, mt := range manifestMediaTypes {
+		accept[i] = string(mt)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept", strings.Join(accept, ","))
+	return t.inner.RoundTrip(req)
+}
+
+// pingTransport keeps the last error of the requests, i.e. the ping authenticating to the registry.
+// go-containerregistry flattens the errors of the ping into a message, which loses the network error.
+type pingTransport struct {
+	inner http.RoundTripper
+
+	mu  sync.Mutex
+	err error
+}
+
+func (t *pingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.inner.RoundTrip(req)
+	if err != nil {
+		t.mu.Lock()
+		t.err = err
+		t.mu.Unlock()
+	}
+	return res, err
+}
+
+// wrap returns err wrapping the last error of the requests as well if any,
+// so that errors.As finds network errors in the flattened error of the ping.
+func (t *pingTransport) wrap(err error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		return err
+	}
+	return &pingError{err: err, cause: t.err}
+}
+
+// pingError is the error of the ping with its cause.
+type pingError struct {
+	err   error // the message of go-containerregistry, which includes the cause
+	cause error
+}
+
+func (e *pingError) Error() string {
+	return e.err.Error()
+}
+
+func (e *pingError) Unwrap() error {
+	return e.cause
+}
+
+// httpsTransport accesses the registry over https as forced by WithScheme.
+// go-containerregistry accesses local registries such as localhost over http,
+// which can't be overridden by the options of the name package.
+type httpsTransport struct {
+	inner http.RoundTripper
+	host  string
+}
+
+func (t *httpsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" || req.URL.Host != t.host {
+		return t.inner.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme = "https"
+	return t.inner.RoundTrip(req)
+}
+
+// prefixTransport serves the registry under the path prefix set by WithPathPrefix.
+// It prepends the prefix to the requests of go-containerregistry, which always access /v2/ at the root.
+type prefixTransport struct {
+	inner  http.RoundTripper
+	host   string
+	prefix string
+}
+
+func (t *prefixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host || (req.URL.Path != "/v2" && !strings.HasPrefix(req.URL.Path, "/v2/")) {
+		return t.inner.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.URL.Path = t.prefix + req.URL.Path
+	req.URL.RawPath = ""
+	return t.inner.RoundTrip(req)
+}
+
+// dialContext dials the address overriding the host with WithHostOverride, or the socket set by WithUnixSocket.
+func (o *options) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if o.unixSocket != "" {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", o.unixSocket)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if override, ok := o.hostOverrides[host]; ok {
+		if _, _, err := net.SplitHostPort(override); err == nil {
+			addr = override
+		} else {
+			addr = net.JoinHostPort(override, port)
+		}
+	}
+
+	d := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return d.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,270 @@
+package remote_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/knqyf263/stargz-registry/remote"
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestWithHostOverride(t *testing.T) {
+	srv := serveImage(t, nil, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "overridden"}))
+	addr := srv.Listener.Addr().String()
+	ip, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		ref      string
+		override string
+	}{
+		{name: "address with port", ref: "registry.test/test/image:latest", override: addr},
+		{name: "address without port", ref: "registry.test:" + port + "/test/image:latest", override: ip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := remote.New(tt.ref, remote.WithScheme("http"), remote.WithHostOverride("registry.test", tt.override))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := r.ReadFile(context.Background(), "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "overridden" {
+				t.Errorf("got %q, want %q", b, "overridden")
+			}
+		})
+	}
+}
+
+func TestManifestAccept(t *testing.T) {
+	inner := remotetest.NewTransport()
+	remotetest.PushLayers(t, inner, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "negotiated"}))
+
+	// The registry prefers Docker schema 1 manifests when accepted
+	// and returns the OCI manifest only when it is accepted.
+	tr := remotetest.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if !strings.Contains(req.URL.Path, "/manifests/") {
+			return inner.RoundTrip(req)
+		}
+		accept := req.Header.Get("Accept")
+		if strings.Contains(accept, string(types.DockerManifestSchema1)) {
+			resp := statusResponse(req, http.StatusOK)
+			resp.Header.Set("Content-Type", string(types.DockerManifestSchema1Signed))
+			resp.Body = ioutil.NopCloser(strings.NewReader(`{"schemaVersion": 1}`))
+			return resp, nil
+		}
+		if !strings.Contains(accept, string(types.OCIManifestSchema1)) {
+			return statusResponse(req, http.StatusNotFound), nil
+		}
+		for _, mt := range []types.MediaType{types.OCIImageIndex, types.DockerManifestList, types.DockerManifestSchema2} {
+			if !strings.Contains(accept, string(mt)) {
+				t.Errorf("%s is not accepted: %s", mt, accept)
+			}
+		}
+		return inner.RoundTrip(req)
+	})
+
+	b, err := remotetest.Open(t, tr).ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "negotiated" {
+		t.Errorf("got %q, want %q", b, "negotiated")
+	}
+}
+
+// concurrentFiles is the number of files read at the same time by TestConnectionReuse and BenchmarkConcurrentReads.
+const concurrentFiles = 8
+
+// serveSlowBlobs serves an image of a layer with concurrentFiles files, whose blob responses are delayed so that
+// concurrent range requests overlap. It returns the reference and a function reporting the number of connections
+// blob requests arrived on.
+func serveSlowBlobs(t testing.TB) (string, func() int) {
+	var files []remotetest.File
+	for i := 0; i < concurrentFiles; i++ {
+		files = append(files, remotetest.File{Name: fmt.Sprintf("f%d", i), Content: strings.Repeat(fmt.Sprint(i), 1024)})
+	}
+	var mu sync.Mutex
+	conns := map[string]bool{}
+	srv := serveImage(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, "/blobs/") {
+				mu.Lock()
+				conns[r.RemoteAddr] = true
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}, remotetest.Layer(t, 0, files...))
+	return srv.Listener.Addr().String() + "/test/image:latest", func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(conns)
+	}
+}
+
+// readConcurrently reads all the files of serveSlowBlobs at the same time.
+func readConcurrently(r remote.Remote) error {
+	errs := make(chan error, concurrentFiles)
+	for i := 0; i < concurrentFiles; i++ {
+		go func(i int) {
+			_, err := r.ReadFile(context.Background(), fmt.Sprintf("f%d", i))
+			errs <- err
+		}(i)
+	}
+	var err error
+	for i := 0; i < concurrentFiles; i++ {
+		if e := <-errs; e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func TestConnectionReuse(t *testing.T) {
+	ref, conns := serveSlowBlobs(t)
+	r, err := remote.New(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const rounds = 5
+	for i := 0; i < rounds; i++ {
+		if err = readConcurrently(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// With 2 idle connections per host, every round after the first would open most of its connections again
+	if n := conns(); n > concurrentFiles+2 {
+		t.Errorf("expected connections to be reused across rounds, got %d connections for %d rounds of %d reads", n, rounds, concurrentFiles)
+	}
+
+	if _, err = remote.New(ref, remote.WithMaxIdleConnsPerHost(0)); err == nil {
+		t.Error("expected an error for 0 idle connections")
+	}
+}
+
+func BenchmarkConcurrentReads(b *testing.B) {
+	for _, n := range []int{2, 32} {
+		b.Run(fmt.Sprintf("idle=%d", n), func(b *testing.B) {
+			ref, conns := serveSlowBlobs(b)
+			r, err := remote.New(ref, remote.WithMaxIdleConnsPerHost(n))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err = readConcurrently(r); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(conns()), "conns")
+		})
+	}
+}
+
+func TestWithUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "registry.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(registry.New(registry.Logger(log.New(ioutil.Discard, "", 0))))
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	const ref = "localhost:5000/test/image:latest"
+	img, err := remotetest.NewImage([][]byte{remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "over a socket"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", sock)
+	}}
+	if err = remotetest.Push(dial, ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing listens on localhost:5000, so the read succeeds only through the socket
+	r, err := remote.New(ref, remote.WithUnixSocket(sock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.ReadFile(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "over a socket" {
+		t.Errorf("unexpected content %q", b)
+	}
+
+	if _, err = remote.New(ref, remote.WithUnixSocket("")); err == nil {
+		t.Error("expected an error for an empty path")
+	}
+}
+
+func TestWithPathPrefix(t *testing.T) {
+	var mu sync.Mutex
+	var unprefixed []string
+	srv := serveImage(t, func(h http.Handler) http.Handler {
+		prefixed := http.StripPrefix("/registry", h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/registry/v2") {
+				mu.Lock()
+				unprefixed = append(unprefixed, r.URL.Path)
+				mu.Unlock()
+				http.NotFound(w, r)
+				return
+			}
+			prefixed.ServeHTTP(w, r)
+		})
+	}, remotetest.Layer(t, 0, remotetest.File{Name: "a", Content: "under a subpath"}))
+	ref := srv.Listener.Addr().String() + "/test/image:latest"
+
+	// The prefix is normalized to a leading slash without a trailing one
+	for _, prefix := range []string{"/registry", "registry/"} {
+		r, err := remote.New(ref, remote.WithPathPrefix(prefix))
+		if err != nil {
+			t.Fatalf("%s: %v", prefix, err)
+		}
+		b, err := r.ReadFile(context.Background(), "a")
+		if err != nil {
+			t.Fatalf("%s: %v", prefix, err)
+		}
+		if string(b) != "under a subpath" {
+			t.Errorf("%s: unexpected content %q", prefix, b)
+		}
+	}
+	mu.Lock()
+	if len(unprefixed) != 0 {
+		t.Errorf("unexpected requests without the prefix: %v", unprefixed)
+	}
+	mu.Unlock()
+
+	if _, err := remote.New(ref, remote.WithRetry(1, 0)); err == nil {
+		t.Error("expected an error without the prefix")
+	}
+	if _, err := remote.New(ref, remote.WithPathPrefix("/")); err == nil {
+		t.Error("expected an error for an empty prefix")
+	}
+}
@@ -0,0 +1,134 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// VerifyTOC checks that the TOC of the layer matches the digest recorded in the toc.digest annotation.
+// It returns a verifier of the chunk digests recorded in the TOC.
+func (l *Layer) VerifyTOC() (estargz.TOCEntryVerifier, error) {
+	annotation, ok := l.annotations[estargz.TOCJSONDigestAnnotation]
+	if !ok {
+		return nil, fmt.Errorf("layer %s has no %s annotation", l.digest, estargz.TOCJSONDigestAnnotation)
+	}
+	tocDigest, err := digest.Parse(annotation)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOC digest %q: %w", annotation, err)
+	}
+
+	esgz, err := l.Open()
+	if err != nil {
+		return nil, err
+	}
+	return esgz.VerifyTOC(tocDigest)
+}
+
+// VerifyFile downloads and decompresses the named file to check every chunk against its digest in the TOC.
+// Chunk digests are of the uncompressed content, so verifying a file costs as much CPU as reading it.
+// The compressed chunks are fetched by a single request using the offsets in the TOC
+// and decompressed straight into the verifiers, saving the chunk buffers and requests of the read path.
+func (l *Layer) VerifyFile(v estargz.TOCEntryVerifier, name string) error {
+	if l.offline {
+		// Only the cached ranges of the read path are available
+		return l.readChunks(name, 0, -1, nil, func(ce *estargz.TOCEntry, p []byte) error {
+			if ce == nil {
+				// Holes of sparse files have no digests
+				return nil
+			}
+			return verifyChunk(v, name, ce, p)
+		})
+	}
+
+	esgz, err := l.Open()
+	if err != nil {
+		return err
+	}
+	e, ok := esgz.Lookup(name)
+	if !ok {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if e.Type != "reg" {
+		return &os.PathError{Op: "open", Path: name, Err: errors.New("not a regular file")}
+	}
+	if e.Size == 0 {
+		return nil
+	}
+
+	chunks := chunksOf(esgz, e)
+	begin, end := chunks[0].Offset, chunks[len(chunks)-1].NextOffset()
+	rc, err := l.fetch(l.ctx, begin, end-1)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// Holes of sparse files have no chunks, so they are skipped as well as their digests.
+	pos := begin
+	for _, ce := range chunks {
+		if _, err = io.CopyN(ioutil.Discard, rc, ce.Offset-pos); err != nil {
+			return err
+		}
+		if err = verifyCompressedChunk(v, name, ce, io.LimitReader(rc, ce.NextOffset()-ce.Offset), l.decompressor()); err != nil {
+			return err
+		}
+		pos = ce.NextOffset()
+	}
+	return nil
+}
+
+// verifyCompressedChunk decompresses the chunk read from r into its verifier. r is consumed to the end.
+func verifyCompressedChunk(v estargz.TOCEntryVerifier, name string, ce *estargz.TOCEntry, r io.Reader, d estargz.Decompressor) error {
+	verifier, err := v.Verifier(ce)
+	if err != nil {
+		return err
+	}
+	dr, err := d.Reader(r)
+	if err != nil {
+		return fmt.Errorf("invalid chunk of %s at offset %d: %w", name, ce.ChunkOffset, err)
+	}
+	defer dr.Close()
+	n, err := io.Copy(verifier, io.LimitReader(dr, ce.ChunkSize))
+	if err != nil {
+		return fmt.Errorf("invalid chunk of %s at offset %d: %w", name, ce.ChunkOffset, err)
+	}
+	if n != ce.ChunkSize || !verifier.Verified() {
+		return fmt.Errorf("invalid chunk of %s at offset %d", name, ce.ChunkOffset)
+	}
+	// The rest, e.g. the gzip trailer, is read so that the next chunk starts at its offset
+	_, err = io.Copy(ioutil.Discard, r)
+	return err
+}
+
+// verifyChunk checks the whole content of the chunk against its digest.
+func verifyChunk(v estargz.TOCEntryVerifier, name string, ce *estargz.TOCEntry, p []byte) error {
+	verifier, err := v.Verifier(ce)
+	if err != nil {
+		return err
+	}
+	if _, err = verifier.Write(p); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("invalid chunk of %s at offset %d", name, ce.ChunkOffset)
+	}
+	return nil
+}
+
+// strictVerifier returns the verifier of the layer for WithStrictVerification, verifying the TOC on the first call.
+// Layers without the TOC digest annotation are refused.
+func (l *Layer) strictVerifier() (estargz.TOCEntryVerifier, error) {
+	l.verifyOnce.Do(func() {
+		l.verifier, l.verifyErr = l.VerifyTOC()
+		if l.verifyErr != nil {
+			l.verifyErr = fmt.Errorf("strict verification: %w", l.verifyErr)
+		}
+	})
+	return l.verifier, l.verifyErr
+}
@@ -0,0 +1,56 @@
+package remote_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/knqyf263/stargz-registry/remote/remotetest"
+)
+
+func TestVerifyFile(t *testing.T) {
+	// Three chunks of incompressible content
+	blob, tocDigest, err := remotetest.BuildLayerChunked([]remotetest.File{randomFile(1)}, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := remotetest.NewTransport()
+	pushAnnotated(t, inner, blob, tocDigest)
+
+	t.Run("verified", func(t *testing.T) {
+		tr := &countingTransport{inner: inner}
+		l := layersOf(t, remotetest.Open(t, tr))[0]
+		v, err := l.VerifyTOC()
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := tr.count()
+		if err = l.VerifyFile(v, "a"); err != nil {
+			t.Fatal(err)
+		}
+		// All the chunks are fetched at once
+		if n := tr.count() - before; n != 1 {
+			t.Errorf("expected 1 range request for 3 chunks, got %d", n)
+		}
+	})
+
+	t.Run("tampered chunk", func(t *testing.T) {
+		esgz, err := layersOf(t, remotetest.Open(t, inner))[0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ce, ok := esgz.ChunkEntryForOffset("a", 1000)
+		if !ok {
+			t.Fatal("no chunk at 1000")
+		}
+		// Incompressible content is stored as is after the gzip header and the header of the stored block
+		l := layersOf(t, remotetest.Open(t, flippingTransport(inner, ce.Offset+10+5+100)))[0]
+		v, err := l.VerifyTOC()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = l.VerifyFile(v, "a")
+		if err == nil || !strings.Contains(err.Error(), "invalid chunk of a at offset 1000") {
+			t.Errorf("got %v, want the chunk at 1000 to be refused", err)
+		}
+	})
+}